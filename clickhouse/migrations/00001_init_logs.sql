@@ -15,8 +15,6 @@ CREATE TABLE logs (
            nats_format = 'JSONEachRow',
            date_time_input_format = 'best_effort';
 
-CREATE INDEX logs_idx ON logs(id, project_id, name);
-
 -- +goose StatementEnd
 
 -- +goose Down
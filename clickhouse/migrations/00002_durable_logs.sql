@@ -0,0 +1,65 @@
+-- +goose Up
+
+-- the NATS engine table is only a queue, a row read from it is gone. The
+-- rows are moved by a materialized view from a queue with the event type and
+-- the actor to a MergeTree table, which keeps them for the audit queries.
+-- ClickHouse runs a single statement per query, so the statements aren't
+-- grouped into blocks.
+
+DROP TABLE IF EXISTS logs;
+
+CREATE TABLE IF NOT EXISTS goods_log (
+    id          UInt64,
+    project_id  UInt64,
+    event_type  LowCardinality(String),
+    actor       String,
+    name        String,
+    description Nullable(String),
+    priority    Nullable(Int32),
+    removed     Boolean,
+    event_time  DateTime
+) ENGINE = MergeTree
+  PARTITION BY toYYYYMM(event_time)
+  ORDER BY (project_id, id, event_time);
+
+CREATE TABLE IF NOT EXISTS logs_queue (
+    id          UInt64,
+    project_id  UInt64,
+    event_type  String,
+    actor       String,
+    name        String,
+    description Nullable(String),
+    priority    Nullable(Int32),
+    removed     Boolean,
+    event_time  DateTime
+) ENGINE = NATS
+  SETTINGS nats_url = 'nats:4222',
+           nats_subjects = 'clickhouse_logs',
+           nats_format = 'JSONEachRow',
+           date_time_input_format = 'best_effort';
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS logs_mv TO goods_log AS
+    SELECT id, project_id, event_type, actor, name, description, priority, removed, event_time
+    FROM logs_queue;
+
+-- +goose Down
+
+DROP VIEW IF EXISTS logs_mv;
+
+DROP TABLE IF EXISTS logs_queue;
+
+DROP TABLE IF EXISTS goods_log;
+
+CREATE TABLE IF NOT EXISTS logs (
+    id          UInt64,
+    project_id  UInt64,
+    name        String,
+    description Nullable(String),
+    priority    Nullable(Int32),
+    removed     Boolean,
+    event_time  DateTime
+) ENGINE = NATS
+  SETTINGS nats_url = 'nats:4222',
+           nats_subjects = 'clickhouse_logs',
+           nats_format = 'JSONEachRow',
+           date_time_input_format = 'best_effort';
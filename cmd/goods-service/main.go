@@ -2,29 +2,45 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"log/slog"
 
-	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/kldd0/goods-service/internal/analytics"
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/clients/clickhouse"
 	"github.com/kldd0/goods-service/internal/clients/redis"
 	"github.com/kldd0/goods-service/internal/config"
-	"github.com/kldd0/goods-service/internal/http-server/handlers/good/delete"
-	"github.com/kldd0/goods-service/internal/http-server/handlers/good/get"
-	"github.com/kldd0/goods-service/internal/http-server/handlers/good/page"
-	"github.com/kldd0/goods-service/internal/http-server/handlers/good/patch"
-	"github.com/kldd0/goods-service/internal/http-server/handlers/good/post"
-	mw "github.com/kldd0/goods-service/internal/http-server/middleware"
+	"github.com/kldd0/goods-service/internal/deadletter"
+	"github.com/kldd0/goods-service/internal/events"
+	grpcserver "github.com/kldd0/goods-service/internal/grpc-server"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/auth"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/idempotency"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/primary"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/ratelimit"
+	"github.com/kldd0/goods-service/internal/http-server/router"
 	"github.com/kldd0/goods-service/internal/logger"
+	"github.com/kldd0/goods-service/internal/migrate"
+	nats_streaming "github.com/kldd0/goods-service/internal/nats-streaming"
+	"github.com/kldd0/goods-service/internal/nats-streaming/pub"
+	"github.com/kldd0/goods-service/internal/nats-streaming/sub"
+	"github.com/kldd0/goods-service/internal/service"
+	"github.com/kldd0/goods-service/internal/storage"
+	"github.com/kldd0/goods-service/internal/storage/memory"
 	"github.com/kldd0/goods-service/internal/storage/postgres"
+	"github.com/kldd0/goods-service/internal/webhooks"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 )
 
 func main() {
@@ -42,9 +58,10 @@ func main() {
 	)
 	log.Debug("debug messages are enabled")
 
-	db, err := postgres.New(config.DBUri)
+	db, err := openStorage(ctx, log, config)
 	if err != nil {
 		log.Error("failed connecting to database", logger.Err(err))
+		os.Exit(1)
 	}
 	defer db.Close()
 
@@ -56,59 +73,162 @@ func main() {
 	defer nc.Flush()
 	defer nc.Close()
 
-	/*
-		cm, err := sub.New(nc)
+	// creating cache
+	cache, err := redis.New(ctx, config)
+	if err != nil {
+		log.Info("failed connecting to redis", logger.Err(err))
+	}
 
-		if err != nil {
-			log.Error("failed creating consumer", logger.Err(err))
-		}
+	// in-process feed of the changes made through the apis
+	feed := changefeed.NewHub(config.Watch.HistorySize)
 
-		// subscribe for messages
-		ch, err := cm.Subscribe()
-		if err != nil {
-			log.Error("failed to subscribe to cluster", logger.Err(err))
-		}
+	// delivery of the changes to the configured sinks
+	sinks, err := events.New(config.Events, nc)
+	if err != nil {
+		log.Error("failed creating event sinks", logger.Err(err))
+		os.Exit(1)
+	}
 
-		// main service init
-		svc := service.New(ctx, db)
+	if len(sinks) > 0 {
+		forwardCtx, stopForward := context.WithCancel(ctx)
+		forwarded := make(chan struct{})
 
-		// start business logic
-		go svc.Run(ch)
-	*/
+		go func() {
+			defer close(forwarded)
+			sinks.Forward(forwardCtx, log, feed)
+		}()
 
-	// creating cache
-	cache, err := redis.New(ctx, config)
-	if err != nil {
-		log.Info("failed connecting to redis", logger.Err(err))
+		// the sinks are closed once the forwarders have stopped using them
+		defer func() {
+			stopForward()
+			<-forwarded
+
+			if err := sinks.Close(); err != nil {
+				log.Error("failed closing event sinks", logger.Err(err))
+			}
+		}()
 	}
 
-	router := chi.NewRouter()
+	// delivery of the changes to the webhooks of the projects
+	dispatcher := webhooks.New(log, db, config.Webhooks)
+	{
+		dispatchCtx, stopDispatch := context.WithCancel(ctx)
+		dispatched := make(chan struct{})
+
+		dispatcher.Start(dispatchCtx)
+		go func() {
+			defer close(dispatched)
+			events.Forward(dispatchCtx, log, feed, dispatcher)
+		}()
+
+		defer func() {
+			stopDispatch()
+			<-dispatched
 
-	router.Use(middleware.RequestID)
-	router.Use(middleware.Logger)
-	router.Use(mw.New(log))
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.URLFormat)
+			_ = dispatcher.Close()
+		}()
+	}
 
-	// healthcheck route
-	router.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
-		w.WriteHeader(http.StatusOK)
+	var deadLetters *deadletter.Queue
 
-		_ = json.NewEncoder(w).Encode(map[string]bool{
-			"pong": true,
+	if config.JetStream.Enabled {
+		js, stream, err := nats_streaming.Setup(ctx, log, nc, config.JetStream)
+		if err != nil {
+			log.Error("failed setting up JetStream", logger.Err(err))
+			os.Exit(1)
+		}
+
+		// consumer of the good commands, publishing their results
+		svc := service.New(
+			log, db, cache, feed,
+			pub.New(js, config.JetStream.ResultsSubject),
+			pub.New(js, config.JetStream.DeadLetterSubject),
+			config.JetStream.MaxAttempts,
+			// the commands are redelivered while the stream keeps them
+			config.JetStream.MaxAge,
+		)
+
+		subscriber := sub.New(log, stream, config.JetStream)
+		if err := subscriber.Subscribe(ctx, svc.Process); err != nil {
+			log.Error("failed to subscribe to commands", logger.Err(err))
+			os.Exit(1)
+		}
+		defer subscriber.Close()
+
+		// dead letters are replayed to the commands subject and removed
+		// from the stream, so that they aren't listed after a restart.
+		// A dead letter replayed by several replicas is published once,
+		// the stream drops the messages with the same id, and removed once.
+		commands := pub.New(js, config.JetStream.CommandsSubject)
+		deadLetters = deadletter.NewQueue(func(id uint64, data []byte) error {
+			if err := commands.PublishData(ctx, fmt.Sprintf("replay-%d", id), data); err != nil {
+				return err
+			}
+
+			if err := stream.DeleteMsg(ctx, id); err != nil && !errors.Is(err, jetstream.ErrMsgNotFound) {
+				return err
+			}
+
+			return nil
 		})
-	})
+		if err := subscriber.SubscribeDeadLetters(ctx, deadLetters.Consume(log)); err != nil {
+			log.Error("failed to subscribe to dead letters", logger.Err(err))
+			os.Exit(1)
+		}
+	}
+
+	// read side of the change log, the audit and analytics apis are disabled without it
+	var (
+		audit   clickhouse.AuditLog
+		reports *analytics.Service
+	)
+	if config.ClickHouse.Addr != "" {
+		ch, err := clickhouse.New(ctx, config.ClickHouse)
+		if err != nil {
+			log.Error("failed connecting to clickhouse", logger.Err(err))
+		} else {
+			defer ch.Close()
+			audit = ch
+			reports = analytics.New(log, ch, cache, config.Analytics.CacheTTL)
+		}
+	}
 
-	router.Route("/good", func(r chi.Router) {
-		r.Get("/{id}/{projectId}", get.New(log, db, cache))
+	authn, err := auth.New(log, config.Auth)
+	if err != nil {
+		log.Error("failed configuring authentication", logger.Err(err))
+		os.Exit(1)
+	}
 
-		r.Post("/create", post.New(log, db))
-		r.Patch("/update", patch.New(log, db, cache))
-		r.Delete("/remove", delete.New(log, db, cache))
-	})
+	var limiter *ratelimit.Limiter
+	if config.RateLimit.Enabled {
+		limiter = ratelimit.New(log, cache, config.RateLimit.Groups)
+	}
+
+	// the reads of the replicas may miss the latest writes of the clients
+	var pinner *primary.Pinner
+	if len(config.Postgres.Replicas) > 0 {
+		pinner = primary.New(config.Postgres.ReadYourWrites)
+	}
 
-	router.Get("/goods/list", page.New(log, db, cache))
+	// only the postgres storage has a connection pool
+	dbStats, _ := db.(router.DBStats)
+
+	router := router.New(log, db, cache, feed, router.Options{
+		SwaggerUI:      config.HTTPServer.SwaggerUI,
+		WatchHeartbeat: config.Watch.Heartbeat,
+		Auth:           authn,
+		RateLimiter:    limiter,
+		MaxPageLimit:   config.HTTPServer.MaxPageLimit,
+		ClientIds:      config.HTTPServer.ClientIds,
+		Idempotency:    idempotency.New(log, cache, config.Idempotency),
+		DeadLetters:    deadLetters,
+		Webhooks:       db,
+		WebhookTester:  dispatcher,
+		Audit:          audit,
+		Analytics:      reports,
+		DBStats:        dbStats,
+		Primary:        pinner,
+	})
 
 	log.Info("starting http server", slog.String("address", config.HTTPServer.Address))
 
@@ -121,7 +241,24 @@ func main() {
 		IdleTimeout:  config.HTTPServer.IdleTimeout,
 	}
 
-	// listen to OS signals and gracefully shutdown HTTP server
+	grpcSrv := grpcserver.New(log, db, cache, feed, authn, config.HTTPServer.MaxPageLimit)
+
+	lis, err := net.Listen("tcp", config.GRPCServer.Address)
+	if err != nil {
+		log.Error("failed to listen grpc address", logger.Err(err))
+		os.Exit(1)
+	}
+
+	log.Info("starting grpc server", slog.String("address", config.GRPCServer.Address))
+
+	// start grpc server
+	go func() {
+		if err := grpcSrv.Serve(lis); err != nil {
+			log.Error("grpc server Serve error:", logger.Err(err))
+		}
+	}()
+
+	// listen to OS signals and gracefully shutdown HTTP and gRPC servers
 	done := make(chan struct{})
 	go func() {
 		sigint := make(chan os.Signal, 1)
@@ -137,6 +274,8 @@ func main() {
 			log.Info("http server shutdown error", logger.Err(err))
 		}
 
+		grpcSrv.GracefulStop()
+
 		close(done)
 	}()
 
@@ -147,5 +286,60 @@ func main() {
 
 	<-done
 
-	log.Info("http server stopped")
+	log.Info("http and grpc servers stopped")
+}
+
+type database interface {
+	storage.Storage
+	storage.WebhookStorage
+	Close() error
+}
+
+// openStorage connects to the database of the db uri, the data is kept
+// in memory with a memory:// uri.
+func openStorage(ctx context.Context, log *slog.Logger, cfg *config.Config) (database, error) {
+	if strings.HasPrefix(cfg.DBUri, memory.Scheme) {
+		return memory.New(), nil
+	}
+
+	if cfg.AutoMigrate {
+		if err := migrateSchema(ctx, log, cfg.DBUri); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := postgres.New(ctx, cfg.DBUri, cfg.Postgres)
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// migrateSchema applies the pending migrations embedded in the binary
+// before the storage is opened. It fails when the schema is newer than
+// the migrations, so that the service doesn't start on it.
+func migrateSchema(ctx context.Context, log *slog.Logger, uri string) error {
+	db, err := sql.Open(migrate.Postgres.Driver, uri)
+	if err != nil {
+		return fmt.Errorf("open migrations connection: %w", err)
+	}
+	defer db.Close()
+
+	results, err := migrate.Postgres.Up(ctx, db)
+	for _, r := range results {
+		log.Info("applied migration",
+			slog.String("migration", r.Source.Path),
+			slog.Duration("duration", r.Duration),
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		log.Info("schema is up to date")
+	}
+
+	return nil
 }
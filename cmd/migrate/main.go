@@ -2,75 +2,331 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
-	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/ClickHouse/clickhouse-go/v2"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/kldd0/goods-service/internal/config"
+	"github.com/kldd0/goods-service/internal/migrate"
+	"github.com/kldd0/goods-service/internal/storage/memory"
 	"github.com/pressly/goose/v3"
 )
 
-const (
-	dbDriver   = "pgx"
-	configFile = "config/pg.env"
-)
+// dsnEnv is the connection string used when -dsn isn't set
+const dsnEnv = "MIGRATE_DSN"
+
+const usage = `usage: migrate [flags] <command> [args]
+
+The migrations are embedded in the binary, the connection string is taken from
+-dsn, the %s env or the service config given by -config or CONFIG_PATH.
+
+commands:
+  up           apply the pending migrations
+  down         roll back the latest applied migration
+  redo         roll back the latest applied migration and apply it again
+  status       list the migrations and when they were applied
+  version      print the version of the schema
+  create NAME  create a sql migration in -dir
+  validate     check the embedded migrations without connecting
+
+flags:
+`
 
 var (
-	flags = flag.NewFlagSet("migrate", flag.ExitOnError)
-	dir   = flags.String("dir", "migrations", "directory with migration files")
+	flags      = flag.NewFlagSet("migrate", flag.ExitOnError)
+	dialect    = flags.String("dialect", migrate.Postgres.Name, "database to migrate: postgres or clickhouse")
+	dsn        = flags.String("dsn", "", "connection string of the database")
+	configPath = flags.String("config", "", "path to the service config")
+	dir        = flags.String("dir", "", "directory the migrations are created in (default: the directory of the dialect)")
+	dryRun     = flags.Bool("dry-run", false, "print the sql of up, down or redo instead of applying it")
 )
 
 func main() {
-	ctx, cancel := context.WithCancel(context.Background())
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), usage, dsnEnv)
+		flags.PrintDefaults()
+	}
+
+	// flag.ExitOnError exits on the parse errors
+	_ = flags.Parse(os.Args[1:])
+
+	args := flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	set, ok := migrate.Lookup(*dialect)
+	if !ok {
+		fail(fmt.Errorf("unknown dialect %q", *dialect))
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	dbString := createDBString()
+	if err := run(ctx, set, args[0], args[1:]); err != nil {
+		fail(err)
+	}
+}
+
+func run(ctx context.Context, set migrate.Set, command string, args []string) error {
+	// the commands working on the files don't need a database
+	switch command {
+	case "create":
+		if len(args) != 1 {
+			return errors.New("usage: migrate create NAME")
+		}
+
+		return create(set, args[0])
+	case "validate":
+		if len(args) != 0 {
+			return errors.New("usage: migrate validate")
+		}
+
+		return validate(set)
+	case "up", "down", "redo", "status", "version":
+		if len(args) != 0 {
+			return fmt.Errorf("usage: migrate %s", command)
+		}
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
 
-	err := flags.Parse(os.Args[1:])
+	db, err := open(set)
 	if err != nil {
-		panic(fmt.Errorf("failed parsing flags: %w", err))
+		return err
 	}
+	defer db.Close()
 
-	args := flags.Args()
+	// the dry run only reads, the provider would create the version table
+	if *dryRun {
+		return printPlan(ctx, set, db, command)
+	}
 
-	goose_command := args[1]
+	// up checks the version of the schema like the service does at startup
+	if command == "up" {
+		results, err := set.Up(ctx, db)
+		printResults(results)
+		if err != nil {
+			return fmt.Errorf("failed migrate up: %w", err)
+		}
+		if len(results) == 0 {
+			fmt.Println("no pending migrations")
+		}
+
+		return nil
+	}
 
-	db, err := goose.OpenDBWithDriver(dbDriver, dbString)
+	// the other commands wait for the migrations running elsewhere
+	p, err := set.LockedProvider(db)
 	if err != nil {
-		panic(fmt.Errorf("failed open db: %w", err))
+		return err
 	}
 
-	defer func() {
-		if err := db.Close(); err != nil {
-			panic(fmt.Errorf("failed closing db: %w", err))
+	switch command {
+	case "down":
+		result, err := p.Down(ctx)
+		printResults([]*goose.MigrationResult{result})
+		if err != nil {
+			return fmt.Errorf("failed migrate down: %w", err)
+		}
+	case "redo":
+		result, err := p.Down(ctx)
+		printResults([]*goose.MigrationResult{result})
+		if err != nil {
+			return fmt.Errorf("failed migrate redo: %w", err)
+		}
+
+		result, err = p.UpByOne(ctx)
+		printResults([]*goose.MigrationResult{result})
+		if err != nil {
+			return fmt.Errorf("failed migrate redo: %w", err)
+		}
+	case "status":
+		statuses, err := p.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("failed migrate status: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "APPLIED AT\tMIGRATION")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.State == goose.StateApplied {
+				applied = s.AppliedAt.Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", applied, s.Source.Path)
+		}
+
+		return w.Flush()
+	case "version":
+		version, err := p.GetDBVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("failed migrate version: %w", err)
 		}
-	}()
 
-	if err := goose.RunContext(ctx, goose_command, db, *dir, args[1:]...); err != nil {
-		panic(fmt.Errorf("failed migrate "+goose_command+": %w", err))
+		fmt.Println(version)
 	}
+
+	return nil
 }
 
-func createDBString() string {
-	type DBConfig struct {
-		DB       string `env:"POSTGRES_DB"`
-		User     string `env:"POSTGRES_USER"`
-		Password string `env:"POSTGRES_PASSWORD"`
+// open connects to the database of the set, the connection string is taken
+// from -dsn, the env or the service config in this order.
+func open(set migrate.Set) (*sql.DB, error) {
+	if *dsn == "" {
+		*dsn = os.Getenv(dsnEnv)
+	}
+	if *dsn != "" {
+		return goose.OpenDBWithDriver(set.Driver, *dsn)
+	}
+
+	path := *configPath
+	if path == "" {
+		path = os.Getenv("CONFIG_PATH")
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no database: set -dsn, %s or -config", dsnEnv)
 	}
 
-	var cfg DBConfig
+	cfg := config.MustLoadPath(path)
+
+	if set.Name == migrate.ClickHouse.Name {
+		if cfg.ClickHouse.Addr == "" {
+			return nil, fmt.Errorf("clickhouse.addr isn't set in %s", path)
+		}
+
+		return clickhouse.OpenDB(&clickhouse.Options{
+			Addr: []string{cfg.ClickHouse.Addr},
+			Auth: clickhouse.Auth{
+				Database: cfg.ClickHouse.Database,
+				Username: cfg.ClickHouse.Username,
+				Password: cfg.ClickHouse.Password,
+			},
+			DialTimeout: cfg.ClickHouse.DialTimeout,
+		}), nil
+	}
+
+	if cfg.DBUri == "" || strings.HasPrefix(cfg.DBUri, memory.Scheme) {
+		return nil, fmt.Errorf("db_uri of %s isn't a postgres database", path)
+	}
 
-	err := cleanenv.ReadConfig(configFile, &cfg)
+	return goose.OpenDBWithDriver(set.Driver, cfg.DBUri)
+}
+
+// printPlan prints the sql the command would run, without writing to db.
+func printPlan(ctx context.Context, set migrate.Set, db *sql.DB, command string) error {
+	if command == "status" || command == "version" {
+		return fmt.Errorf("-dry-run doesn't apply to %s", command)
+	}
+
+	loaded, err := set.Load()
+	if err != nil {
+		return err
+	}
+
+	applied, err := set.Applied(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if command == "up" {
+		pending := 0
+		for _, m := range loaded {
+			if applied[m.Version] {
+				continue
+			}
+
+			pending++
+			printSQL(m, "up", m.Up)
+		}
+
+		if pending == 0 {
+			fmt.Println("-- no pending migrations")
+		}
+
+		return nil
+	}
+
+	// down and redo roll back the latest applied migration
+	var version int64
+	for v := range applied {
+		version = max(version, v)
+	}
+
+	for _, m := range loaded {
+		if m.Version != version {
+			continue
+		}
+
+		printSQL(m, "down", m.Down)
+		if command == "redo" {
+			printSQL(m, "up", m.Up)
+		}
+
+		return nil
+	}
+
+	fmt.Println("-- no applied migrations")
+
+	return nil
+}
+
+func printSQL(m migrate.Migration, direction, query string) {
+	fmt.Printf("-- %s %s\n", direction, m.Path)
+	if m.NoTx {
+		fmt.Println("-- not in a transaction")
+	}
+	if query == "" {
+		query = "-- empty"
+	}
+	fmt.Printf("%s\n\n", query)
+}
+
+func printResults(results []*goose.MigrationResult) {
+	for _, r := range results {
+		if r != nil {
+			fmt.Println(r)
+		}
+	}
+}
+
+func create(set migrate.Set, name string) error {
+	if *dir == "" {
+		*dir = set.Dir
+	}
+
+	goose.SetSequential(true)
+
+	if err := goose.Create(nil, *dir, name, "sql"); err != nil {
+		return fmt.Errorf("failed create migration: %w", err)
+	}
+
+	return nil
+}
+
+func validate(set migrate.Set) error {
+	loaded, err := set.Load()
 	if err != nil {
-		panic(fmt.Errorf("failed reading config: %w", err))
+		return err
 	}
 
-	return fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=5432 sslmode=disable",
-		"localhost",
-		cfg.User,
-		cfg.Password,
-		cfg.DB,
-	)
+	fmt.Printf("%d %s migrations are valid\n", len(loaded), set.Name)
+
+	return nil
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "migrate:", err)
+	os.Exit(1)
 }
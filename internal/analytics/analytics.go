@@ -0,0 +1,355 @@
+// Package analytics builds the reports over the change log stored in
+// ClickHouse: the number of changes per time bucket, the removal rate and
+// the most edited goods. The reports are shaped as series ready for
+// charting and cached for a short time, so that dashboards refreshing
+// the same report don't run the aggregation on every request.
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"log/slog"
+
+	"github.com/kldd0/goods-service/internal/clients/clickhouse"
+	"github.com/kldd0/goods-service/internal/clients/redis"
+	"github.com/kldd0/goods-service/internal/logger"
+)
+
+// maxBuckets caps the buckets of the series, the time range of a query
+// spans at most as many buckets
+const maxBuckets = 1000
+
+type Cache interface {
+	GetAnalytics(ctx context.Context, key string) ([]byte, error)
+	SetAnalytics(ctx context.Context, key string, report []byte, ttl time.Duration) error
+}
+
+type Point struct {
+	Time  time.Time `json:"time"`
+	Count uint64    `json:"count"`
+}
+
+// Series are the counts of a group, one point per bucket.
+type Series struct {
+	Key    string  `json:"key"`
+	Points []Point `json:"points"`
+}
+
+type EventsReport struct {
+	Bucket  clickhouse.Bucket  `json:"bucket"`
+	GroupBy clickhouse.GroupBy `json:"group_by"`
+	Series  []Series           `json:"series"`
+}
+
+type RemovalPoint struct {
+	Time    time.Time `json:"time"`
+	Created uint64    `json:"created"`
+	Removed uint64    `json:"removed"`
+	// Rate is the share of the removed goods to the created ones,
+	// zero when none were created
+	Rate float64 `json:"rate"`
+}
+
+type RemovalsReport struct {
+	Bucket clickhouse.Bucket `json:"bucket"`
+	Points []RemovalPoint    `json:"points"`
+}
+
+type MostEditedReport struct {
+	Goods []clickhouse.EditedGood `json:"goods"`
+}
+
+type Service struct {
+	log    *slog.Logger
+	source clickhouse.Analytics
+	cache  Cache
+	ttl    time.Duration
+}
+
+// New creates the reports service, the reports are cached for ttl
+// unless it is zero.
+func New(log *slog.Logger, source clickhouse.Analytics, cache Cache, ttl time.Duration) *Service {
+	return &Service{
+		log:    log,
+		source: source,
+		cache:  cache,
+		ttl:    ttl,
+	}
+}
+
+// Events counts the changes per bucket, a series per group.
+// The buckets without changes are filled with zeros.
+func (s *Service) Events(ctx context.Context, query clickhouse.AnalyticsQuery) (EventsReport, error) {
+	return cached(ctx, s, "events", query, func() (EventsReport, error) {
+		rows, err := s.source.CountEvents(ctx, query)
+		if err != nil {
+			return EventsReport{}, err
+		}
+
+		buckets := span(query)
+
+		// the groups known from the query have a series without changes too
+		counts := map[string]map[time.Time]uint64{}
+		for _, key := range groups(query) {
+			counts[key] = map[time.Time]uint64{}
+		}
+		for _, row := range rows {
+			if counts[row.Key] == nil {
+				counts[row.Key] = map[time.Time]uint64{}
+			}
+			counts[row.Key][row.Bucket.UTC()] += row.Count
+		}
+
+		keys := make([]string, 0, len(counts))
+		for key := range counts {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		report := EventsReport{
+			Bucket:  query.Bucket,
+			GroupBy: query.GroupBy,
+			Series:  make([]Series, 0, len(keys)),
+		}
+
+		for _, key := range keys {
+			points := make([]Point, 0, len(buckets))
+			for _, bucket := range buckets {
+				points = append(points, Point{Time: bucket, Count: counts[key][bucket]})
+			}
+
+			report.Series = append(report.Series, Series{Key: key, Points: points})
+		}
+
+		return report, nil
+	})
+}
+
+// Removals counts the created and the removed goods per bucket.
+// The buckets without changes are filled with zeros.
+func (s *Service) Removals(ctx context.Context, query clickhouse.AnalyticsQuery) (RemovalsReport, error) {
+	return cached(ctx, s, "removals", query, func() (RemovalsReport, error) {
+		rows, err := s.source.CountRemovals(ctx, query)
+		if err != nil {
+			return RemovalsReport{}, err
+		}
+
+		buckets := span(query)
+
+		byBucket := make(map[time.Time]clickhouse.RemovalRow, len(rows))
+		for _, row := range rows {
+			byBucket[row.Bucket.UTC()] = row
+		}
+
+		report := RemovalsReport{
+			Bucket: query.Bucket,
+			Points: make([]RemovalPoint, 0, len(buckets)),
+		}
+
+		for _, bucket := range buckets {
+			row := byBucket[bucket]
+
+			point := RemovalPoint{Time: bucket, Created: row.Created, Removed: row.Removed}
+			if row.Created > 0 {
+				point.Rate = float64(row.Removed) / float64(row.Created)
+			}
+
+			report.Points = append(report.Points, point)
+		}
+
+		return report, nil
+	})
+}
+
+// MostEdited returns the goods updated or reprioritized the most.
+func (s *Service) MostEdited(ctx context.Context, query clickhouse.AnalyticsQuery) (MostEditedReport, error) {
+	return cached(ctx, s, "most_edited", query, func() (MostEditedReport, error) {
+		goods, err := s.source.MostEdited(ctx, query)
+		if err != nil {
+			return MostEditedReport{}, err
+		}
+
+		if goods == nil {
+			goods = []clickhouse.EditedGood{}
+		}
+
+		return MostEditedReport{Goods: goods}, nil
+	})
+}
+
+// cached returns the cached report of the query or builds and caches it.
+// The reports are built without the cache when it fails.
+func cached[T any](ctx context.Context, s *Service, kind string, query clickhouse.AnalyticsQuery, build func() (T, error)) (T, error) {
+	const op = "analytics.cached"
+
+	log := s.log.With(slog.String("op", op), slog.String("report", kind))
+
+	var report T
+
+	if s.ttl <= 0 || s.cache == nil {
+		return build()
+	}
+
+	key := redis.AnalyticsKey(kind, fmt.Sprintf("%+v", query))
+
+	data, err := s.cache.GetAnalytics(ctx, key)
+	if err == nil {
+		if err := json.Unmarshal(data, &report); err == nil {
+			return report, nil
+		}
+
+		log.Error("failed unmarshalling cached report", logger.Err(err))
+	} else if !errors.Is(err, redis.ErrKeyNotFound) {
+		log.Error("failed to get cached report", logger.Err(err))
+	}
+
+	report, err = build()
+	if err != nil {
+		return report, err
+	}
+
+	data, err = json.Marshal(report)
+	if err != nil {
+		return report, fmt.Errorf("%s: failed marshalling report: %w", op, err)
+	}
+
+	if err := s.cache.SetAnalytics(ctx, key, data, s.ttl); err != nil {
+		log.Error("failed to cache report", logger.Err(err))
+	}
+
+	return report, nil
+}
+
+// span returns every bucket of the time range of the query, the range
+// is capped at maxBuckets by ParseQuery.
+func span(query clickhouse.AnalyticsQuery) []time.Time {
+	buckets := []time.Time{}
+	for t := query.Bucket.Truncate(query.From); t.Before(query.To); t = query.Bucket.Next(t) {
+		buckets = append(buckets, t)
+	}
+
+	return buckets
+}
+
+// groups returns the groups of the series known without the changes:
+// the event types, or the project the query is filtered by.
+func groups(query clickhouse.AnalyticsQuery) []string {
+	switch {
+	case query.GroupBy == clickhouse.GroupByEventType && query.EventType != "":
+		return []string{query.EventType}
+	case query.GroupBy == clickhouse.GroupByEventType:
+		return []string{"create", "update", "delete", "reprioritize"}
+	case query.GroupBy == clickhouse.GroupByProject && query.ProjectId > 0:
+		return []string{strconv.Itoa(query.ProjectId)}
+	default:
+		return nil
+	}
+}
+
+func bucketLength(bucket clickhouse.Bucket) time.Duration {
+	switch bucket {
+	case clickhouse.BucketHour:
+		return time.Hour
+	case clickhouse.BucketWeek:
+		return 7 * 24 * time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+// ParseQuery reads the query of a report from the url parameters:
+// projectId, type, from and to filter the changes, bucket (a day by
+// default) and groupBy (the event type by default) shape the series,
+// and limit caps the goods of the most edited report at maxLimit.
+// The range spans at most maxBuckets buckets: a missing bound is set
+// that far from the other one, and the latest buckets are reported
+// without both.
+func ParseQuery(params url.Values, maxLimit int) (clickhouse.AnalyticsQuery, error) {
+	query := clickhouse.AnalyticsQuery{
+		Bucket:  clickhouse.BucketDay,
+		GroupBy: clickhouse.GroupByEventType,
+	}
+	query.Limit = 10
+
+	var err error
+
+	if projectId := params.Get("projectId"); projectId != "" {
+		if query.ProjectId, err = strconv.Atoi(projectId); err != nil || query.ProjectId <= 0 {
+			return query, fmt.Errorf("invalid projectId")
+		}
+	}
+
+	switch eventType := params.Get("type"); eventType {
+	case "", "create", "update", "delete", "reprioritize":
+		query.EventType = eventType
+	default:
+		return query, fmt.Errorf("invalid type")
+	}
+
+	if from := params.Get("from"); from != "" {
+		if query.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return query, fmt.Errorf("invalid from")
+		}
+	}
+
+	if to := params.Get("to"); to != "" {
+		if query.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return query, fmt.Errorf("invalid to")
+		}
+	}
+
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return query, fmt.Errorf("from must be before to")
+	}
+
+	switch bucket := clickhouse.Bucket(params.Get("bucket")); bucket {
+	case "":
+	case clickhouse.BucketHour, clickhouse.BucketDay, clickhouse.BucketWeek:
+		query.Bucket = bucket
+	default:
+		return query, fmt.Errorf("invalid bucket")
+	}
+
+	maxRange := maxBuckets * bucketLength(query.Bucket)
+
+	switch {
+	case query.From.IsZero() && query.To.IsZero():
+		// the end of the current bucket, so that the query and thus
+		// its cached report stay the same during the bucket
+		query.To = query.Bucket.Next(query.Bucket.Truncate(time.Now()))
+		query.From = query.To.Add(-maxRange)
+	case query.To.IsZero():
+		query.To = query.From.Add(maxRange)
+	case query.From.IsZero():
+		query.From = query.To.Add(-maxRange)
+	case query.To.Sub(query.From) > maxRange:
+		return query, fmt.Errorf("time range spans more than %d buckets", maxBuckets)
+	}
+
+	switch groupBy := clickhouse.GroupBy(params.Get("groupBy")); groupBy {
+	case "":
+	case clickhouse.GroupByProject, clickhouse.GroupByEventType:
+		query.GroupBy = groupBy
+	default:
+		return query, fmt.Errorf("invalid groupBy")
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			return query, fmt.Errorf("invalid limit")
+		}
+	}
+
+	if maxLimit > 0 && query.Limit > maxLimit {
+		query.Limit = maxLimit
+	}
+
+	return query, nil
+}
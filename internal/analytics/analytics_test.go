@@ -0,0 +1,287 @@
+package analytics_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kldd0/goods-service/internal/analytics"
+	"github.com/kldd0/goods-service/internal/clients/clickhouse"
+	"github.com/kldd0/goods-service/internal/clients/redis"
+)
+
+type fakeCache struct {
+	mu      sync.Mutex
+	reports map[string][]byte
+	err     error
+}
+
+func (c *fakeCache) GetAnalytics(_ context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	report, ok := c.reports[key]
+	if !ok {
+		return nil, redis.ErrKeyNotFound
+	}
+
+	return report, nil
+}
+
+func (c *fakeCache) SetAnalytics(_ context.Context, key string, report []byte, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+
+	c.reports[key] = report
+
+	return nil
+}
+
+func at(day, hour int) time.Time {
+	return time.Date(2024, 1, day, hour, 30, 0, 0, time.UTC)
+}
+
+func source() *clickhouse.Fake {
+	return clickhouse.NewFake(
+		clickhouse.AuditEntry{GoodId: 1, ProjectId: 1, EventType: "create", Name: "a", EventTime: at(1, 10)},
+		clickhouse.AuditEntry{GoodId: 2, ProjectId: 1, EventType: "create", Name: "b", EventTime: at(1, 11)},
+		clickhouse.AuditEntry{GoodId: 1, ProjectId: 1, EventType: "update", Name: "a", EventTime: at(3, 9)},
+		clickhouse.AuditEntry{GoodId: 2, ProjectId: 1, EventType: "delete", Name: "b", Removed: true, EventTime: at(3, 12)},
+	)
+}
+
+func query(t *testing.T, params string) clickhouse.AnalyticsQuery {
+	t.Helper()
+
+	values, err := url.ParseQuery(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query, err := analytics.ParseQuery(values, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return query
+}
+
+func newService(source clickhouse.Analytics, cache analytics.Cache) *analytics.Service {
+	return analytics.New(slog.New(slog.NewTextHandler(io.Discard, nil)), source, cache, time.Minute)
+}
+
+func TestEventsFillGaps(t *testing.T) {
+	report, err := newService(source(), nil).Events(context.Background(), query(t, "bucket=day&from=2024-01-01T00:00:00Z&to=2024-01-04T00:00:00Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]uint64{
+		"create":       {2, 0, 0},
+		"delete":       {0, 0, 1},
+		"update":       {0, 0, 1},
+		"reprioritize": {0, 0, 0},
+	}
+
+	if len(report.Series) != len(want) {
+		t.Fatalf("got %d series, want %d", len(report.Series), len(want))
+	}
+
+	for _, series := range report.Series {
+		counts := want[series.Key]
+		if len(series.Points) != len(counts) {
+			t.Fatalf("got %d points of %s, want %d", len(series.Points), series.Key, len(counts))
+		}
+
+		for i, point := range series.Points {
+			if !point.Time.Equal(time.Date(2024, 1, 1+i, 0, 0, 0, 0, time.UTC)) || point.Count != counts[i] {
+				t.Errorf("got point %+v of %s, want %d", point, series.Key, counts[i])
+			}
+		}
+	}
+}
+
+func TestRemovals(t *testing.T) {
+	report, err := newService(source(), nil).Removals(context.Background(), query(t, "bucket=week&from=2024-01-01T00:00:00Z&to=2024-01-08T00:00:00Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first of January 2024 is a Monday, every change falls in one week
+	if len(report.Points) != 1 {
+		t.Fatalf("got %d points, want 1", len(report.Points))
+	}
+
+	point := report.Points[0]
+	if point.Created != 2 || point.Removed != 1 || point.Rate != 0.5 {
+		t.Errorf("got point %+v", point)
+	}
+}
+
+func TestEmptyBuckets(t *testing.T) {
+	// the changes fall on the 1st and the 3rd, the range starts before
+	// them and ends after them
+	q := query(t, "bucket=day&type=create&from=2023-12-30T12:00:00Z&to=2024-01-06T00:00:00Z")
+
+	events, err := newService(source(), nil).Events(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events.Series) != 1 || events.Series[0].Key != "create" {
+		t.Fatalf("got series %+v, want the create one", events.Series)
+	}
+
+	want := []uint64{0, 0, 2, 0, 0, 0, 0}
+	points := events.Series[0].Points
+	if len(points) != len(want) {
+		t.Fatalf("got %d points, want %d", len(points), len(want))
+	}
+	for i, point := range points {
+		if !point.Time.Equal(time.Date(2023, 12, 30+i, 0, 0, 0, 0, time.UTC)) || point.Count != want[i] {
+			t.Errorf("got point %+v, want %d", point, want[i])
+		}
+	}
+
+	// a range without changes is a series of zeros
+	q = query(t, "bucket=hour&from=2024-02-01T00:00:00Z&to=2024-02-01T03:00:00Z")
+
+	removals, err := newService(source(), nil).Removals(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(removals.Points) != 3 {
+		t.Fatalf("got %d points, want 3", len(removals.Points))
+	}
+	for _, point := range removals.Points {
+		if point.Created != 0 || point.Removed != 0 {
+			t.Errorf("got point %+v, want zeros", point)
+		}
+	}
+}
+
+// countingSource counts the aggregations run.
+type countingSource struct {
+	*clickhouse.Fake
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (s *countingSource) CountEvents(ctx context.Context, query clickhouse.AnalyticsQuery) ([]clickhouse.CountRow, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+
+	return s.Fake.CountEvents(ctx, query)
+}
+
+func TestCached(t *testing.T) {
+	cases := []struct {
+		name  string
+		cache *fakeCache
+		calls int
+	}{
+		{"cached", &fakeCache{reports: map[string][]byte{}}, 1},
+		{"cache unavailable", &fakeCache{err: errors.New("connection refused")}, 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := &countingSource{Fake: source()}
+			s := newService(src, tc.cache)
+
+			var reports []analytics.EventsReport
+			for i := 0; i < 2; i++ {
+				report, err := s.Events(context.Background(), query(t, "groupBy=project&from=2024-01-01T00:00:00Z&to=2024-01-04T00:00:00Z"))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				reports = append(reports, report)
+			}
+
+			if src.calls != tc.calls {
+				t.Errorf("got %d aggregations, want %d", src.calls, tc.calls)
+			}
+
+			if len(reports[1].Series) != 1 || reports[1].Series[0].Key != "1" || len(reports[1].Series[0].Points) != 3 {
+				t.Errorf("got report %+v", reports[1])
+			}
+
+			// another query isn't answered from the cache of the first one
+			if _, err := s.Events(context.Background(), query(t, "groupBy=event_type&from=2024-01-01T00:00:00Z")); err != nil {
+				t.Fatal(err)
+			}
+
+			if src.calls != tc.calls+1 {
+				t.Errorf("got %d aggregations, want %d", src.calls, tc.calls+1)
+			}
+		})
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	cases := []struct {
+		params string
+		fails  bool
+	}{
+		{"", false},
+		{"projectId=1&type=update&bucket=hour&groupBy=project&limit=5", false},
+		{"from=2024-01-01T00:00:00Z&to=2024-02-01T00:00:00Z", false},
+		{"projectId=0", true},
+		{"type=rename", true},
+		{"bucket=month", true},
+		{"groupBy=good", true},
+		{"limit=-1", true},
+		{"from=yesterday", true},
+		{"from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z", true},
+		{"bucket=hour&from=2024-01-01T00:00:00Z&to=2024-02-11T16:00:00Z", false},
+		{"bucket=hour&from=2024-01-01T00:00:00Z&to=2024-02-11T16:00:01Z", true},
+		{"bucket=week&from=2000-01-01T00:00:00Z&to=2019-01-01T00:00:00Z", false},
+	}
+
+	for _, tc := range cases {
+		values, _ := url.ParseQuery(tc.params)
+
+		_, err := analytics.ParseQuery(values, 100)
+		if (err != nil) != tc.fails {
+			t.Errorf("%q: got error %v, want failure %v", tc.params, err, tc.fails)
+		}
+	}
+
+	q := query(t, "limit=1000")
+	if q.Limit != 100 || q.Bucket != clickhouse.BucketDay || q.GroupBy != clickhouse.GroupByEventType {
+		t.Errorf("got query %+v", q)
+	}
+
+	// the missing bounds are set so that the range spans the most buckets
+	tomorrow := clickhouse.BucketDay.Next(clickhouse.BucketDay.Truncate(time.Now()))
+	if !q.To.Equal(tomorrow) || q.To.Sub(q.From) != 1000*24*time.Hour {
+		t.Errorf("got range from %s to %s, want the 1000 days until %s", q.From, q.To, tomorrow)
+	}
+
+	q = query(t, "bucket=hour&from=2024-01-01T00:00:00Z")
+	if want := time.Date(2024, 2, 11, 16, 0, 0, 0, time.UTC); !q.To.Equal(want) {
+		t.Errorf("got range to %s, want %s", q.To, want)
+	}
+
+	q = query(t, "bucket=hour&to=2024-02-11T16:00:00Z")
+	if want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC); !q.From.Equal(want) {
+		t.Errorf("got range from %s, want %s", q.From, want)
+	}
+}
@@ -0,0 +1,165 @@
+// Package changefeed is an in-process broker of the changes made to goods.
+// The handlers publish an event after every successful write and the
+// streaming APIs subscribe to the events of a project. The latest events
+// are kept in a bounded buffer, so that a client which lost its connection
+// can resume from the last event it has seen.
+package changefeed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kldd0/goods-service/internal/domain/models"
+)
+
+type EventType string
+
+const (
+	EventCreate       EventType = "create"
+	EventUpdate       EventType = "update"
+	EventDelete       EventType = "delete"
+	EventReprioritize EventType = "reprioritize"
+)
+
+// subscriberBuffer is the number of events a subscriber may lag behind
+// before it is disconnected
+const subscriberBuffer = 64
+
+type Event struct {
+	ID        uint64       `json:"id"`
+	Type      EventType    `json:"type"`
+	ProjectId int          `json:"project_id"`
+	GoodId    int          `json:"good_id"`
+	Good      *models.Good `json:"good,omitempty"`
+	// Actor is the authenticated subject that made the change, if any
+	Actor string    `json:"actor,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+type subscriber struct {
+	projectId int
+	ch        chan Event
+}
+
+type Hub struct {
+	mu     sync.Mutex
+	lastID uint64
+	subs   map[*subscriber]struct{}
+
+	// ring buffer of the latest events
+	history []Event
+	start   int
+	size    int
+}
+
+// NewHub creates a hub which keeps the last historySize events for resuming.
+func NewHub(historySize int) *Hub {
+	if historySize < 1 {
+		historySize = 1
+	}
+
+	return &Hub{
+		subs:    make(map[*subscriber]struct{}),
+		history: make([]Event, historySize),
+	}
+}
+
+// Publish assigns the event an id and a time and delivers it to the subscribers
+// of its project. Subscribers that can't keep up are disconnected, their
+// channel is closed.
+func (h *Hub) Publish(ev Event) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	ev.ID = h.lastID
+
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	h.remember(ev)
+
+	for sub := range h.subs {
+		if sub.projectId != 0 && sub.projectId != ev.ProjectId {
+			continue
+		}
+
+		select {
+		case sub.ch <- ev:
+		default:
+			delete(h.subs, sub)
+			close(sub.ch)
+		}
+	}
+
+	return ev
+}
+
+// Subscribe returns the events of the project, a zero projectId subscribes
+// to every project. The returned function cancels the subscription.
+func (h *Hub) Subscribe(projectId int) (<-chan Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.subscribe(projectId)
+}
+
+// SubscribeFrom subscribes to the events of the project like Subscribe and
+// also returns the buffered events of the project published after lastID.
+// ok is false when some of the events after lastID were already evicted from
+// the buffer, or were published by another process, and can't be replayed.
+func (h *Hub) SubscribeFrom(projectId int, lastID uint64) (missed []Event, events <-chan Event, cancel func(), ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ok = lastID <= h.lastID
+	if h.size > 0 && lastID+1 < h.history[h.start].ID {
+		ok = false
+	}
+
+	for i := 0; i < h.size; i++ {
+		ev := h.history[(h.start+i)%len(h.history)]
+
+		if ev.ID > lastID && (projectId == 0 || ev.ProjectId == projectId) {
+			missed = append(missed, ev)
+		}
+	}
+
+	events, cancel = h.subscribe(projectId)
+
+	return missed, events, cancel, ok
+}
+
+func (h *Hub) remember(ev Event) {
+	if h.size < len(h.history) {
+		h.history[(h.start+h.size)%len(h.history)] = ev
+		h.size++
+		return
+	}
+
+	// the buffer is full, overwrite the oldest event
+	h.history[h.start] = ev
+	h.start = (h.start + 1) % len(h.history)
+}
+
+func (h *Hub) subscribe(projectId int) (<-chan Event, func()) {
+	sub := &subscriber{
+		projectId: projectId,
+		ch:        make(chan Event, subscriberBuffer),
+	}
+
+	h.subs[sub] = struct{}{}
+
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if _, ok := h.subs[sub]; ok {
+			delete(h.subs, sub)
+			close(sub.ch)
+		}
+	}
+
+	return sub.ch, cancel
+}
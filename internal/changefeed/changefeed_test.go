@@ -0,0 +1,126 @@
+package changefeed_test
+
+import (
+	"testing"
+
+	"github.com/kldd0/goods-service/internal/changefeed"
+)
+
+func TestPublish(t *testing.T) {
+	hub := changefeed.NewHub(8)
+
+	project, cancelProject := hub.Subscribe(1)
+	defer cancelProject()
+	all, cancelAll := hub.Subscribe(0)
+	defer cancelAll()
+
+	other := hub.Publish(changefeed.Event{Type: changefeed.EventCreate, ProjectId: 2, GoodId: 1})
+	own := hub.Publish(changefeed.Event{Type: changefeed.EventUpdate, ProjectId: 1, GoodId: 2})
+
+	if other.ID != 1 || own.ID != 2 || own.Time.IsZero() {
+		t.Fatalf("got events %+v and %+v, want ids 1 and 2 with a time", other, own)
+	}
+
+	// the project subscriber only gets the events of its project
+	if ev := <-project; ev.ID != own.ID {
+		t.Errorf("got event %d for project 1, want %d", ev.ID, own.ID)
+	}
+	select {
+	case ev := <-project:
+		t.Errorf("got unexpected event %+v for project 1", ev)
+	default:
+	}
+
+	for _, want := range []uint64{other.ID, own.ID} {
+		if ev := <-all; ev.ID != want {
+			t.Errorf("got event %d for every project, want %d", ev.ID, want)
+		}
+	}
+}
+
+func TestSubscribeFrom(t *testing.T) {
+	cases := []struct {
+		name      string
+		projectId int
+		lastID    uint64
+		missed    []uint64
+		ok        bool
+	}{
+		{"up to date", 2, 6, nil, true},
+		{"resume", 0, 4, []uint64{5, 6}, true},
+		{"resume project", 2, 4, []uint64{6}, true},
+		{"oldest buffered", 2, 2, []uint64{4, 6}, true},
+		{"evicted", 2, 1, []uint64{4, 6}, false},
+		{"unknown id", 2, 10, nil, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hub := changefeed.NewHub(4)
+
+			// events 1..6 alternate between the projects 1 and 2, 3..6 stay buffered
+			for i := 1; i <= 6; i++ {
+				hub.Publish(changefeed.Event{Type: changefeed.EventCreate, ProjectId: 2 - i%2, GoodId: i})
+			}
+
+			missed, events, cancel, ok := hub.SubscribeFrom(tc.projectId, tc.lastID)
+			defer cancel()
+
+			if ok != tc.ok {
+				t.Errorf("got ok %v, want %v", ok, tc.ok)
+			}
+
+			if len(missed) != len(tc.missed) {
+				t.Fatalf("got missed events %+v, want ids %v", missed, tc.missed)
+			}
+			for i, ev := range missed {
+				if ev.ID != tc.missed[i] {
+					t.Errorf("got missed event %d, want %d", ev.ID, tc.missed[i])
+				}
+			}
+
+			// the subscription continues after the missed events
+			published := hub.Publish(changefeed.Event{Type: changefeed.EventDelete, ProjectId: 2})
+			if ev := <-events; ev.ID != published.ID {
+				t.Errorf("got event %d after the missed ones, want %d", ev.ID, published.ID)
+			}
+		})
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	hub := changefeed.NewHub(1)
+
+	events, cancel := hub.Subscribe(1)
+	defer cancel()
+
+	// the subscriber never reads, it is dropped once its buffer is full
+	received := 0
+	for i := 0; i < 1000; i++ {
+		hub.Publish(changefeed.Event{Type: changefeed.EventCreate, ProjectId: 1})
+	}
+
+	for range events {
+		received++
+	}
+
+	if received == 0 || received >= 1000 {
+		t.Errorf("got %d events before the channel was closed, want the buffered ones", received)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	hub := changefeed.NewHub(1)
+
+	events, cancel := hub.Subscribe(1)
+	cancel()
+	// a second cancel is a no-op
+	cancel()
+
+	if _, ok := <-events; ok {
+		t.Fatal("got an event after cancelling")
+	}
+
+	// publishing to the cancelled subscription doesn't panic
+	hub.Publish(changefeed.Event{Type: changefeed.EventCreate, ProjectId: 1})
+}
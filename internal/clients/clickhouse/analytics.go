@@ -0,0 +1,191 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Bucket is the time interval the changes are counted over.
+type Bucket string
+
+const (
+	BucketHour Bucket = "hour"
+	BucketDay  Bucket = "day"
+	BucketWeek Bucket = "week"
+)
+
+// Truncate returns the start of the bucket of t, weeks start on Monday.
+func (b Bucket) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+
+	switch b {
+	case BucketHour:
+		return t.Truncate(time.Hour)
+	case BucketWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// Next returns the start of the bucket following the one starting at t.
+func (b Bucket) Next(t time.Time) time.Time {
+	switch b {
+	case BucketHour:
+		return t.Add(time.Hour)
+	case BucketWeek:
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// expr is the bucket of the event time in ClickHouse
+func (b Bucket) expr() string {
+	switch b {
+	case BucketHour:
+		return "toStartOfHour(event_time)"
+	case BucketWeek:
+		return "toDateTime(toStartOfWeek(event_time, 1))"
+	default:
+		return "toDateTime(toStartOfDay(event_time))"
+	}
+}
+
+// GroupBy is the dimension the counts are split by.
+type GroupBy string
+
+const (
+	GroupByProject   GroupBy = "project"
+	GroupByEventType GroupBy = "event_type"
+)
+
+func (g GroupBy) expr() string {
+	if g == GroupByProject {
+		return "toString(project_id)"
+	}
+
+	return "event_type"
+}
+
+// Key returns the group of the entry.
+func (g GroupBy) Key(entry AuditEntry) string {
+	if g == GroupByProject {
+		return fmt.Sprint(entry.ProjectId)
+	}
+
+	return entry.EventType
+}
+
+// AnalyticsQuery is an aggregation over the changes matched by the filter,
+// the limit of the filter caps the number of goods returned by MostEdited.
+type AnalyticsQuery struct {
+	AuditFilter
+
+	Bucket  Bucket
+	GroupBy GroupBy
+}
+
+// CountRow is the number of changes of a group in a bucket.
+type CountRow struct {
+	Bucket time.Time `ch:"bucket"`
+	Key    string    `ch:"key"`
+	Count  uint64    `ch:"count"`
+}
+
+// RemovalRow is the number of goods created and removed in a bucket.
+type RemovalRow struct {
+	Bucket  time.Time `ch:"bucket"`
+	Created uint64    `ch:"created"`
+	Removed uint64    `ch:"removed"`
+}
+
+// EditedGood is a good and the number of times it was updated or reprioritized.
+type EditedGood struct {
+	ProjectId    uint64    `ch:"project_id" json:"project_id"`
+	GoodId       uint64    `ch:"id" json:"good_id"`
+	Name         string    `ch:"name" json:"name"`
+	Edits        uint64    `ch:"edits" json:"edits"`
+	LastEditedAt time.Time `ch:"last_edited_at" json:"last_edited_at"`
+}
+
+// Analytics aggregates the logged changes.
+type Analytics interface {
+	// CountEvents counts the changes per bucket and group, ordered by bucket and group
+	CountEvents(ctx context.Context, query AnalyticsQuery) ([]CountRow, error)
+	// CountRemovals counts the created and the removed goods per bucket, ordered by bucket
+	CountRemovals(ctx context.Context, query AnalyticsQuery) ([]RemovalRow, error)
+	// MostEdited returns the goods edited the most, the most edited first
+	MostEdited(ctx context.Context, query AnalyticsQuery) ([]EditedGood, error)
+}
+
+func (c *Client) CountEvents(ctx context.Context, query AnalyticsQuery) ([]CountRow, error) {
+	const op = "clients.clickhouse.CountEvents"
+
+	where, args := whereClause(query.AuditFilter)
+
+	q := "SELECT " + query.Bucket.expr() + " AS bucket, " + query.GroupBy.expr() + " AS key, count() AS count FROM " +
+		c.table + where + " GROUP BY bucket, key ORDER BY bucket, key"
+
+	var rows []CountRow
+	if err := c.selectRows(ctx, &rows, q, args...); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rows, nil
+}
+
+func (c *Client) CountRemovals(ctx context.Context, query AnalyticsQuery) ([]RemovalRow, error) {
+	const op = "clients.clickhouse.CountRemovals"
+
+	where, args := whereClause(query.AuditFilter)
+
+	q := "SELECT " + query.Bucket.expr() + " AS bucket, countIf(event_type = 'create') AS created, " +
+		"countIf(event_type = 'delete') AS removed FROM " + c.table + where + " GROUP BY bucket ORDER BY bucket"
+
+	var rows []RemovalRow
+	if err := c.selectRows(ctx, &rows, q, args...); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rows, nil
+}
+
+func (c *Client) MostEdited(ctx context.Context, query AnalyticsQuery) ([]EditedGood, error) {
+	const op = "clients.clickhouse.MostEdited"
+
+	where, args := whereClause(query.AuditFilter)
+
+	edited := "event_type IN ('update', 'reprioritize')"
+	if where == "" {
+		where = " WHERE " + edited
+	} else {
+		where += " AND " + edited
+	}
+
+	q := "SELECT project_id, id, argMax(name, event_time) AS name, count() AS edits, max(event_time) AS last_edited_at FROM " +
+		c.table + where + " GROUP BY project_id, id ORDER BY edits DESC, last_edited_at DESC LIMIT ?"
+
+	var rows []EditedGood
+	if err := c.selectRows(ctx, &rows, q, append(args, query.Limit)...); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rows, nil
+}
+
+func (c *Client) selectRows(ctx context.Context, dest any, q string, args ...any) error {
+	if c.queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.queryTimeout)
+		defer cancel()
+	}
+
+	if err := c.conn.Select(ctx, dest, q, args...); err != nil {
+		return fmt.Errorf("execute query: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditEntry is a change of a good logged to ClickHouse.
+type AuditEntry struct {
+	GoodId      uint64    `ch:"id" json:"good_id"`
+	ProjectId   uint64    `ch:"project_id" json:"project_id"`
+	EventType   string    `ch:"event_type" json:"event_type"`
+	Actor       string    `ch:"actor" json:"actor"`
+	Name        string    `ch:"name" json:"name"`
+	Description *string   `ch:"description" json:"description"`
+	Priority    *int32    `ch:"priority" json:"priority"`
+	Removed     bool      `ch:"removed" json:"removed"`
+	EventTime   time.Time `ch:"event_time" json:"event_time"`
+}
+
+// AuditFilter selects the logged changes, the zero fields match every change.
+type AuditFilter struct {
+	ProjectId int
+	GoodId    int
+	EventType string
+	// From and To bound the event time, From is inclusive and To exclusive
+	From time.Time
+	To   time.Time
+
+	Offset int
+	Limit  int
+}
+
+// Matches reports whether the entry is selected by the filter.
+func (f AuditFilter) Matches(entry AuditEntry) bool {
+	return (f.ProjectId == 0 || entry.ProjectId == uint64(f.ProjectId)) &&
+		(f.GoodId == 0 || entry.GoodId == uint64(f.GoodId)) &&
+		(f.EventType == "" || entry.EventType == f.EventType) &&
+		(f.From.IsZero() || !entry.EventTime.Before(f.From)) &&
+		(f.To.IsZero() || entry.EventTime.Before(f.To))
+}
+
+// AuditLog is the read side of the log of changes.
+type AuditLog interface {
+	// QueryAudit returns a page of the changes selected by the filter, the latest first
+	QueryAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+}
+
+func (c *Client) QueryAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	const op = "clients.clickhouse.QueryAudit"
+
+	q, args := auditQuery(c.table, filter)
+
+	var entries []AuditEntry
+	if err := c.selectRows(ctx, &entries, q, args...); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, nil
+}
+
+// auditQuery builds the query of the filter, the values are bound as parameters.
+func auditQuery(table string, filter AuditFilter) (string, []any) {
+	where, args := whereClause(filter)
+
+	q := "SELECT id, project_id, event_type, actor, name, description, priority, removed, event_time FROM " +
+		table + where + " ORDER BY event_time DESC, id DESC LIMIT ? OFFSET ?"
+
+	return q, append(args, filter.Limit, filter.Offset)
+}
+
+// whereClause selects the rows matched by the filter, it is empty
+// when the filter matches every row.
+func whereClause(filter AuditFilter) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+
+	if filter.ProjectId != 0 {
+		conds = append(conds, "project_id = ?")
+		args = append(args, uint64(filter.ProjectId))
+	}
+
+	if filter.GoodId != 0 {
+		conds = append(conds, "id = ?")
+		args = append(args, uint64(filter.GoodId))
+	}
+
+	if filter.EventType != "" {
+		conds = append(conds, "event_type = ?")
+		args = append(args, filter.EventType)
+	}
+
+	if !filter.From.IsZero() {
+		conds = append(conds, "event_time >= ?")
+		args = append(args, filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		conds = append(conds, "event_time < ?")
+		args = append(args, filter.To)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
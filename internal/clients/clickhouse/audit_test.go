@@ -0,0 +1,59 @@
+package clickhouse_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kldd0/goods-service/internal/clients/clickhouse"
+)
+
+func TestFakeQueryAudit(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	audit := clickhouse.NewFake(
+		clickhouse.AuditEntry{GoodId: 1, ProjectId: 1, EventType: "create", EventTime: start},
+		clickhouse.AuditEntry{GoodId: 1, ProjectId: 1, EventType: "update", EventTime: start.Add(time.Hour)},
+		clickhouse.AuditEntry{GoodId: 2, ProjectId: 1, EventType: "create", EventTime: start.Add(2 * time.Hour)},
+		clickhouse.AuditEntry{GoodId: 3, ProjectId: 2, EventType: "delete", EventTime: start.Add(3 * time.Hour)},
+	)
+
+	cases := []struct {
+		name   string
+		filter clickhouse.AuditFilter
+		// goods of the entries returned, in order
+		goods []uint64
+	}{
+		{"all", clickhouse.AuditFilter{Limit: 10}, []uint64{3, 2, 1, 1}},
+		{"page", clickhouse.AuditFilter{Offset: 1, Limit: 2}, []uint64{2, 1}},
+		{"project", clickhouse.AuditFilter{ProjectId: 1, Limit: 10}, []uint64{2, 1, 1}},
+		{"good", clickhouse.AuditFilter{ProjectId: 1, GoodId: 1, Limit: 10}, []uint64{1, 1}},
+		{"event type", clickhouse.AuditFilter{EventType: "create", Limit: 10}, []uint64{2, 1}},
+		{"time range", clickhouse.AuditFilter{From: start.Add(time.Hour), To: start.Add(3 * time.Hour), Limit: 10}, []uint64{2, 1}},
+		{"offset past the end", clickhouse.AuditFilter{Offset: 10, Limit: 10}, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := audit.QueryAudit(context.Background(), tc.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var goods []uint64
+			for _, entry := range entries {
+				goods = append(goods, entry.GoodId)
+			}
+
+			if len(goods) != len(tc.goods) {
+				t.Fatalf("got goods %v, want %v", goods, tc.goods)
+			}
+
+			for i := range goods {
+				if goods[i] != tc.goods[i] {
+					t.Fatalf("got goods %v, want %v", goods, tc.goods)
+				}
+			}
+		})
+	}
+}
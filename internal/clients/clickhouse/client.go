@@ -0,0 +1,57 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/kldd0/goods-service/internal/config"
+)
+
+// identifier matches the table names that are safe to put in a query unquoted
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+type Client struct {
+	conn         driver.Conn
+	table        string
+	queryTimeout time.Duration
+}
+
+func New(ctx context.Context, cfg config.ClickHouse) (*Client, error) {
+	const op = "clients.clickhouse.New"
+
+	if !identifier.MatchString(cfg.Table) {
+		return nil, fmt.Errorf("%s: invalid table name %q", op, cfg.Table)
+	}
+
+	conn, err := clickhouse.Open(&clickhouse.Options{
+		Addr: []string{cfg.Addr},
+		Auth: clickhouse.Auth{
+			Database: cfg.Database,
+			Username: cfg.Username,
+			Password: cfg.Password,
+		},
+		DialTimeout: cfg.DialTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: open connection: %w", op, err)
+	}
+
+	if err := conn.Ping(ctx); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%s: ping failed: %w", op, err)
+	}
+
+	return &Client{
+		conn:         conn,
+		table:        cfg.Table,
+		queryTimeout: cfg.QueryTimeout,
+	}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
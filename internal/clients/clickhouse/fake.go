@@ -0,0 +1,157 @@
+package clickhouse
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is an AuditLog and Analytics keeping the entries in memory, for tests.
+type Fake struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func NewFake(entries ...AuditEntry) *Fake {
+	return &Fake{entries: entries}
+}
+
+func (f *Fake) Add(entries ...AuditEntry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.entries = append(f.entries, entries...)
+}
+
+func (f *Fake) QueryAudit(_ context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	entries := f.matching(filter)
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].EventTime.Equal(entries[j].EventTime) {
+			return entries[i].EventTime.After(entries[j].EventTime)
+		}
+		return entries[i].GoodId > entries[j].GoodId
+	})
+
+	if filter.Offset > len(entries) {
+		filter.Offset = len(entries)
+	}
+	entries = entries[filter.Offset:]
+
+	if filter.Limit < len(entries) {
+		entries = entries[:filter.Limit]
+	}
+
+	return entries, nil
+}
+
+func (f *Fake) CountEvents(_ context.Context, query AnalyticsQuery) ([]CountRow, error) {
+	counts := map[CountRow]uint64{}
+	for _, entry := range f.matching(query.AuditFilter) {
+		counts[CountRow{Bucket: query.Bucket.Truncate(entry.EventTime), Key: query.GroupBy.Key(entry)}]++
+	}
+
+	rows := make([]CountRow, 0, len(counts))
+	for row, count := range counts {
+		row.Count = count
+		rows = append(rows, row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].Bucket.Equal(rows[j].Bucket) {
+			return rows[i].Bucket.Before(rows[j].Bucket)
+		}
+		return rows[i].Key < rows[j].Key
+	})
+
+	return rows, nil
+}
+
+func (f *Fake) CountRemovals(_ context.Context, query AnalyticsQuery) ([]RemovalRow, error) {
+	buckets := map[time.Time]*RemovalRow{}
+	for _, entry := range f.matching(query.AuditFilter) {
+		bucket := query.Bucket.Truncate(entry.EventTime)
+
+		row, ok := buckets[bucket]
+		if !ok {
+			row = &RemovalRow{Bucket: bucket}
+			buckets[bucket] = row
+		}
+
+		switch entry.EventType {
+		case "create":
+			row.Created++
+		case "delete":
+			row.Removed++
+		}
+	}
+
+	rows := make([]RemovalRow, 0, len(buckets))
+	for _, row := range buckets {
+		rows = append(rows, *row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Bucket.Before(rows[j].Bucket)
+	})
+
+	return rows, nil
+}
+
+func (f *Fake) MostEdited(_ context.Context, query AnalyticsQuery) ([]EditedGood, error) {
+	type good struct{ projectId, id uint64 }
+
+	edited := map[good]*EditedGood{}
+	for _, entry := range f.matching(query.AuditFilter) {
+		if entry.EventType != "update" && entry.EventType != "reprioritize" {
+			continue
+		}
+
+		key := good{entry.ProjectId, entry.GoodId}
+
+		e, ok := edited[key]
+		if !ok {
+			e = &EditedGood{ProjectId: entry.ProjectId, GoodId: entry.GoodId}
+			edited[key] = e
+		}
+
+		e.Edits++
+		if !entry.EventTime.Before(e.LastEditedAt) {
+			e.Name = entry.Name
+			e.LastEditedAt = entry.EventTime
+		}
+	}
+
+	goods := make([]EditedGood, 0, len(edited))
+	for _, e := range edited {
+		goods = append(goods, *e)
+	}
+
+	sort.Slice(goods, func(i, j int) bool {
+		if goods[i].Edits != goods[j].Edits {
+			return goods[i].Edits > goods[j].Edits
+		}
+		return goods[i].LastEditedAt.After(goods[j].LastEditedAt)
+	})
+
+	if query.Limit < len(goods) {
+		goods = goods[:query.Limit]
+	}
+
+	return goods, nil
+}
+
+func (f *Fake) matching(filter AuditFilter) []AuditEntry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var entries []AuditEntry
+	for _, entry := range f.entries {
+		if filter.Matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
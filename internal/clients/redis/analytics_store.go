@@ -0,0 +1,43 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+func (c *Client) GetAnalytics(ctx context.Context, key string) ([]byte, error) {
+	const op = "redis.GetAnalytics"
+
+	data, err := c.rdb.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrKeyNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: get value error: %w", op, err)
+	}
+
+	return data, nil
+}
+
+func (c *Client) SetAnalytics(ctx context.Context, key string, report []byte, ttl time.Duration) error {
+	const op = "redis.SetAnalytics"
+
+	if err := c.rdb.Set(ctx, key, report, ttl).Err(); err != nil {
+		return fmt.Errorf("%s: set value error: %w", op, err)
+	}
+
+	return nil
+}
+
+// AnalyticsKey returns the cache key of the report of the kind for the query.
+func AnalyticsKey(kind, query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return fmt.Sprintf("analytics:%s:%s", kind, hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,40 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+func (c *Client) GetCommandResult(ctx context.Context, key string) ([]byte, error) {
+	const op = "redis.GetCommandResult"
+
+	data, err := c.rdb.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrKeyNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: get value error: %w", op, err)
+	}
+
+	return data, nil
+}
+
+func (c *Client) SaveCommandResult(ctx context.Context, key string, result []byte, ttl time.Duration) error {
+	const op = "redis.SaveCommandResult"
+
+	if err := c.rdb.Set(ctx, key, result, ttl).Err(); err != nil {
+		return fmt.Errorf("%s: set value error: %w", op, err)
+	}
+
+	return nil
+}
+
+// CommandKey returns the key of the result of the command with the correlation id.
+func CommandKey(correlationID string) string {
+	return "command:" + correlationID
+}
@@ -47,3 +47,8 @@ func (c *Client) SetGood(ctx context.Context, key string, value models.Good) err
 
 	return nil
 }
+
+// GoodKey returns the cache key of the good.
+func GoodKey(goodId, projectId string) string {
+	return fmt.Sprintf("%s$%s", goodId, projectId)
+}
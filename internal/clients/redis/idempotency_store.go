@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// ReserveIdempotencyKey stores the record under key unless the key
+// already exists and reports whether it was stored.
+func (c *Client) ReserveIdempotencyKey(ctx context.Context, key string, record []byte, ttl time.Duration) (bool, error) {
+	const op = "redis.ReserveIdempotencyKey"
+
+	ok, err := c.rdb.SetNX(ctx, key, record, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("%s: set value error: %w", op, err)
+	}
+
+	return ok, nil
+}
+
+func (c *Client) GetIdempotencyRecord(ctx context.Context, key string) ([]byte, error) {
+	const op = "redis.GetIdempotencyRecord"
+
+	data, err := c.rdb.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrKeyNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: get value error: %w", op, err)
+	}
+
+	return data, nil
+}
+
+func (c *Client) SaveIdempotencyRecord(ctx context.Context, key string, record []byte, ttl time.Duration) error {
+	const op = "redis.SaveIdempotencyRecord"
+
+	if err := c.rdb.Set(ctx, key, record, ttl).Err(); err != nil {
+		return fmt.Errorf("%s: set value error: %w", op, err)
+	}
+
+	return nil
+}
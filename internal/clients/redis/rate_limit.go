@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeTokenScript takes a token from a token bucket stored in a hash.
+// The clock of redis is used so that every replica of the service
+// refills the buckets the same way.
+var takeTokenScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+
+return {allowed, tostring(tokens)}
+`)
+
+// TakeToken takes a token from the bucket stored at key, which holds up to
+// burst tokens and is refilled with rate tokens per second. It returns
+// whether a token was available and the number of tokens left.
+func (c *Client) TakeToken(ctx context.Context, key string, rate float64, burst int) (bool, float64, error) {
+	const op = "redis.TakeToken"
+
+	res, err := takeTokenScript.Run(ctx, c.rdb, []string{key}, rate, burst).Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("%s: run script: %w", op, err)
+	}
+
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("%s: unexpected script result %v", op, res)
+	}
+
+	allowed, _ := res[0].(int64)
+	tokensStr, _ := res[1].(string)
+
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("%s: parse tokens: %w", op, err)
+	}
+
+	return allowed == 1, tokens, nil
+}
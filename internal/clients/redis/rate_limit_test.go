@@ -0,0 +1,69 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/kldd0/goods-service/internal/clients/redis"
+)
+
+type config struct {
+	uri string
+}
+
+func (c config) RedisUri() string  { return c.uri }
+func (c config) RedisPass() string { return "" }
+
+func TestTakeToken(t *testing.T) {
+	ctx := context.Background()
+
+	m := miniredis.RunT(t)
+	now := time.Now()
+	m.SetTime(now)
+
+	client, err := redis.New(ctx, config{uri: m.Addr()})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	// the steps share the bucket of 3 tokens refilled with 2 tokens per second
+	steps := []struct {
+		name    string
+		elapsed time.Duration
+		allowed bool
+		tokens  float64
+	}{
+		{"full bucket", 0, true, 2},
+		{"burst", 0, true, 1},
+		{"last token", 0, true, 0},
+		{"empty bucket", 0, false, 0},
+		{"partial refill", 250 * time.Millisecond, false, 0.5},
+		{"refilled token", 250 * time.Millisecond, true, 0},
+		{"refill capped at burst", time.Hour, true, 2},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.elapsed)
+		m.SetTime(now)
+
+		allowed, tokens, err := client.TakeToken(ctx, "bucket", 2, 3)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		if allowed != step.allowed || tokens != step.tokens {
+			t.Errorf("%s: got allowed %v with %v tokens, want %v with %v", step.name, allowed, tokens, step.allowed, step.tokens)
+		}
+	}
+
+	// the bucket expires once it would be full again
+	if ttl := m.TTL("bucket"); ttl <= 0 || ttl > 2500*time.Millisecond {
+		t.Errorf("got bucket ttl %s, want the refill time and a second", ttl)
+	}
+
+	if allowed, tokens, _ := client.TakeToken(ctx, "other", 2, 3); !allowed || tokens != 2 {
+		t.Errorf("got allowed %v with %v tokens for another key, want a full bucket", allowed, tokens)
+	}
+}
@@ -9,12 +9,42 @@ import (
 )
 
 type Config struct {
-	Env      string `yaml:"env" env-default:"local"`
-	DBUri    string `yaml:"db_uri" env-default:""`
-	NATSAddr string `yaml:"nats_addr" env-default:"4222"`
+	Env         string `yaml:"env" env-default:"local"`
+	DBUri       string `yaml:"db_uri" env-default:""`
+	NATSAddr    string `yaml:"nats_addr" env-default:"4222"`
+	AutoMigrate bool   `yaml:"auto_migrate" env-default:"false"`
+
+	Postgres    `yaml:"postgres"`
+	Redis       `yaml:"redis"`
+	JetStream   `yaml:"jetstream"`
+	HTTPServer  `yaml:"http_server"`
+	GRPCServer  `yaml:"grpc_server"`
+	Watch       `yaml:"watch"`
+	Auth        `yaml:"auth"`
+	RateLimit   `yaml:"rate_limit"`
+	Idempotency `yaml:"idempotency"`
+	Events      `yaml:"events"`
+	Webhooks    `yaml:"webhooks"`
+	ClickHouse  `yaml:"clickhouse"`
+	Analytics   `yaml:"analytics"`
+}
 
-	Redis      `yaml:"redis"`
-	HTTPServer `yaml:"http_server"`
+type Postgres struct {
+	MaxConns          int32         `yaml:"max_conns" env-default:"10"`
+	MinConns          int32         `yaml:"min_conns" env-default:"0"`
+	MaxConnLifetime   time.Duration `yaml:"max_conn_lifetime" env-default:"1h"`
+	MaxConnIdleTime   time.Duration `yaml:"max_conn_idle_time" env-default:"30m"`
+	HealthCheckPeriod time.Duration `yaml:"health_check_period" env-default:"1m"`
+	// StatementTimeout is zero to disable it
+	StatementTimeout       time.Duration `yaml:"statement_timeout" env-default:"5s"`
+	StatementCacheCapacity int           `yaml:"statement_cache_capacity" env-default:"512"`
+	// TxIsolation is read committed, repeatable read or serializable
+	TxIsolation        string        `yaml:"tx_isolation" env-default:"read committed"`
+	TxMaxRetries       int           `yaml:"tx_max_retries" env-default:"3"`
+	Replicas           []string      `yaml:"replicas"`
+	ReplicaCheckPeriod time.Duration `yaml:"replica_check_period" env-default:"5s"`
+	// ReadYourWrites is zero to disable it
+	ReadYourWrites time.Duration `yaml:"read_your_writes" env-default:"5s"`
 }
 
 type Redis struct {
@@ -22,10 +52,127 @@ type Redis struct {
 	Password string `yaml:"pass"`
 }
 
+type JetStream struct {
+	Enabled           bool   `yaml:"enabled" env-default:"false"`
+	Stream            string `yaml:"stream" env-default:"GOODS"`
+	CommandsSubject   string `yaml:"commands_subject" env-default:"goods.commands"`
+	ResultsSubject    string `yaml:"results_subject" env-default:"goods.results"`
+	DeadLetterSubject string `yaml:"dead_letter_subject" env-default:"goods.commands.dlq"`
+	// Retention only supports limits
+	Retention       string        `yaml:"retention" env-default:"limits"`
+	Storage         string        `yaml:"storage" env-default:"file"`
+	MaxAge          time.Duration `yaml:"max_age" env-default:"168h"`
+	MaxMsgs         int64         `yaml:"max_msgs" env-default:"-1"`
+	MaxBytes        int64         `yaml:"max_bytes" env-default:"-1"`
+	DuplicateWindow time.Duration `yaml:"duplicate_window" env-default:"2m"`
+	Durable         string        `yaml:"durable" env-default:"goods-service"`
+	AckWait         time.Duration `yaml:"ack_wait" env-default:"60s"`
+	MaxAckPending   int           `yaml:"max_ack_pending" env-default:"25"`
+	RetryDelay      time.Duration `yaml:"retry_delay" env-default:"5s"`
+	MaxAttempts     int           `yaml:"max_attempts" env-default:"5"`
+}
+
 type HTTPServer struct {
-	Address     string        `yaml:"address" env-default:"localhost:8080"`
-	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
-	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	Address      string        `yaml:"address" env-default:"localhost:8080"`
+	Timeout      time.Duration `yaml:"timeout" env-default:"4s"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	SwaggerUI    bool          `yaml:"swagger_ui" env-default:"false"`
+	MaxPageLimit int           `yaml:"max_page_limit" env-default:"100"`
+	ClientIds    bool          `yaml:"client_ids" env-default:"false"`
+}
+
+type GRPCServer struct {
+	Address string `yaml:"address" env-default:"localhost:9090"`
+}
+
+type Watch struct {
+	HistorySize int           `yaml:"history_size" env-default:"1024"`
+	Heartbeat   time.Duration `yaml:"heartbeat" env-default:"15s"`
+}
+
+type Auth struct {
+	Enabled bool     `yaml:"enabled" env-default:"false"`
+	APIKeys []APIKey `yaml:"api_keys"`
+	JWT     JWT      `yaml:"jwt"`
+}
+
+type APIKey struct {
+	Key         string   `yaml:"key"`
+	Subject     string   `yaml:"subject"`
+	Projects    []int    `yaml:"projects"`
+	AllProjects bool     `yaml:"all_projects"`
+	Scopes      []string `yaml:"scopes"`
+}
+
+type JWT struct {
+	HS256Secret string `yaml:"hs256_secret" env:"JWT_HS256_SECRET"`
+	JWKSFile    string `yaml:"jwks_file"`
+	Issuer      string `yaml:"issuer"`
+	Audience    string `yaml:"audience"`
+}
+
+type RateLimit struct {
+	Enabled bool `yaml:"enabled" env-default:"false"`
+	// Groups are keyed by read, write and list
+	Groups map[string]Limit `yaml:"groups"`
+}
+
+type Limit struct {
+	// Rate is in tokens per second
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+type Idempotency struct {
+	TTL         time.Duration `yaml:"ttl" env-default:"24h"`
+	LockTTL     time.Duration `yaml:"lock_ttl" env-default:"30s"`
+	WaitTimeout time.Duration `yaml:"wait_timeout" env-default:"10s"`
+}
+
+type Events struct {
+	Sinks []Sink `yaml:"sinks"`
+}
+
+// Sink defaults are set by the events package.
+type Sink struct {
+	// Type is nats, file or webhook
+	Type    string        `yaml:"type"`
+	Subject string        `yaml:"subject"`
+	Path    string        `yaml:"path"`
+	URL     string        `yaml:"url"`
+	Secret  string        `yaml:"secret"`
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxRetries is negative for none
+	MaxRetries int           `yaml:"max_retries"`
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+type Webhooks struct {
+	Workers               int           `yaml:"workers" env-default:"4"`
+	QueueSize             int           `yaml:"queue_size" env-default:"1024"`
+	Timeout               time.Duration `yaml:"timeout" env-default:"5s"`
+	MaxAttempts           int           `yaml:"max_attempts" env-default:"5"`
+	Backoff               time.Duration `yaml:"backoff" env-default:"1s"`
+	MaxBackoff            time.Duration `yaml:"max_backoff" env-default:"5m"`
+	DisableAfter          int           `yaml:"disable_after" env-default:"10"`
+	AllowPrivateAddresses bool          `yaml:"allow_private_addresses" env-default:"false"`
+}
+
+type ClickHouse struct {
+	// Addr is empty to disable the audit and analytics apis
+	Addr         string        `yaml:"addr" env-default:""`
+	Database     string        `yaml:"database" env-default:"default"`
+	Username     string        `yaml:"username" env-default:"default"`
+	Password     string        `yaml:"password" env-default:""`
+	Table        string        `yaml:"table" env-default:"goods_log"`
+	DialTimeout  time.Duration `yaml:"dial_timeout" env-default:"5s"`
+	QueryTimeout time.Duration `yaml:"query_timeout" env-default:"10s"`
+}
+
+type Analytics struct {
+	// CacheTTL is zero to disable the cache
+	CacheTTL time.Duration `yaml:"cache_ttl" env-default:"1m"`
 }
 
 func MustLoad() *Config {
@@ -0,0 +1,150 @@
+// Package deadletter keeps the commands that couldn't be applied,
+// so that they can be inspected and replayed once the cause is fixed.
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"log/slog"
+
+	"github.com/kldd0/goods-service/internal/logger"
+)
+
+var ErrNotFound = errors.New("dead letter not found")
+
+// Message is a command moved to the dead-letter subject.
+type Message struct {
+	// Subject and Sequence locate the command in the stream
+	Subject  string `json:"subject"`
+	Sequence uint64 `json:"sequence"`
+	// Attempts is the number of times the command was delivered
+	Attempts int       `json:"attempts"`
+	Reason   string    `json:"reason"`
+	Data     []byte    `json:"data"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// Entry is a dead letter identified by its sequence in the stream.
+type Entry struct {
+	ID uint64 `json:"id"`
+	Message
+}
+
+// ReplayFunc sends the data of a dead letter back to the commands subject
+// and removes the dead letter from the stream. It is called without holding
+// the queue, and should publish with a message id derived from the id of
+// the dead letter so that the replays of several replicas are deduplicated.
+type ReplayFunc func(id uint64, data []byte) error
+
+// Queue holds the dead letters read from the dead-letter subject.
+// It lives in memory and is rebuilt from the stream on start.
+type Queue struct {
+	mu      sync.Mutex
+	entries map[uint64]Entry
+	replay  ReplayFunc
+}
+
+func NewQueue(replay ReplayFunc) *Queue {
+	return &Queue{
+		entries: make(map[uint64]Entry),
+		replay:  replay,
+	}
+}
+
+func (q *Queue) Add(id uint64, msg Message) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.entries[id] = Entry{ID: id, Message: msg}
+}
+
+// Consume is the handler of the dead-letter subscription.
+func (q *Queue) Consume(log *slog.Logger) func(sequence uint64, data []byte) {
+	return func(sequence uint64, data []byte) {
+		const op = "deadletter.Consume"
+
+		var m Message
+		if err := json.Unmarshal(data, &m); err != nil {
+			log.Error("failed unmarshalling dead letter",
+				slog.String("op", op),
+				slog.Uint64("sequence", sequence),
+				logger.Err(err),
+			)
+			return
+		}
+
+		q.Add(sequence, m)
+	}
+}
+
+// List returns a page of the dead letters, oldest first, and their total number.
+func (q *Queue) List(offset, limit int) ([]Entry, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries := make([]Entry, 0, len(q.entries))
+	for _, entry := range q.entries {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+
+	total := len(entries)
+
+	if offset > total {
+		offset = total
+	}
+	entries = entries[offset:]
+
+	if limit < len(entries) {
+		entries = entries[:limit]
+	}
+
+	return entries, total
+}
+
+func (q *Queue) Get(id uint64) (Entry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.entries[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+
+	return entry, nil
+}
+
+// Replay sends the dead letter back to the commands subject and forgets it.
+// The dead letter is taken out of the queue while it is sent, so a concurrent
+// replay of it gets ErrNotFound, and it is put back if sending fails.
+//
+// The queue only knows the replays of its own replica: the other replicas
+// keep listing the dead letter until they restart. Replaying it there again
+// is deduplicated by the stream, see ReplayFunc.
+func (q *Queue) Replay(id uint64) (Entry, error) {
+	const op = "deadletter.Replay"
+
+	q.mu.Lock()
+	entry, ok := q.entries[id]
+	delete(q.entries, id)
+	q.mu.Unlock()
+
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+
+	if err := q.replay(id, entry.Data); err != nil {
+		q.Add(id, entry.Message)
+		return Entry{}, fmt.Errorf("%s: replaying message: %w", op, err)
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,58 @@
+package deadletter_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kldd0/goods-service/internal/deadletter"
+)
+
+func TestReplay(t *testing.T) {
+	var q *deadletter.Queue
+
+	fail := true
+	q = deadletter.NewQueue(func(id uint64, data []byte) error {
+		// the queue isn't held while the dead letter is sent,
+		// and the dead letter being sent can't be replayed again
+		if _, err := q.Replay(id); !errors.Is(err, deadletter.ErrNotFound) {
+			t.Errorf("got error %v replaying during the replay, want %v", err, deadletter.ErrNotFound)
+		}
+		if _, total := q.List(0, 10); total != 1 {
+			t.Errorf("got %d dead letters during the replay, want 1", total)
+		}
+
+		if fail {
+			return errors.New("publish failed")
+		}
+
+		return nil
+	})
+
+	q.Add(1, deadletter.Message{Data: []byte("one")})
+	q.Add(2, deadletter.Message{Data: []byte("two")})
+
+	// the failed dead letter is put back
+	if _, err := q.Replay(1); err == nil {
+		t.Fatal("got no error for the failed replay")
+	}
+	if _, err := q.Get(1); err != nil {
+		t.Fatalf("get after the failed replay: %v", err)
+	}
+
+	fail = false
+
+	entry, err := q.Replay(1)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if entry.ID != 1 || string(entry.Data) != "one" {
+		t.Errorf("got replayed entry %+v, want the dead letter 1", entry)
+	}
+
+	if _, err := q.Get(1); !errors.Is(err, deadletter.ErrNotFound) {
+		t.Errorf("got error %v after the replay, want %v", err, deadletter.ErrNotFound)
+	}
+	if _, err := q.Replay(3); !errors.Is(err, deadletter.ErrNotFound) {
+		t.Errorf("got error %v replaying an unknown id, want %v", err, deadletter.ErrNotFound)
+	}
+}
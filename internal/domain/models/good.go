@@ -11,3 +11,15 @@ type Good struct {
 	Removed     bool      `json:"removed" redis:"removed"`
 	CreatedAt   time.Time `json:"created_at" redis:"created_at"`
 }
+
+// GoodMatch is a good found by a text search.
+type GoodMatch struct {
+	Good
+
+	Rank float32 `json:"rank"`
+	// NameHighlight and DescriptionHighlight are the name and the fragments
+	// of the description matching the search as html: the text is escaped
+	// and the matches are wrapped in <b>
+	NameHighlight        string `json:"name_highlight"`
+	DescriptionHighlight string `json:"description_highlight"`
+}
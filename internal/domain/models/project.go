@@ -6,6 +6,6 @@ import (
 
 type Project struct {
 	ID        int       `json:"id"`
-	Name      string    `json:"name"`
+	Name      string    `json:"name" validate:"required"`
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// Webhook notifies a project owner about the changes of the goods of the project.
+type Webhook struct {
+	ID        int    `json:"id"`
+	ProjectId int    `json:"project_id" validate:"required"`
+	URL       string `json:"url" validate:"required,url,http_url"`
+	// Secret signs the deliveries, it is only shown when the webhook is created
+	Secret string `json:"secret,omitempty"`
+	// EventTypes are the types of the change events delivered, all when empty
+	EventTypes []string `json:"event_types" validate:"dive,oneof=create update delete reprioritize"`
+	Enabled    bool     `json:"enabled"`
+	// Failures is the number of events in a row the webhook failed to receive
+	Failures  int       `json:"failures"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is an attempt to deliver an event to a webhook.
+type WebhookDelivery struct {
+	ID         int       `json:"id"`
+	WebhookId  int       `json:"webhook_id"`
+	EventId    uint64    `json:"event_id"`
+	EventType  string    `json:"event_type"`
+	Attempt    int       `json:"attempt"`
+	StatusCode *int      `json:"status_code"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	DurationMs int       `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,67 @@
+// Package errmap maps the errors of the service to the status codes
+// of the transports, so that the http and grpc APIs report them the same way.
+package errmap
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-playground/validator"
+	"github.com/kldd0/goods-service/internal/storage"
+	"google.golang.org/grpc/codes"
+)
+
+type Kind int
+
+const (
+	Internal Kind = iota
+	InvalidArgument
+	NotFound
+	AlreadyExists
+	FailedPrecondition
+)
+
+func KindOf(err error) Kind {
+	var validationErrs validator.ValidationErrors
+
+	switch {
+	case errors.As(err, &validationErrs):
+		return InvalidArgument
+	case errors.Is(err, storage.ErrEntryDoesntExist):
+		return NotFound
+	case errors.Is(err, storage.ErrEntryAlreadyExists):
+		return AlreadyExists
+	case errors.Is(err, storage.ErrEntryInUse):
+		return FailedPrecondition
+	default:
+		return Internal
+	}
+}
+
+func HTTPStatus(err error) int {
+	switch KindOf(err) {
+	case InvalidArgument:
+		return http.StatusBadRequest
+	case NotFound:
+		return http.StatusNotFound
+	case AlreadyExists, FailedPrecondition:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func GRPCCode(err error) codes.Code {
+	switch KindOf(err) {
+	case InvalidArgument:
+		return codes.InvalidArgument
+	case NotFound:
+		return codes.NotFound
+	case AlreadyExists:
+		return codes.AlreadyExists
+	case FailedPrecondition:
+		return codes.FailedPrecondition
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,154 @@
+// Package events delivers the changes made to the goods outside of the service.
+// The changes published to the changefeed hub are forwarded to the sinks
+// selected in the config: a NATS subject read by ClickHouse, a JSON lines
+// file or a partner webhook.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"log/slog"
+
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/config"
+	"github.com/kldd0/goods-service/internal/logger"
+	"github.com/nats-io/nats.go"
+)
+
+type EventSink interface {
+	// Send delivers the event, it returns once the sink has accepted it
+	Send(ctx context.Context, ev changefeed.Event) error
+	Close() error
+}
+
+// Fanout sends every event to all of its sinks at once.
+type Fanout []EventSink
+
+// Forward forwards the events of the hub to every sink on its own, so that
+// a sink retrying a delivery doesn't hold back the others, until the
+// context is done.
+func (f Fanout) Forward(ctx context.Context, log *slog.Logger, hub *changefeed.Hub) {
+	var wg sync.WaitGroup
+	for _, sink := range f {
+		wg.Add(1)
+		go func(sink EventSink) {
+			defer wg.Done()
+			Forward(ctx, log, hub, sink)
+		}(sink)
+	}
+	wg.Wait()
+}
+
+func (f Fanout) Send(ctx context.Context, ev changefeed.Event) error {
+	errs := make([]error, len(f))
+
+	var wg sync.WaitGroup
+	for i, sink := range f {
+		wg.Add(1)
+		go func(i int, sink EventSink) {
+			defer wg.Done()
+			errs[i] = sink.Send(ctx, ev)
+		}(i, sink)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (f Fanout) Close() error {
+	errs := make([]error, 0, len(f))
+	for _, sink := range f {
+		errs = append(errs, sink.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// New builds the sinks of the config, nc is used by the nats sinks:
+//   - nats publishes the rows read by the ClickHouse logs_queue table
+//   - file appends the events as JSON lines to the path
+//   - webhook posts the events to the url, signed with the secret
+//
+// The zero fields of a sink take the defaults of its constructor, the config
+// loader doesn't set them for the list items.
+func New(cfg config.Events, nc *nats.Conn) (Fanout, error) {
+	const op = "events.New"
+
+	var sinks Fanout
+
+	for i, sinkCfg := range cfg.Sinks {
+		var (
+			sink EventSink
+			err  error
+		)
+
+		switch sinkCfg.Type {
+		case "nats":
+			sink, err = NewNATSSink(nc, sinkCfg.Subject)
+		case "file":
+			sink, err = NewFileSink(sinkCfg.Path)
+		case "webhook":
+			sink, err = NewWebhookSink(sinkCfg)
+		default:
+			err = fmt.Errorf("unknown sink type %q", sinkCfg.Type)
+		}
+
+		if err != nil {
+			_ = sinks.Close()
+			return nil, fmt.Errorf("%s: sink %d: %w", op, i, err)
+		}
+
+		sinks = append(sinks, sink)
+	}
+
+	return sinks, nil
+}
+
+// Forward sends the events published to the hub to the sink until the
+// context is done. A forwarder that falls behind the hub resumes from the
+// last event it has sent, the events no longer kept by the hub are lost.
+func Forward(ctx context.Context, log *slog.Logger, hub *changefeed.Hub, sink EventSink) {
+	const op = "events.Forward"
+
+	log = log.With(slog.String("op", op))
+
+	events, cancel := hub.Subscribe(0)
+	var lastID uint64
+
+	for {
+		select {
+		case <-ctx.Done():
+			cancel()
+			return
+		case ev, ok := <-events:
+			if !ok {
+				// disconnected by the hub for lagging behind
+				var missed []changefeed.Event
+
+				missed, events, cancel, ok = hub.SubscribeFrom(0, lastID)
+				if !ok {
+					log.Error("events lost, the forwarder fell behind", slog.Uint64("last_id", lastID))
+				}
+
+				for _, ev := range missed {
+					send(ctx, log, sink, ev)
+					lastID = ev.ID
+				}
+
+				continue
+			}
+
+			send(ctx, log, sink, ev)
+			lastID = ev.ID
+		}
+	}
+}
+
+func send(ctx context.Context, log *slog.Logger, sink EventSink, ev changefeed.Event) {
+	if err := sink.Send(ctx, ev); err != nil {
+		log.Error("failed to send event", slog.Uint64("id", ev.ID), logger.Err(err))
+	}
+}
@@ -0,0 +1,313 @@
+package events_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/config"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/events"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+const secret = "secret"
+
+func testEvent() changefeed.Event {
+	priority := 3
+
+	return changefeed.Event{
+		ID:        1,
+		Type:      changefeed.EventCreate,
+		ProjectId: 1,
+		GoodId:    2,
+		Good:      &models.Good{ID: 2, ProjectId: 1, Name: "good", Priority: &priority},
+		Actor:     "admin",
+		Time:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func webhookSink(t *testing.T, url string) *events.WebhookSink {
+	t.Helper()
+
+	sink, err := events.NewWebhookSink(config.Sink{
+		Type:       "webhook",
+		URL:        url,
+		Secret:     secret,
+		MaxRetries: 3,
+		Backoff:    time.Millisecond,
+		MaxBackoff: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sink
+}
+
+func TestWebhookSink(t *testing.T) {
+	cases := []struct {
+		name     string
+		statuses []int
+		requests int32
+		fails    bool
+	}{
+		{"delivered", []int{http.StatusOK}, 1, false},
+		{"retried", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNoContent}, 3, false},
+		{"rejected", []int{http.StatusBadRequest}, 1, true},
+		{"retries exhausted", []int{500, 500, 500, 500, 500}, 4, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests atomic.Int32
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := requests.Add(1)
+
+				body, _ := io.ReadAll(r.Body)
+
+				timestamp := r.Header.Get(events.TimestampHeader)
+				if r.Header.Get(events.SignatureHeader) != events.Sign([]byte(secret), timestamp, body) {
+					t.Error("bad signature")
+				}
+
+				var ev changefeed.Event
+				if err := json.Unmarshal(body, &ev); err != nil || ev.ID != 1 {
+					t.Errorf("bad body %s", body)
+				}
+
+				w.WriteHeader(tc.statuses[n-1])
+			}))
+			defer srv.Close()
+
+			sink := webhookSink(t, srv.URL)
+			defer sink.Close()
+
+			err := sink.Send(context.Background(), testEvent())
+			if (err != nil) != tc.fails {
+				t.Errorf("got error %v, want failure %v", err, tc.fails)
+			}
+
+			if requests.Load() != tc.requests {
+				t.Errorf("got %d requests, want %d", requests.Load(), tc.requests)
+			}
+		})
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	sink, err := events.NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := sink.Send(context.Background(), testEvent()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	lines := 0
+	for scanner := bufio.NewScanner(file); scanner.Scan(); lines++ {
+		var ev changefeed.Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil || ev.Good == nil || ev.Good.Name != "good" {
+			t.Errorf("bad line %s", scanner.Text())
+		}
+	}
+
+	if lines != 2 {
+		t.Errorf("got %d lines, want 2", lines)
+	}
+}
+
+func TestNATSSink(t *testing.T) {
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go srv.Start()
+	defer srv.Shutdown()
+
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server isn't ready")
+	}
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("clickhouse_logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := events.NewNATSSink(nc, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Send(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"id":2,"project_id":1,"event_type":"create","actor":"admin","name":"good","description":null,"priority":3,"removed":false,"event_time":"2024-01-02T03:04:05Z"}`
+	if string(msg.Data) != want {
+		t.Errorf("got row %s, want %s", msg.Data, want)
+	}
+}
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []changefeed.Event
+	err    error
+}
+
+func (s *recordingSink) Send(_ context.Context, ev changefeed.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, ev)
+
+	return s.err
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func (s *recordingSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.events)
+}
+
+func TestFanout(t *testing.T) {
+	failing := &recordingSink{err: errors.New("unavailable")}
+	working := &recordingSink{}
+
+	err := events.Fanout{failing, working}.Send(context.Background(), testEvent())
+	if err == nil {
+		t.Error("the failure of a sink isn't reported")
+	}
+
+	if failing.count() != 1 || working.count() != 1 {
+		t.Errorf("got %d and %d events, want 1 each", failing.count(), working.count())
+	}
+}
+
+func TestForward(t *testing.T) {
+	hub := changefeed.NewHub(16)
+	sink := &recordingSink{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		events.Forward(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), hub, sink)
+	}()
+
+	// the forwarder subscribes asynchronously, the events are published until it does
+	deadline := time.Now().Add(5 * time.Second)
+	for sink.count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no event forwarded")
+		}
+
+		hub.Publish(changefeed.Event{Type: changefeed.EventDelete, ProjectId: 1, GoodId: 1})
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
+
+// blockingSink doesn't return until the context is done, like a webhook
+// retrying an unavailable partner
+type blockingSink struct{}
+
+func (blockingSink) Send(ctx context.Context, _ changefeed.Event) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (blockingSink) Close() error { return nil }
+
+func TestFanoutForward(t *testing.T) {
+	hub := changefeed.NewHub(256)
+	sink := &recordingSink{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		events.Fanout{blockingSink{}, sink}.Forward(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), hub)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for sink.count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no event forwarded")
+		}
+
+		hub.Publish(changefeed.Event{Type: changefeed.EventDelete, ProjectId: 1, GoodId: 1})
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// more events than the buffer of a subscriber, while the other sink is stuck
+	var last changefeed.Event
+	for i := 0; i < 200; i++ {
+		last = hub.Publish(changefeed.Event{Type: changefeed.EventCreate, ProjectId: 1, GoodId: i})
+	}
+
+	for {
+		sink.mu.Lock()
+		got := sink.events[len(sink.events)-1].ID
+		sink.mu.Unlock()
+
+		if got == last.ID {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got the events up to %d, want up to %d", got, last.ID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
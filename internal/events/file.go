@@ -0,0 +1,55 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/kldd0/goods-service/internal/changefeed"
+)
+
+// FileSink appends the events to a file, one JSON object per line.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	const op = "events.NewFileSink"
+
+	if path == "" {
+		return nil, fmt.Errorf("%s: no file path", op)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%s: opening file: %w", op, err)
+	}
+
+	return &FileSink{file: file}, nil
+}
+
+func (s *FileSink) Send(_ context.Context, ev changefeed.Event) error {
+	const op = "events.FileSink.Send"
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("%s: failed marshalling event: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a single write keeps the lines whole
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("%s: writing event: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/nats-io/nats.go"
+)
+
+const defaultSubject = "clickhouse_logs"
+
+// Row is an event flattened to the columns of the ClickHouse logs_queue
+// table, which reads the subject in the JSONEachRow format.
+type Row struct {
+	ID          int       `json:"id"`
+	ProjectId   int       `json:"project_id"`
+	EventType   string    `json:"event_type"`
+	Actor       string    `json:"actor"`
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+	Priority    *int      `json:"priority"`
+	Removed     bool      `json:"removed"`
+	EventTime   time.Time `json:"event_time"`
+}
+
+// NewRow flattens the event, a deleted good is logged as removed.
+func NewRow(ev changefeed.Event) Row {
+	row := Row{
+		ID:        ev.GoodId,
+		ProjectId: ev.ProjectId,
+		EventType: string(ev.Type),
+		Actor:     ev.Actor,
+		EventTime: ev.Time,
+	}
+
+	if ev.Good != nil {
+		row.Name = ev.Good.Name
+		row.Priority = ev.Good.Priority
+		row.Removed = ev.Good.Removed
+
+		if ev.Good.Description != "" {
+			row.Description = &ev.Good.Description
+		}
+	}
+
+	if ev.Type == changefeed.EventDelete {
+		row.Removed = true
+	}
+
+	return row
+}
+
+// NATSSink publishes the rows to a core NATS subject.
+type NATSSink struct {
+	nc      *nats.Conn
+	subject string
+}
+
+func NewNATSSink(nc *nats.Conn, subject string) (*NATSSink, error) {
+	const op = "events.NewNATSSink"
+
+	if nc == nil {
+		return nil, fmt.Errorf("%s: no NATS connection", op)
+	}
+
+	if subject == "" {
+		subject = defaultSubject
+	}
+
+	return &NATSSink{
+		nc:      nc,
+		subject: subject,
+	}, nil
+}
+
+func (s *NATSSink) Send(_ context.Context, ev changefeed.Event) error {
+	const op = "events.NATSSink.Send"
+
+	data, err := json.Marshal(NewRow(ev))
+	if err != nil {
+		return fmt.Errorf("%s: failed marshalling row: %w", op, err)
+	}
+
+	if err := s.nc.Publish(s.subject, data); err != nil {
+		return fmt.Errorf("%s: publishing to a subject: %w", op, err)
+	}
+
+	return nil
+}
+
+// Close flushes the published rows, the connection is owned by the caller.
+func (s *NATSSink) Close() error {
+	return s.nc.Flush()
+}
@@ -0,0 +1,172 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/config"
+)
+
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the
+	// timestamp header value, a dot and the body, keyed with the secret
+	SignatureHeader = "X-Goods-Signature"
+	TimestampHeader = "X-Goods-Timestamp"
+	EventIDHeader   = "X-Goods-Event-Id"
+)
+
+const (
+	defaultTimeout    = 5 * time.Second
+	defaultMaxRetries = 5
+	defaultBackoff    = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// errPermanent marks the failures that retrying won't fix
+var errPermanent = errors.New("permanent failure")
+
+// WebhookSink posts the events as JSON to a partner endpoint.
+type WebhookSink struct {
+	client     *http.Client
+	url        string
+	secret     []byte
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+func NewWebhookSink(cfg config.Sink) (*WebhookSink, error) {
+	const op = "events.NewWebhookSink"
+
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("%s: no url", op)
+	}
+
+	if cfg.Secret == "" {
+		return nil, fmt.Errorf("%s: no secret", op)
+	}
+
+	s := &WebhookSink{
+		client:     &http.Client{Timeout: cfg.Timeout},
+		url:        cfg.URL,
+		secret:     []byte(cfg.Secret),
+		maxRetries: cfg.MaxRetries,
+		backoff:    cfg.Backoff,
+		maxBackoff: cfg.MaxBackoff,
+	}
+
+	if s.client.Timeout == 0 {
+		s.client.Timeout = defaultTimeout
+	}
+
+	switch {
+	case s.maxRetries == 0:
+		s.maxRetries = defaultMaxRetries
+	case s.maxRetries < 0:
+		s.maxRetries = 0
+	}
+
+	if s.backoff == 0 {
+		s.backoff = defaultBackoff
+	}
+
+	if s.maxBackoff == 0 {
+		s.maxBackoff = defaultMaxBackoff
+	}
+
+	return s, nil
+}
+
+// Sign returns the value of the signature header of a webhook request.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts the event, retrying on network errors, 429 and 5xx responses.
+func (s *WebhookSink) Send(ctx context.Context, ev changefeed.Event) error {
+	const op = "events.WebhookSink.Send"
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("%s: failed marshalling event: %w", op, err)
+	}
+
+	delay := s.backoff
+
+	for attempt := 0; ; attempt++ {
+		err := s.post(ctx, ev.ID, body)
+		if err == nil {
+			return nil
+		}
+
+		if errors.Is(err, errPermanent) || attempt >= s.maxRetries {
+			return fmt.Errorf("%s: after %d attempts: %w", op, attempt+1, err)
+		}
+
+		// full jitter spreads the retries of the replicas
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", op, ctx.Err())
+		case <-time.After(time.Duration(rand.Int63n(int64(delay)) + 1)):
+		}
+
+		delay = min(delay*2, s.maxBackoff)
+	}
+}
+
+func (s *WebhookSink) post(ctx context.Context, id uint64, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: creating request: %v", errPermanent, err)
+	}
+
+	// the timestamp is signed along with the body, so that a captured
+	// request can't be replayed later
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(s.secret, timestamp, body))
+	req.Header.Set(EventIDHeader, strconv.FormatUint(id, 10))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// drained so that the connection is reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("webhook responded with %d", resp.StatusCode)
+	default:
+		return fmt.Errorf("%w: webhook responded with %d", errPermanent, resp.StatusCode)
+	}
+}
+
+// Close releases the idle connections to the endpoint.
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,171 @@
+package grpcserver
+
+import (
+	"context"
+
+	"log/slog"
+
+	"github.com/kldd0/goods-service/internal/http-server/middleware/auth"
+	"github.com/kldd0/goods-service/internal/logger"
+	goodsv1 "github.com/kldd0/goods-service/pkg/api/goods/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// the metadata keys of the credentials, named after the http headers
+const (
+	apiKeyMetadata        = "x-api-key"
+	authorizationMetadata = "authorization"
+)
+
+// methodScopes are the scopes the rpcs require, the same as the http
+// routes doing the same. The rpcs missing here are refused.
+var methodScopes = map[string]auth.Scope{
+	goodsv1.GoodsService_GetGood_FullMethodName:    auth.ScopeRead,
+	goodsv1.GoodsService_CreateGood_FullMethodName: auth.ScopeWrite,
+	goodsv1.GoodsService_UpdateGood_FullMethodName: auth.ScopeWrite,
+	goodsv1.GoodsService_DeleteGood_FullMethodName: auth.ScopeWrite,
+	goodsv1.GoodsService_ListGoods_FullMethodName:  auth.ScopeRead,
+	goodsv1.GoodsService_Watch_FullMethodName:      auth.ScopeRead,
+
+	goodsv1.ProjectsService_GetProject_FullMethodName:    auth.ScopeRead,
+	goodsv1.ProjectsService_CreateProject_FullMethodName: auth.ScopeWrite,
+	goodsv1.ProjectsService_UpdateProject_FullMethodName: auth.ScopeWrite,
+	goodsv1.ProjectsService_DeleteProject_FullMethodName: auth.ScopeWrite,
+	goodsv1.ProjectsService_ListProjects_FullMethodName:  auth.ScopeRead,
+}
+
+// unaryAuth authenticates the calls like the http middleware and authorizes
+// them per project. A nil or disabled authenticator lets every call through.
+func unaryAuth(log *slog.Logger, authn *auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !authn.Enabled() {
+			return handler(ctx, req)
+		}
+
+		ctx, claims, err := authenticate(ctx, log, authn, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := authorize(log, claims, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// streamAuth is unaryAuth for the streams.
+func streamAuth(log *slog.Logger, authn *auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !authn.Enabled() {
+			return handler(srv, ss)
+		}
+
+		ctx, claims, err := authenticate(ss.Context(), log, authn, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		// the project of the stream is known once its request is received
+		return handler(srv, &authorizedStream{
+			ServerStream: ss,
+			ctx:          ctx,
+			authorize: func(req any) error {
+				return authorize(log, claims, info.FullMethod, req)
+			},
+		})
+	}
+}
+
+// authorizedStream checks the first received message of a stream
+// before passing it to the handler.
+type authorizedStream struct {
+	grpc.ServerStream
+
+	ctx        context.Context
+	authorize  func(req any) error
+	authorized bool
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authorizedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	if !s.authorized {
+		if err := s.authorize(m); err != nil {
+			return err
+		}
+		s.authorized = true
+	}
+
+	return nil
+}
+
+// authenticate checks the credentials of the call metadata and returns the
+// context carrying the claims of the caller.
+func authenticate(ctx context.Context, log *slog.Logger, authn *auth.Authenticator, method string) (context.Context, auth.Claims, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	claims, err := authn.Credentials(first(md, apiKeyMetadata), first(md, authorizationMetadata))
+	if err != nil {
+		log.Info("unauthenticated call", slog.String("method", method), logger.Err(err))
+		return ctx, auth.Claims{}, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	return auth.WithClaims(ctx, claims), claims, nil
+}
+
+// authorize rejects the calls whose caller may not access the project
+// of the request with the scope of the method.
+func authorize(log *slog.Logger, claims auth.Claims, method string, req any) error {
+	scope, ok := methodScopes[method]
+	projectId := projectOf(req)
+
+	if !ok || !claims.Allows(projectId, scope) {
+		log.Info(
+			"forbidden call",
+			slog.String("method", method),
+			slog.String("subject", claims.Subject),
+			slog.Int("projectId", projectId),
+			slog.String("scope", string(scope)),
+		)
+		return status.Error(codes.PermissionDenied, "forbidden")
+	}
+
+	return nil
+}
+
+// projectOf returns the project of the request, or zero for requests
+// not limited to a project.
+func projectOf(req any) int {
+	switch req := req.(type) {
+	case interface{ GetProjectId() int64 }:
+		return int(req.GetProjectId())
+	// the project requests carry the id of the project itself
+	case *goodsv1.GetProjectRequest:
+		return int(req.GetId())
+	case *goodsv1.UpdateProjectRequest:
+		return int(req.GetId())
+	case *goodsv1.DeleteProjectRequest:
+		return int(req.GetId())
+	default:
+		return 0
+	}
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
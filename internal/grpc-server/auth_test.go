@@ -0,0 +1,124 @@
+package grpcserver_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kldd0/goods-service/internal/config"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/auth"
+	"github.com/kldd0/goods-service/internal/storage/memory"
+	goodsv1 "github.com/kldd0/goods-service/pkg/api/goods/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const hmacSecret = "secret"
+
+func TestAuth(t *testing.T) {
+	a, err := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), config.Auth{
+		Enabled: true,
+		APIKeys: []config.APIKey{
+			{Key: "reader", Subject: "reader", Projects: []int{1}, Scopes: []string{"read"}},
+			{Key: "admin", Subject: "admin", AllProjects: true, Scopes: []string{"write"}},
+		},
+		JWT: config.JWT{HS256Secret: hmacSecret},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "hs", "projects": []int{2}, "scope": "read write", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(hmacSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := dial(t, memory.New(), a)
+	goods := goodsv1.NewGoodsServiceClient(conn)
+	projects := goodsv1.NewProjectsServiceClient(conn)
+
+	// call is the rpc of the case, its own error code is NotFound
+	// or InvalidArgument when the call is let through
+	cases := []struct {
+		name   string
+		apiKey string
+		token  string
+		call   func(ctx context.Context) error
+		code   codes.Code
+	}{
+		{"no credentials", "", "", getGood(goods, 1), codes.Unauthenticated},
+		{"unknown api key", "nope", "", getGood(goods, 1), codes.Unauthenticated},
+		{"api key of the project", "reader", "", getGood(goods, 1), codes.NotFound},
+		{"api key of another project", "reader", "", getGood(goods, 2), codes.PermissionDenied},
+		{"api key without write scope", "reader", "", func(ctx context.Context) error {
+			_, err := goods.CreateGood(ctx, &goodsv1.CreateGoodRequest{ProjectId: 1})
+			return err
+		}, codes.PermissionDenied},
+		{"api key limited to a project lists all", "reader", "", func(ctx context.Context) error {
+			_, err := goods.ListGoods(ctx, &goodsv1.ListGoodsRequest{Limit: 1})
+			return err
+		}, codes.PermissionDenied},
+		{"project id of the project requests", "reader", "", func(ctx context.Context) error {
+			_, err := projects.GetProject(ctx, &goodsv1.GetProjectRequest{Id: 2})
+			return err
+		}, codes.PermissionDenied},
+		{"api key limited to a project creates one", "reader", "", func(ctx context.Context) error {
+			_, err := projects.CreateProject(ctx, &goodsv1.CreateProjectRequest{})
+			return err
+		}, codes.PermissionDenied},
+		{"api key of all projects creates one", "admin", "", func(ctx context.Context) error {
+			_, err := projects.CreateProject(ctx, &goodsv1.CreateProjectRequest{})
+			return err
+		}, codes.InvalidArgument},
+		{"write scope implies read", "admin", "", getGood(goods, 5), codes.NotFound},
+		{"bearer token", "", "Bearer " + token, getGood(goods, 2), codes.NotFound},
+		{"bearer token of another project", "", "Bearer " + token, getGood(goods, 1), codes.PermissionDenied},
+		{"malformed authorization", "", token, getGood(goods, 2), codes.Unauthenticated},
+		{"watch of another project", "reader", "", watch(goods, 2), codes.PermissionDenied},
+		{"watch of the project", "reader", "", watch(goods, 1), codes.DeadlineExceeded},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			if tc.apiKey != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", tc.apiKey)
+			}
+			if tc.token != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tc.token)
+			}
+
+			if code := status.Code(tc.call(ctx)); code != tc.code {
+				t.Errorf("got code %s, want %s", code, tc.code)
+			}
+		})
+	}
+}
+
+func getGood(client goodsv1.GoodsServiceClient, projectId int64) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := client.GetGood(ctx, &goodsv1.GetGoodRequest{Id: 1, ProjectId: projectId})
+		return err
+	}
+}
+
+// watch opens a watch stream, the allowed one runs until the deadline
+func watch(client goodsv1.GoodsServiceClient, projectId int64) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		stream, err := client.Watch(ctx, &goodsv1.WatchRequest{ProjectId: projectId})
+		if err != nil {
+			return err
+		}
+
+		_, err = stream.Recv()
+		return err
+	}
+}
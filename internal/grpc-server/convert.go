@@ -0,0 +1,67 @@
+package grpcserver
+
+import (
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	goodsv1 "github.com/kldd0/goods-service/pkg/api/goods/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func goodToProto(good models.Good) *goodsv1.Good {
+	pb := &goodsv1.Good{
+		Id:          int64(good.ID),
+		ProjectId:   int64(good.ProjectId),
+		Name:        good.Name,
+		Description: good.Description,
+		Removed:     good.Removed,
+		CreatedAt:   timestamppb.New(good.CreatedAt),
+	}
+
+	if good.Priority != nil {
+		priority := int64(*good.Priority)
+		pb.Priority = &priority
+	}
+
+	return pb
+}
+
+func priorityFromProto(priority *int64) *int {
+	if priority == nil {
+		return nil
+	}
+
+	p := int(*priority)
+
+	return &p
+}
+
+func projectToProto(project models.Project) *goodsv1.Project {
+	return &goodsv1.Project{
+		Id:        int64(project.ID),
+		Name:      project.Name,
+		CreatedAt: timestamppb.New(project.CreatedAt),
+	}
+}
+
+var eventTypes = map[changefeed.EventType]goodsv1.GoodEvent_Type{
+	changefeed.EventCreate:       goodsv1.GoodEvent_TYPE_CREATE,
+	changefeed.EventUpdate:       goodsv1.GoodEvent_TYPE_UPDATE,
+	changefeed.EventDelete:       goodsv1.GoodEvent_TYPE_DELETE,
+	changefeed.EventReprioritize: goodsv1.GoodEvent_TYPE_REPRIORITIZE,
+}
+
+func eventToProto(ev changefeed.Event) *goodsv1.GoodEvent {
+	pb := &goodsv1.GoodEvent{
+		Id:        ev.ID,
+		Type:      eventTypes[ev.Type],
+		ProjectId: int64(ev.ProjectId),
+		GoodId:    int64(ev.GoodId),
+		Time:      timestamppb.New(ev.Time),
+	}
+
+	if ev.Good != nil {
+		pb.Good = goodToProto(*ev.Good)
+	}
+
+	return pb
+}
@@ -0,0 +1,278 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"log/slog"
+
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/clients/redis"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/auth"
+	"github.com/kldd0/goods-service/internal/logger"
+	"github.com/kldd0/goods-service/internal/storage"
+	"github.com/kldd0/goods-service/internal/validation"
+	goodsv1 "github.com/kldd0/goods-service/pkg/api/goods/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type goodsServer struct {
+	goodsv1.UnimplementedGoodsServiceServer
+
+	log   *slog.Logger
+	db    storage.Storage
+	cache Cache
+	feed  *changefeed.Hub
+
+	maxPageLimit int
+}
+
+func (s *goodsServer) GetGood(ctx context.Context, req *goodsv1.GetGoodRequest) (*goodsv1.Good, error) {
+	const op = "grpc.goods.GetGood"
+
+	log := s.log.With(slog.String("op", op))
+
+	goodId := strconv.FormatInt(req.GetId(), 10)
+	projectId := strconv.FormatInt(req.GetProjectId(), 10)
+
+	// looking for the good in cache
+	key := redis.GoodKey(goodId, projectId)
+	requestedGood, err := s.cache.GetGood(ctx, key)
+	if err == nil {
+		log.Info("the good was taken from the cache", slog.String("id", goodId))
+		return goodToProto(requestedGood), nil
+	}
+
+	if !errors.Is(err, redis.ErrKeyNotFound) {
+		log.Error("cache error", logger.Err(err))
+	}
+
+	requestedGood, err = s.db.GetGood(ctx, goodId, projectId)
+	if errors.Is(err, storage.ErrEntryDoesntExist) {
+		log.Info("good not found", slog.String("id", goodId))
+		return nil, toStatus(err, "not found")
+	}
+
+	if err != nil {
+		log.Error("failed to get the good", logger.Err(err))
+		return nil, toStatus(err, "internal error")
+	}
+
+	// add the retrieved good to the cache
+	if err := s.cache.SetGood(ctx, key, requestedGood); err != nil {
+		log.Error("failed to set good in cache", logger.Err(err))
+	}
+
+	return goodToProto(requestedGood), nil
+}
+
+func (s *goodsServer) CreateGood(ctx context.Context, req *goodsv1.CreateGoodRequest) (*goodsv1.Good, error) {
+	const op = "grpc.goods.CreateGood"
+
+	log := s.log.With(slog.String("op", op))
+
+	newGood := models.Good{
+		ProjectId:   int(req.GetProjectId()),
+		Name:        req.GetName(),
+		Description: req.GetDescription(),
+		Priority:    priorityFromProto(req.Priority),
+		Removed:     req.GetRemoved(),
+	}
+
+	if err := validation.Good(newGood); err != nil {
+		log.Error("invalid request", logger.Err(err))
+		return nil, toStatus(err, "invalid request")
+	}
+
+	good, err := s.db.SaveGood(ctx, newGood)
+	if errors.Is(err, storage.ErrEntryAlreadyExists) {
+		log.Info("good already exists")
+		return nil, toStatus(err, "good already exists")
+	}
+
+	if errors.Is(err, storage.ErrGettingInsertedRows) {
+		log.Info("failed to get inserted row", logger.Err(err))
+	}
+
+	if err != nil && !errors.Is(err, storage.ErrGettingInsertedRows) {
+		log.Error("failed to add good", logger.Err(err))
+		return nil, toStatus(err, "failed to add good")
+	}
+
+	log.Info("good added", slog.Int64("id", int64(good.ID)))
+
+	s.feed.Publish(changefeed.Event{
+		Type:      changefeed.EventCreate,
+		ProjectId: good.ProjectId,
+		GoodId:    good.ID,
+		Good:      &good,
+		Actor:     auth.SubjectFrom(ctx),
+	})
+
+	return goodToProto(good), nil
+}
+
+func (s *goodsServer) UpdateGood(ctx context.Context, req *goodsv1.UpdateGoodRequest) (*goodsv1.Good, error) {
+	const op = "grpc.goods.UpdateGood"
+
+	log := s.log.With(slog.String("op", op))
+
+	patchedGood := models.Good{
+		ID:          int(req.GetId()),
+		ProjectId:   int(req.GetProjectId()),
+		Name:        req.GetName(),
+		Description: req.GetDescription(),
+		Priority:    priorityFromProto(req.Priority),
+		Removed:     req.GetRemoved(),
+	}
+
+	if err := validation.PatchedGood(patchedGood); err != nil {
+		log.Error("invalid request", logger.Err(err))
+		return nil, toStatus(err, "invalid request")
+	}
+
+	good, err := s.db.PatchGood(ctx, patchedGood)
+	if errors.Is(err, storage.ErrEntryDoesntExist) {
+		log.Info("good doesn't exist")
+		return nil, toStatus(err, "good doesn't exist")
+	}
+
+	if errors.Is(err, storage.ErrEntryAlreadyExists) {
+		log.Info("priority is taken")
+		return nil, toStatus(err, "priority is taken")
+	}
+
+	if errors.Is(err, storage.ErrGettingInsertedRows) {
+		log.Info("failed getting inserted row", logger.Err(err))
+	}
+
+	if err != nil && !errors.Is(err, storage.ErrGettingInsertedRows) {
+		log.Error("failed to patch good", logger.Err(err))
+		return nil, toStatus(err, "failed to patch good")
+	}
+
+	// invalidate cache
+	key := redis.GoodKey(strconv.Itoa(patchedGood.ID), strconv.Itoa(patchedGood.ProjectId))
+	if err := s.cache.Delete(ctx, key); err != nil {
+		log.Error("failed to delete good from cache", logger.Err(err))
+	}
+
+	log.Info("good patched", slog.Int64("id", int64(good.ID)))
+
+	// an update that sets the priority moves the good in the project ordering
+	eventType := changefeed.EventUpdate
+	if req.Priority != nil {
+		eventType = changefeed.EventReprioritize
+	}
+
+	s.feed.Publish(changefeed.Event{
+		Type:      eventType,
+		ProjectId: patchedGood.ProjectId,
+		GoodId:    patchedGood.ID,
+		Good:      &good,
+		Actor:     auth.SubjectFrom(ctx),
+	})
+
+	return goodToProto(good), nil
+}
+
+func (s *goodsServer) DeleteGood(ctx context.Context, req *goodsv1.DeleteGoodRequest) (*goodsv1.DeleteGoodResponse, error) {
+	const op = "grpc.goods.DeleteGood"
+
+	log := s.log.With(slog.String("op", op))
+
+	goodId := strconv.FormatInt(req.GetId(), 10)
+	projectId := strconv.FormatInt(req.GetProjectId(), 10)
+
+	err := s.db.DeleteGood(ctx, goodId, projectId)
+	if errors.Is(err, storage.ErrEntryDoesntExist) {
+		log.Info("good doesn't exist")
+		return nil, toStatus(err, "good doesn't exist")
+	}
+
+	if err != nil {
+		log.Error("failed to delete good", logger.Err(err))
+		return nil, toStatus(err, "failed to delete good")
+	}
+
+	log.Info("good removed", slog.String("id", goodId))
+
+	// invalidate cache
+	if err := s.cache.Delete(ctx, redis.GoodKey(goodId, projectId)); err != nil {
+		log.Error("failed to delete good from cache", logger.Err(err))
+	}
+
+	s.feed.Publish(changefeed.Event{
+		Type:      changefeed.EventDelete,
+		ProjectId: int(req.GetProjectId()),
+		GoodId:    int(req.GetId()),
+		Actor:     auth.SubjectFrom(ctx),
+	})
+
+	return &goodsv1.DeleteGoodResponse{
+		Id:        req.GetId(),
+		ProjectId: req.GetProjectId(),
+		Removed:   true,
+	}, nil
+}
+
+func (s *goodsServer) ListGoods(ctx context.Context, req *goodsv1.ListGoodsRequest) (*goodsv1.ListGoodsResponse, error) {
+	const op = "grpc.goods.ListGoods"
+
+	log := s.log.With(slog.String("op", op))
+
+	offset, limit, err := pagination(req.GetLimit(), req.GetOffset(), s.maxPageLimit)
+	if err != nil {
+		log.Info("bad request", logger.Err(err))
+		return nil, err
+	}
+
+	requestedGoods, err := s.db.ListGoodsWithPagination(ctx, offset, limit)
+	if err != nil && !errors.Is(err, storage.ErrEntryDoesntExist) {
+		log.Error("failed to get the goods", logger.Err(err))
+		return nil, toStatus(err, "internal error")
+	}
+
+	resp := &goodsv1.ListGoodsResponse{
+		Goods: make([]*goodsv1.Good, 0, len(requestedGoods)),
+	}
+
+	// add the retrieved goods to the cache
+	for _, good := range requestedGoods {
+		key := redis.GoodKey(strconv.Itoa(good.ID), strconv.Itoa(good.ProjectId))
+		if err := s.cache.SetGood(ctx, key, good); err != nil {
+			log.Error("failed to set good in cache", logger.Err(err))
+		}
+
+		resp.Goods = append(resp.Goods, goodToProto(good))
+	}
+
+	return resp, nil
+}
+
+func (s *goodsServer) Watch(req *goodsv1.WatchRequest, stream goodsv1.GoodsService_WatchServer) error {
+	if req.GetProjectId() == 0 {
+		return status.Error(codes.InvalidArgument, "field ProjectId is a required field")
+	}
+
+	events, cancel := s.feed.Subscribe(int(req.GetProjectId()))
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ev, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "the watcher fell too far behind")
+			}
+
+			if err := stream.Send(eventToProto(ev)); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"log/slog"
+
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/logger"
+	"github.com/kldd0/goods-service/internal/storage"
+	"github.com/kldd0/goods-service/internal/validation"
+	goodsv1 "github.com/kldd0/goods-service/pkg/api/goods/v1"
+)
+
+type projectsServer struct {
+	goodsv1.UnimplementedProjectsServiceServer
+
+	log *slog.Logger
+	db  storage.Storage
+
+	maxPageLimit int
+}
+
+func (s *projectsServer) GetProject(ctx context.Context, req *goodsv1.GetProjectRequest) (*goodsv1.Project, error) {
+	const op = "grpc.projects.GetProject"
+
+	log := s.log.With(slog.String("op", op))
+
+	project, err := s.db.GetProject(ctx, strconv.FormatInt(req.GetId(), 10))
+	if errors.Is(err, storage.ErrEntryDoesntExist) {
+		log.Info("project not found", slog.Int64("id", req.GetId()))
+		return nil, toStatus(err, "not found")
+	}
+
+	if err != nil {
+		log.Error("failed to get the project", logger.Err(err))
+		return nil, toStatus(err, "internal error")
+	}
+
+	return projectToProto(project), nil
+}
+
+func (s *projectsServer) CreateProject(ctx context.Context, req *goodsv1.CreateProjectRequest) (*goodsv1.Project, error) {
+	const op = "grpc.projects.CreateProject"
+
+	log := s.log.With(slog.String("op", op))
+
+	newProject := models.Project{
+		Name: req.GetName(),
+	}
+
+	if err := validation.Project(newProject); err != nil {
+		log.Error("invalid request", logger.Err(err))
+		return nil, toStatus(err, "invalid request")
+	}
+
+	project, err := s.db.SaveProject(ctx, newProject)
+	if err != nil {
+		log.Error("failed to add project", logger.Err(err))
+		return nil, toStatus(err, "failed to add project")
+	}
+
+	log.Info("project added", slog.Int64("id", int64(project.ID)))
+
+	return projectToProto(project), nil
+}
+
+func (s *projectsServer) UpdateProject(ctx context.Context, req *goodsv1.UpdateProjectRequest) (*goodsv1.Project, error) {
+	const op = "grpc.projects.UpdateProject"
+
+	log := s.log.With(slog.String("op", op))
+
+	patchedProject := models.Project{
+		ID:   int(req.GetId()),
+		Name: req.GetName(),
+	}
+
+	if err := validation.Project(patchedProject); err != nil {
+		log.Error("invalid request", logger.Err(err))
+		return nil, toStatus(err, "invalid request")
+	}
+
+	project, err := s.db.PatchProject(ctx, patchedProject)
+	if errors.Is(err, storage.ErrEntryDoesntExist) {
+		log.Info("project doesn't exist")
+		return nil, toStatus(err, "project doesn't exist")
+	}
+
+	if err != nil {
+		log.Error("failed to patch project", logger.Err(err))
+		return nil, toStatus(err, "failed to patch project")
+	}
+
+	log.Info("project patched", slog.Int64("id", int64(project.ID)))
+
+	return projectToProto(project), nil
+}
+
+func (s *projectsServer) DeleteProject(ctx context.Context, req *goodsv1.DeleteProjectRequest) (*goodsv1.DeleteProjectResponse, error) {
+	const op = "grpc.projects.DeleteProject"
+
+	log := s.log.With(slog.String("op", op))
+
+	err := s.db.DeleteProject(ctx, strconv.FormatInt(req.GetId(), 10))
+	if errors.Is(err, storage.ErrEntryDoesntExist) {
+		log.Info("project doesn't exist")
+		return nil, toStatus(err, "project doesn't exist")
+	}
+
+	if errors.Is(err, storage.ErrEntryInUse) {
+		log.Info("project has goods")
+		return nil, toStatus(err, "project has goods")
+	}
+
+	if err != nil {
+		log.Error("failed to delete project", logger.Err(err))
+		return nil, toStatus(err, "failed to delete project")
+	}
+
+	log.Info("project removed", slog.Int64("id", req.GetId()))
+
+	return &goodsv1.DeleteProjectResponse{
+		Id:      req.GetId(),
+		Removed: true,
+	}, nil
+}
+
+func (s *projectsServer) ListProjects(ctx context.Context, req *goodsv1.ListProjectsRequest) (*goodsv1.ListProjectsResponse, error) {
+	const op = "grpc.projects.ListProjects"
+
+	log := s.log.With(slog.String("op", op))
+
+	offset, limit, err := pagination(req.GetLimit(), req.GetOffset(), s.maxPageLimit)
+	if err != nil {
+		log.Info("bad request", logger.Err(err))
+		return nil, err
+	}
+
+	projects, err := s.db.ListProjectsWithPagination(ctx, offset, limit)
+	if err != nil && !errors.Is(err, storage.ErrEntryDoesntExist) {
+		log.Error("failed to get the projects", logger.Err(err))
+		return nil, toStatus(err, "internal error")
+	}
+
+	resp := &goodsv1.ListProjectsResponse{
+		Projects: make([]*goodsv1.Project, 0, len(projects)),
+	}
+
+	for _, project := range projects {
+		resp.Projects = append(resp.Projects, projectToProto(project))
+	}
+
+	return resp, nil
+}
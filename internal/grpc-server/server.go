@@ -0,0 +1,113 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"log/slog"
+
+	"github.com/go-playground/validator"
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/errmap"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/auth"
+	"github.com/kldd0/goods-service/internal/storage"
+	"github.com/kldd0/goods-service/internal/validation"
+	goodsv1 "github.com/kldd0/goods-service/pkg/api/goods/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Cache interface {
+	GetGood(ctx context.Context, key string) (models.Good, error)
+	SetGood(ctx context.Context, key string, value models.Good) error
+	Delete(ctx context.Context, key string) error
+}
+
+// New creates a grpc server serving the goods and projects APIs
+// on top of the same storage, cache and change feed as the http handlers.
+// The calls are authorized by authn like the http ones, a nil authn
+// disables it. The limit of the list requests is capped by maxPageLimit.
+func New(log *slog.Logger, db storage.Storage, cache Cache, feed *changefeed.Hub, authn *auth.Authenticator, maxPageLimit int) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryLogger(log), unaryAuth(log, authn)),
+		grpc.ChainStreamInterceptor(streamLogger(log), streamAuth(log, authn)),
+	)
+
+	goodsv1.RegisterGoodsServiceServer(srv, &goodsServer{
+		log:          log,
+		db:           db,
+		cache:        cache,
+		feed:         feed,
+		maxPageLimit: maxPageLimit,
+	})
+	goodsv1.RegisterProjectsServiceServer(srv, &projectsServer{
+		log:          log,
+		db:           db,
+		maxPageLimit: maxPageLimit,
+	})
+
+	return srv
+}
+
+// pagination validates the limit and offset of a list request
+// the way the http api does and caps the limit.
+func pagination(limit, offset int64, maxLimit int) (string, string, error) {
+	if limit < 0 || offset < 0 {
+		return "", "", status.Error(codes.InvalidArgument, "limit and offset can't be negative")
+	}
+
+	if maxLimit > 0 && limit > int64(maxLimit) {
+		limit = int64(maxLimit)
+	}
+
+	return strconv.FormatInt(offset, 10), strconv.FormatInt(limit, 10), nil
+}
+
+// toStatus converts an error into a grpc status with the code
+// the http API would respond with.
+func toStatus(err error, msg string) error {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		msg = validation.Message(validationErrs)
+	}
+
+	return status.Error(errmap.GRPCCode(err), msg)
+}
+
+func unaryLogger(log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		startTime := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		log.Info(
+			"grpc info",
+			slog.Any("method", info.FullMethod),
+			slog.Any("code", status.Code(err).String()),
+			slog.Any("duration", time.Since(startTime).String()),
+		)
+
+		return resp, err
+	}
+}
+
+func streamLogger(log *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		startTime := time.Now()
+
+		err := handler(srv, ss)
+
+		log.Info(
+			"grpc info",
+			slog.Any("method", info.FullMethod),
+			slog.Any("code", status.Code(err).String()),
+			slog.Any("duration", time.Since(startTime).String()),
+		)
+
+		return err
+	}
+}
@@ -0,0 +1,123 @@
+package grpcserver_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"log/slog"
+
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/clients/redis"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	grpcserver "github.com/kldd0/goods-service/internal/grpc-server"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/auth"
+	"github.com/kldd0/goods-service/internal/storage"
+	"github.com/kldd0/goods-service/internal/storage/memory"
+	goodsv1 "github.com/kldd0/goods-service/pkg/api/goods/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeCache never holds a good
+type fakeCache struct{}
+
+func (fakeCache) GetGood(context.Context, string) (models.Good, error) {
+	return models.Good{}, redis.ErrKeyNotFound
+}
+
+func (fakeCache) SetGood(context.Context, string, models.Good) error { return nil }
+
+func (fakeCache) Delete(context.Context, string) error { return nil }
+
+// dial serves the apis over an in-memory listener and returns a client
+// connection to them, a nil authn disables authentication.
+func dial(t *testing.T, db storage.Storage, authn *auth.Authenticator) *grpc.ClientConn {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := grpcserver.New(log, db, fakeCache{}, changefeed.NewHub(16), authn, 100)
+
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestCreateProject(t *testing.T) {
+	ctx := context.Background()
+	client := goodsv1.NewProjectsServiceClient(dial(t, memory.New(), nil))
+
+	first, err := client.CreateProject(ctx, &goodsv1.CreateProjectRequest{Name: "first"})
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	second, err := client.CreateProject(ctx, &goodsv1.CreateProjectRequest{Name: "second"})
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	// the ids are generated by the storage
+	if first.GetId() == 0 || second.GetId() == 0 || first.GetId() == second.GetId() {
+		t.Fatalf("got project ids %d and %d, want distinct generated ids", first.GetId(), second.GetId())
+	}
+
+	got, err := client.GetProject(ctx, &goodsv1.GetProjectRequest{Id: second.GetId()})
+	if err != nil {
+		t.Fatalf("get project: %v", err)
+	}
+	if got.GetName() != "second" {
+		t.Errorf("got project %+v, want %q", got, "second")
+	}
+
+	_, err = client.CreateProject(ctx, &goodsv1.CreateProjectRequest{})
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Errorf("got code %s creating a project without a name, want %s", code, codes.InvalidArgument)
+	}
+}
+
+func TestDeleteProjectWithGoods(t *testing.T) {
+	ctx := context.Background()
+	conn := dial(t, memory.New(), nil)
+	projects := goodsv1.NewProjectsServiceClient(conn)
+	goods := goodsv1.NewGoodsServiceClient(conn)
+
+	project, err := projects.CreateProject(ctx, &goodsv1.CreateProjectRequest{Name: "project"})
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	good, err := goods.CreateGood(ctx, &goodsv1.CreateGoodRequest{ProjectId: project.GetId(), Name: "good"})
+	if err != nil {
+		t.Fatalf("create good: %v", err)
+	}
+
+	_, err = projects.DeleteProject(ctx, &goodsv1.DeleteProjectRequest{Id: project.GetId()})
+	if code := status.Code(err); code != codes.FailedPrecondition {
+		t.Fatalf("got code %s deleting a project with goods, want %s", code, codes.FailedPrecondition)
+	}
+
+	if _, err := goods.DeleteGood(ctx, &goodsv1.DeleteGoodRequest{Id: good.GetId(), ProjectId: project.GetId()}); err != nil {
+		t.Fatalf("delete good: %v", err)
+	}
+
+	if _, err := projects.DeleteProject(ctx, &goodsv1.DeleteProjectRequest{Id: project.GetId()}); err != nil {
+		t.Errorf("delete project without goods: %v", err)
+	}
+}
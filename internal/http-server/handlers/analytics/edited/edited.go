@@ -0,0 +1,49 @@
+package edited
+
+import (
+	"context"
+	"net/http"
+
+	"log/slog"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/analytics"
+	"github.com/kldd0/goods-service/internal/clients/clickhouse"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/logger"
+)
+
+type reporter interface {
+	MostEdited(ctx context.Context, query clickhouse.AnalyticsQuery) (analytics.MostEditedReport, error)
+}
+
+// New lists the goods changed the most, the requested limit is capped by
+// maxLimit. The goods of every project are listed when no project is
+// requested, which needs access to all the projects.
+func New(log *slog.Logger, reports reporter, maxLimit int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "analytics.edited.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		query, err := analytics.ParseQuery(r.URL.Query(), maxLimit)
+		if err != nil {
+			log.Info("bad request", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		report, err := reports.MostEdited(r.Context(), query)
+		if err != nil {
+			log.Error("failed to get most edited goods", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		render.JSON(w, r, report)
+	}
+}
@@ -0,0 +1,49 @@
+package events
+
+import (
+	"context"
+	"net/http"
+
+	"log/slog"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/analytics"
+	"github.com/kldd0/goods-service/internal/clients/clickhouse"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/logger"
+)
+
+type reporter interface {
+	Events(ctx context.Context, query clickhouse.AnalyticsQuery) (analytics.EventsReport, error)
+}
+
+// New reports the number of logged changes per time bucket, a series per
+// project or event type. The changes of every project are counted when no
+// project is requested, which needs access to all the projects.
+func New(log *slog.Logger, reports reporter, maxLimit int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "analytics.events.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		query, err := analytics.ParseQuery(r.URL.Query(), maxLimit)
+		if err != nil {
+			log.Info("bad request", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		report, err := reports.Events(r.Context(), query)
+		if err != nil {
+			log.Error("failed to count events", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		render.JSON(w, r, report)
+	}
+}
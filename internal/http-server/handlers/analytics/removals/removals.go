@@ -0,0 +1,49 @@
+package removals
+
+import (
+	"context"
+	"net/http"
+
+	"log/slog"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/analytics"
+	"github.com/kldd0/goods-service/internal/clients/clickhouse"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/logger"
+)
+
+type reporter interface {
+	Removals(ctx context.Context, query clickhouse.AnalyticsQuery) (analytics.RemovalsReport, error)
+}
+
+// New reports the number of created and removed goods per time bucket and
+// the share of the removed ones. The goods of every project are counted when
+// no project is requested, which needs access to all the projects.
+func New(log *slog.Logger, reports reporter, maxLimit int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "analytics.removals.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		query, err := analytics.ParseQuery(r.URL.Query(), maxLimit)
+		if err != nil {
+			log.Info("bad request", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		report, err := reports.Removals(r.Context(), query)
+		if err != nil {
+			log.Error("failed to count removals", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		render.JSON(w, r, report)
+	}
+}
@@ -0,0 +1,140 @@
+package list
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"log/slog"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/clients/clickhouse"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/logger"
+)
+
+type Meta struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type Response struct {
+	Meta `json:"meta"`
+
+	Entries []clickhouse.AuditEntry `json:"entries"`
+}
+
+type auditQuerier interface {
+	QueryAudit(ctx context.Context, filter clickhouse.AuditFilter) ([]clickhouse.AuditEntry, error)
+}
+
+var eventTypes = []changefeed.EventType{
+	changefeed.EventCreate,
+	changefeed.EventUpdate,
+	changefeed.EventDelete,
+	changefeed.EventReprioritize,
+}
+
+// New lists the logged changes of the goods, the latest first. The requested
+// limit is capped by maxLimit. The changes of every project are listed when
+// no project is requested, which needs access to all the projects.
+func New(log *slog.Logger, audit auditQuerier, maxLimit int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "audit.list.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		filter, err := parseFilter(r)
+		if err != nil {
+			log.Info("bad request", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if maxLimit > 0 && filter.Limit > maxLimit {
+			filter.Limit = maxLimit
+		}
+
+		entries, err := audit.QueryAudit(r.Context(), filter)
+		if err != nil {
+			log.Error("failed to query audit log", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		if entries == nil {
+			entries = []clickhouse.AuditEntry{}
+		}
+
+		render.JSON(w, r, Response{
+			Meta: Meta{
+				Limit:  filter.Limit,
+				Offset: filter.Offset,
+			},
+			Entries: entries,
+		})
+	}
+}
+
+func parseFilter(r *http.Request) (clickhouse.AuditFilter, error) {
+	query := r.URL.Query()
+
+	var (
+		filter clickhouse.AuditFilter
+		err    error
+	)
+
+	if filter.Limit, err = strconv.Atoi(query.Get("limit")); err != nil || filter.Limit < 0 {
+		return filter, fmt.Errorf("invalid limit")
+	}
+
+	if filter.Offset, err = strconv.Atoi(query.Get("offset")); err != nil || filter.Offset < 0 {
+		return filter, fmt.Errorf("invalid offset")
+	}
+
+	if projectId := query.Get("projectId"); projectId != "" {
+		if filter.ProjectId, err = strconv.Atoi(projectId); err != nil || filter.ProjectId <= 0 {
+			return filter, fmt.Errorf("invalid projectId")
+		}
+	}
+
+	if goodId := query.Get("goodId"); goodId != "" {
+		if filter.GoodId, err = strconv.Atoi(goodId); err != nil || filter.GoodId <= 0 {
+			return filter, fmt.Errorf("invalid goodId")
+		}
+	}
+
+	if eventType := query.Get("type"); eventType != "" {
+		if !slices.Contains(eventTypes, changefeed.EventType(eventType)) {
+			return filter, fmt.Errorf("invalid type")
+		}
+
+		filter.EventType = eventType
+	}
+
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return filter, fmt.Errorf("invalid from")
+		}
+	}
+
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return filter, fmt.Errorf("invalid to")
+		}
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, fmt.Errorf("from must be before to")
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,19 @@
+package stats
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+type poolStatser interface {
+	PoolStats() storage.PoolStats
+}
+
+// New reports the state of the connection pool of the storage.
+func New(db poolStatser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, db.PoolStats())
+	}
+}
@@ -0,0 +1,55 @@
+package get
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"log/slog"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/deadletter"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/logger"
+)
+
+type deadLetterGetter interface {
+	Get(id uint64) (deadletter.Entry, error)
+}
+
+func New(log *slog.Logger, queue deadLetterGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "deadletter.get.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		id := chi.URLParam(r, "id")
+
+		idNum, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			log.Info("bad request", slog.Any("id", id))
+			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		entry, err := queue.Get(idNum)
+		if errors.Is(err, deadletter.ErrNotFound) {
+			log.Info("dead letter not found", slog.Uint64("id", idNum))
+			http_serv.RespondWithErr(err, w, r, "not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			log.Error("failed to get dead letter", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		render.JSON(w, r, entry)
+	}
+}
@@ -0,0 +1,74 @@
+package list
+
+import (
+	"net/http"
+	"strconv"
+
+	"log/slog"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/deadletter"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+)
+
+type Meta struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type Response struct {
+	Meta `json:"meta"`
+
+	Messages []deadletter.Entry `json:"messages"`
+}
+
+type deadLetterLister interface {
+	List(offset, limit int) ([]deadletter.Entry, int)
+}
+
+// New lists the dead letters, the requested limit is capped by maxLimit.
+func New(log *slog.Logger, queue deadLetterLister, maxLimit int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "deadletter.list.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		limit := r.URL.Query().Get("limit")
+
+		limitNum, err := strconv.Atoi(limit)
+		if limit == "" || err != nil || limitNum < 0 {
+			log.Info("bad request", slog.Any("limit", limit))
+			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		if maxLimit > 0 && limitNum > maxLimit {
+			limitNum = maxLimit
+		}
+
+		offset := r.URL.Query().Get("offset")
+
+		offsetNum, err := strconv.Atoi(offset)
+		if offset == "" || err != nil || offsetNum < 0 {
+			log.Info("bad request", slog.Any("offset", offset))
+			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		messages, total := queue.List(offsetNum, limitNum)
+
+		render.JSON(w, r, Response{
+			Meta: Meta{
+				Total:  total,
+				Limit:  limitNum,
+				Offset: offsetNum,
+			},
+			Messages: messages,
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package replay
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"log/slog"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/deadletter"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/logger"
+)
+
+type deadLetterReplayer interface {
+	Replay(id uint64) (deadletter.Entry, error)
+}
+
+// New sends the dead letter back to the commands subject, where it is
+// processed from scratch with a fresh attempts counter.
+func New(log *slog.Logger, queue deadLetterReplayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "deadletter.replay.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		id := chi.URLParam(r, "id")
+
+		idNum, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			log.Info("bad request", slog.Any("id", id))
+			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		entry, err := queue.Replay(idNum)
+		if errors.Is(err, deadletter.ErrNotFound) {
+			log.Info("dead letter not found", slog.Uint64("id", idNum))
+			http_serv.RespondWithErr(err, w, r, "not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			log.Error("failed to replay dead letter", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "failed to replay message", http.StatusInternalServerError)
+			return
+		}
+
+		log.Info("dead letter replayed", slog.Uint64("id", idNum))
+
+		render.JSON(w, r, entry)
+	}
+}
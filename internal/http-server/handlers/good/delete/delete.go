@@ -3,7 +3,6 @@ package delete
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net/http"
 	"strconv"
 
@@ -11,7 +10,11 @@ import (
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/clients/redis"
+	"github.com/kldd0/goods-service/internal/errmap"
 	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/auth"
 	"github.com/kldd0/goods-service/internal/logger"
 	"github.com/kldd0/goods-service/internal/storage"
 )
@@ -30,7 +33,11 @@ type cacheInvalidator interface {
 	Delete(ctx context.Context, goodId string) error
 }
 
-func New(log *slog.Logger, db goodDeleter, cache cacheInvalidator) http.HandlerFunc {
+type changePublisher interface {
+	Publish(ev changefeed.Event) changefeed.Event
+}
+
+func New(log *slog.Logger, db goodDeleter, cache cacheInvalidator, feed changePublisher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "good.post.New"
 
@@ -62,7 +69,7 @@ func New(log *slog.Logger, db goodDeleter, cache cacheInvalidator) http.HandlerF
 		err = db.DeleteGood(r.Context(), goodId, projectId)
 		if errors.Is(err, storage.ErrEntryDoesntExist) {
 			log.Info("good doesn't exist")
-			http_serv.RespondWithErr(err, w, r, "good doesn't exist", http.StatusNotFound)
+			http_serv.RespondWithErr(err, w, r, "good doesn't exist", errmap.HTTPStatus(err))
 			return
 		}
 
@@ -77,11 +84,18 @@ func New(log *slog.Logger, db goodDeleter, cache cacheInvalidator) http.HandlerF
 		log.Info("good removed", slog.Int64("id", int64(goodIdNum)))
 
 		// invalidate cache
-		err = cache.Delete(r.Context(), fmt.Sprintf("%s$%s", goodId, projectId))
+		err = cache.Delete(r.Context(), redis.GoodKey(goodId, projectId))
 		if err != nil {
 			log.Error("failed to delete good from cache", logger.Err(err))
 		}
 
+		feed.Publish(changefeed.Event{
+			Type:      changefeed.EventDelete,
+			ProjectId: projectIdNum,
+			GoodId:    goodIdNum,
+			Actor:     auth.SubjectFrom(r.Context()),
+		})
+
 		render.JSON(w, r, resp)
 	}
 }
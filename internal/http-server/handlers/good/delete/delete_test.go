@@ -0,0 +1,127 @@
+package delete_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/clients/redis"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/http-server/handlers/good/delete"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+type fakeStorage struct {
+	err error
+	// deleted are the ids and the project ids of the deleted goods
+	deleted [][2]string
+}
+
+func (s *fakeStorage) DeleteGood(_ context.Context, goodId string, projectId string) error {
+	s.deleted = append(s.deleted, [2]string{goodId, projectId})
+	return s.err
+}
+
+type fakeCache struct {
+	err error
+	// deleted are the invalidated keys
+	deleted []string
+}
+
+func (c *fakeCache) Delete(_ context.Context, key string) error {
+	c.deleted = append(c.deleted, key)
+	return c.err
+}
+
+type fakeFeed struct {
+	events []changefeed.Event
+}
+
+func (f *fakeFeed) Publish(ev changefeed.Event) changefeed.Event {
+	f.events = append(f.events, ev)
+	return ev
+}
+
+func TestDelete(t *testing.T) {
+	cases := []struct {
+		name     string
+		query    string
+		dbErr    error
+		cacheErr error
+		status   int
+		// errMsg is the returned error when failed
+		errMsg  string
+		dbCalls int
+	}{
+		{"delete", "?id=2&projectId=1", nil, nil, http.StatusOK, "", 1},
+		{"cache failure", "?id=2&projectId=1", nil, errors.New("connection refused"), http.StatusOK, "", 1},
+		{"missing", "?id=2&projectId=1", storage.ErrEntryDoesntExist, nil, http.StatusNotFound, "good doesn't exist", 1},
+		{"database failure", "?id=2&projectId=1", errors.New("connection refused"), nil, http.StatusInternalServerError, "failed to delete good", 1},
+		{"invalid id", "?id=x&projectId=1", nil, nil, http.StatusBadRequest, "bad request", 0},
+		{"without project id", "?id=2", nil, nil, http.StatusBadRequest, "bad request", 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &fakeStorage{err: tc.dbErr}
+			cache := &fakeCache{err: tc.cacheErr}
+			feed := &fakeFeed{}
+
+			handler := delete.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, cache, feed)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/good/remove"+tc.query, nil))
+
+			if rec.Code != tc.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+
+			if len(db.deleted) != tc.dbCalls {
+				t.Fatalf("got %d database calls, want %d", len(db.deleted), tc.dbCalls)
+			}
+			if tc.dbCalls > 0 && db.deleted[0] != [2]string{"2", "1"} {
+				t.Errorf("got good %v deleted, want good 2 of project 1", db.deleted[0])
+			}
+
+			if tc.status != http.StatusOK {
+				var resp http_serv.Response
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatalf("decode error: %v", err)
+				}
+				if resp.Status != http_serv.StatusError || resp.Error != tc.errMsg {
+					t.Errorf("got response %+v, want error %q", resp, tc.errMsg)
+				}
+
+				if len(cache.deleted) != 0 || len(feed.events) != 0 {
+					t.Errorf("got invalidated keys %v and events %+v, want none", cache.deleted, feed.events)
+				}
+				return
+			}
+
+			var resp delete.Response
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp != (delete.Response{ID: 2, ProjectId: 1, Removed: true}) {
+				t.Errorf("got response %+v, want good 2 of project 1 removed", resp)
+			}
+
+			if len(cache.deleted) != 1 || cache.deleted[0] != redis.GoodKey("2", "1") {
+				t.Errorf("got invalidated keys %v, want %q", cache.deleted, redis.GoodKey("2", "1"))
+			}
+
+			if len(feed.events) != 1 {
+				t.Fatalf("got %d events, want 1", len(feed.events))
+			}
+			if ev := feed.events[0]; ev.Type != changefeed.EventDelete || ev.GoodId != 2 || ev.ProjectId != 1 {
+				t.Errorf("got event %+v, want the deletion of good 2", ev)
+			}
+		})
+	}
+}
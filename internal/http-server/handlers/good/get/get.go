@@ -3,7 +3,6 @@ package get
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net/http"
 	"strconv"
 
@@ -14,6 +13,7 @@ import (
 	"github.com/go-chi/render"
 	"github.com/kldd0/goods-service/internal/clients/redis"
 	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/errmap"
 	http_serv "github.com/kldd0/goods-service/internal/http-server"
 	"github.com/kldd0/goods-service/internal/logger"
 	"github.com/kldd0/goods-service/internal/storage"
@@ -60,7 +60,7 @@ func New(log *slog.Logger, db goodGetter, cache cacheModifier) http.HandlerFunc
 		// looking for the good in cache
 		// TODO: make correct check for cache response (there are multiple cases)
 		// a more advanced check is needed here
-		key := fmt.Sprintf("%s$%s", goodId, projectId)
+		key := redis.GoodKey(goodId, projectId)
 		requestedGood, err := cache.GetGood(r.Context(), key)
 		if err == nil {
 			log.Info("the good was taken from the cache", slog.String("id", goodId))
@@ -75,7 +75,7 @@ func New(log *slog.Logger, db goodGetter, cache cacheModifier) http.HandlerFunc
 		requestedGood, err = db.GetGood(r.Context(), goodId, projectId)
 		if errors.Is(err, storage.ErrEntryDoesntExist) {
 			log.Info("good not found", slog.String("id", goodId))
-			http_serv.RespondWithErr(err, w, r, "not found", http.StatusNotFound)
+			http_serv.RespondWithErr(err, w, r, "not found", errmap.HTTPStatus(err))
 			return
 		}
 
@@ -1 +1,139 @@
 package get_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/kldd0/goods-service/internal/clients/redis"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/http-server/handlers/good/get"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+type fakeStorage struct {
+	good  models.Good
+	err   error
+	calls int
+}
+
+func (s *fakeStorage) GetGood(context.Context, string, string) (models.Good, error) {
+	s.calls++
+	return s.good, s.err
+}
+
+type fakeCache struct {
+	goods  map[string]models.Good
+	getErr error
+	setErr error
+	// set are the keys of the goods put in the cache
+	set []string
+}
+
+func (c *fakeCache) GetGood(_ context.Context, key string) (models.Good, error) {
+	if c.getErr != nil {
+		return models.Good{}, c.getErr
+	}
+
+	good, ok := c.goods[key]
+	if !ok {
+		return models.Good{}, redis.ErrKeyNotFound
+	}
+
+	return good, nil
+}
+
+func (c *fakeCache) SetGood(_ context.Context, key string, value models.Good) error {
+	c.set = append(c.set, key)
+	if c.setErr != nil {
+		return c.setErr
+	}
+
+	c.goods[key] = value
+
+	return nil
+}
+
+func TestGet(t *testing.T) {
+	stored := models.Good{ID: 1, ProjectId: 1, Name: "stored"}
+	cached := models.Good{ID: 1, ProjectId: 1, Name: "cached"}
+
+	cases := []struct {
+		name   string
+		path   string
+		cached bool
+		dbErr  error
+		getErr error
+		setErr error
+		status int
+		// body is the name of the returned good or the returned error
+		body      string
+		dbCalls   int
+		setsCache bool
+	}{
+		{"cache miss", "/good/1/1", false, nil, nil, nil, http.StatusOK, "stored", 1, true},
+		{"cache hit", "/good/1/1", true, nil, nil, nil, http.StatusOK, "cached", 0, false},
+		{"cache failure", "/good/1/1", true, nil, errors.New("connection refused"), nil, http.StatusOK, "stored", 1, true},
+		{"cache set failure", "/good/1/1", false, nil, nil, errors.New("connection refused"), http.StatusOK, "stored", 1, true},
+		{"not found", "/good/1/1", false, storage.ErrEntryDoesntExist, nil, nil, http.StatusNotFound, "not found", 1, false},
+		{"database failure", "/good/1/1", false, errors.New("connection refused"), nil, nil, http.StatusInternalServerError, "internal error", 1, false},
+		{"invalid id", "/good/x/1", false, nil, nil, nil, http.StatusBadRequest, "bad request", 0, false},
+		{"invalid project id", "/good/1/x", false, nil, nil, nil, http.StatusBadRequest, "bad request", 0, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &fakeStorage{good: stored, err: tc.dbErr}
+			cache := &fakeCache{goods: map[string]models.Good{}, getErr: tc.getErr, setErr: tc.setErr}
+			if tc.cached {
+				cache.goods[redis.GoodKey("1", "1")] = cached
+			}
+
+			router := chi.NewRouter()
+			router.Get("/good/{id}/{projectId}", get.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, cache))
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code != tc.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+
+			if tc.status == http.StatusOK {
+				var good models.Good
+				if err := json.NewDecoder(rec.Body).Decode(&good); err != nil {
+					t.Fatalf("decode good: %v", err)
+				}
+				if good.Name != tc.body {
+					t.Errorf("got good %+v, want %q", good, tc.body)
+				}
+			} else {
+				var resp http_serv.Response
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatalf("decode error: %v", err)
+				}
+				if resp.Status != http_serv.StatusError || resp.Error != tc.body {
+					t.Errorf("got response %+v, want error %q", resp, tc.body)
+				}
+			}
+
+			if db.calls != tc.dbCalls {
+				t.Errorf("got %d database calls, want %d", db.calls, tc.dbCalls)
+			}
+
+			if setsCache := len(cache.set) > 0; setsCache != tc.setsCache {
+				t.Errorf("got the good cached %v, want %v", setsCache, tc.setsCache)
+			}
+			if len(cache.set) > 0 && cache.set[0] != redis.GoodKey("1", "1") {
+				t.Errorf("got the good cached under %q, want %q", cache.set[0], redis.GoodKey("1", "1"))
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package page
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net/http"
 	"strconv"
 
@@ -11,6 +10,7 @@ import (
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/clients/redis"
 	"github.com/kldd0/goods-service/internal/domain/models"
 	http_serv "github.com/kldd0/goods-service/internal/http-server"
 	"github.com/kldd0/goods-service/internal/logger"
@@ -38,7 +38,8 @@ type cacheModifier interface {
 	SetGood(ctx context.Context, key string, value models.Good) error
 }
 
-func New(log *slog.Logger, db goodsGetter, cache cacheModifier) http.HandlerFunc {
+// New lists the goods, the requested limit is capped by maxLimit.
+func New(log *slog.Logger, db goodsGetter, cache cacheModifier, maxLimit int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "good.get.New"
 
@@ -51,23 +52,28 @@ func New(log *slog.Logger, db goodsGetter, cache cacheModifier) http.HandlerFunc
 
 		// check if string id is number
 		limitNum, err := strconv.Atoi(limit)
-		if limit == "" || err != nil {
+		if limit == "" || err != nil || limitNum < 0 {
 			log.Info("bad request", slog.Any("limit", limit))
 			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
 			return
 		}
 
+		if maxLimit > 0 && limitNum > maxLimit {
+			limitNum = maxLimit
+			limit = strconv.Itoa(limitNum)
+		}
+
 		offset := r.URL.Query().Get("offset")
 
 		// check if string id is number
 		offsetNum, err := strconv.Atoi(offset)
-		if offset == "" || err != nil {
+		if offset == "" || err != nil || offsetNum < 0 {
 			log.Info("bad request", slog.Any("offset", offset))
 			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
 			return
 		}
 
-		requestedGoods, err := db.ListGoodsWithPagination(r.Context(), limit, offset)
+		requestedGoods, err := db.ListGoodsWithPagination(r.Context(), offset, limit)
 		if errors.Is(err, storage.ErrEntryDoesntExist) {
 			log.Info("goods not found", slog.Any("limit", limit), slog.Any("offset", offset))
 			render.JSON(w, r, requestedGoods)
@@ -82,10 +88,14 @@ func New(log *slog.Logger, db goodsGetter, cache cacheModifier) http.HandlerFunc
 
 		log.Info("req", slog.Any("goods", requestedGoods))
 
+		if requestedGoods == nil {
+			requestedGoods = []models.Good{}
+		}
+
 		removedCount := 0
 		// add the retrieved goods to the cache
 		for _, good := range requestedGoods {
-			key := fmt.Sprintf("%d$%d", good.ID, good.ProjectId)
+			key := redis.GoodKey(strconv.Itoa(good.ID), strconv.Itoa(good.ProjectId))
 			err = cache.SetGood(r.Context(), key, good)
 			if err != nil {
 				log.Error("failed to set good in cache", logger.Err(err))
@@ -0,0 +1,139 @@
+package page_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/kldd0/goods-service/internal/clients/redis"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/http-server/handlers/good/page"
+)
+
+type fakeStorage struct {
+	goods []models.Good
+	err   error
+	// offset and limit are the page requested from the storage
+	offset, limit string
+	calls         int
+}
+
+func (s *fakeStorage) ListGoodsWithPagination(_ context.Context, offset, limit string) ([]models.Good, error) {
+	s.calls++
+	s.offset, s.limit = offset, limit
+
+	return s.goods, s.err
+}
+
+type fakeCache struct {
+	err error
+	// set are the keys of the goods put in the cache
+	set []string
+}
+
+func (c *fakeCache) SetGood(_ context.Context, key string, _ models.Good) error {
+	c.set = append(c.set, key)
+	return c.err
+}
+
+const maxLimit = 100
+
+func TestPage(t *testing.T) {
+	goods := []models.Good{
+		{ID: 1, ProjectId: 1, Name: "first"},
+		{ID: 2, ProjectId: 2, Name: "second", Removed: true},
+	}
+
+	cases := []struct {
+		name     string
+		query    string
+		goods    []models.Good
+		dbErr    error
+		cacheErr error
+		status   int
+		// errMsg is the returned error when failed
+		errMsg string
+		meta   page.Meta
+		// dbLimit is the limit requested from the storage
+		dbLimit string
+	}{
+		{"list", "?limit=10&offset=5", goods, nil, nil, http.StatusOK, "", page.Meta{Total: 2, Removed: 1, Limit: 10, Offset: 5}, "10"},
+		{"empty", "?limit=10&offset=0", nil, nil, nil, http.StatusOK, "", page.Meta{Limit: 10}, "10"},
+		{"limit capped", "?limit=1000&offset=0", goods, nil, nil, http.StatusOK, "", page.Meta{Total: 2, Removed: 1, Limit: maxLimit}, "100"},
+		{"cache failure", "?limit=10&offset=0", goods, nil, errors.New("connection refused"), http.StatusOK, "", page.Meta{Total: 2, Removed: 1, Limit: 10}, "10"},
+		{"database failure", "?limit=10&offset=0", nil, errors.New("connection refused"), nil, http.StatusInternalServerError, "internal error", page.Meta{}, "10"},
+		{"without limit", "?offset=0", nil, nil, nil, http.StatusBadRequest, "bad request", page.Meta{}, ""},
+		{"negative limit", "?limit=-1&offset=0", nil, nil, nil, http.StatusBadRequest, "bad request", page.Meta{}, ""},
+		{"invalid offset", "?limit=10&offset=x", nil, nil, nil, http.StatusBadRequest, "bad request", page.Meta{}, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &fakeStorage{goods: tc.goods, err: tc.dbErr}
+			cache := &fakeCache{err: tc.cacheErr}
+
+			handler := page.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, cache, maxLimit)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/goods/list"+tc.query, nil))
+
+			if rec.Code != tc.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+
+			if tc.dbLimit == "" && db.calls != 0 {
+				t.Errorf("got %d database calls, want none", db.calls)
+			}
+			if tc.dbLimit != "" && db.limit != tc.dbLimit {
+				t.Errorf("got limit %q requested from the storage, want %q", db.limit, tc.dbLimit)
+			}
+
+			if tc.status != http.StatusOK {
+				var resp http_serv.Response
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatalf("decode error: %v", err)
+				}
+				if resp.Status != http_serv.StatusError || resp.Error != tc.errMsg {
+					t.Errorf("got response %+v, want error %q", resp, tc.errMsg)
+				}
+
+				if len(cache.set) != 0 {
+					t.Errorf("got cached keys %v, want none", cache.set)
+				}
+				return
+			}
+
+			var resp struct {
+				Meta  page.Meta     `json:"meta"`
+				Goods []models.Good `json:"goods"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+
+			if resp.Meta != tc.meta {
+				t.Errorf("got meta %+v, want %+v", resp.Meta, tc.meta)
+			}
+			if resp.Goods == nil || len(resp.Goods) != len(tc.goods) {
+				t.Errorf("got goods %+v, want %d", resp.Goods, len(tc.goods))
+			}
+
+			// every listed good is cached
+			if len(cache.set) != len(tc.goods) {
+				t.Fatalf("got cached keys %v, want %d", cache.set, len(tc.goods))
+			}
+			for i, good := range tc.goods {
+				if want := redis.GoodKey(strconv.Itoa(good.ID), strconv.Itoa(good.ProjectId)); cache.set[i] != want {
+					t.Errorf("got cached key %q, want %q", cache.set[i], want)
+				}
+			}
+		})
+	}
+}
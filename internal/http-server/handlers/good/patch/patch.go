@@ -3,7 +3,6 @@ package patch
 import (
 	"context"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
 	"strconv"
@@ -14,17 +13,22 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator"
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/clients/redis"
 	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/errmap"
 	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/auth"
 	"github.com/kldd0/goods-service/internal/logger"
 	"github.com/kldd0/goods-service/internal/storage"
+	"github.com/kldd0/goods-service/internal/validation"
 )
 
 type goodPatched struct {
-	ID          int       `json:"id" validate:"required"`
-	ProjectId   int       `json:"project_id" validate:"required"`
-	Name        string    `json:"name" validate:"required"`
-	Description string    `json:"description" validate:"required"`
+	ID          int       `json:"id"`
+	ProjectId   int       `json:"project_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
 	Priority    *int      `json:"priority"`
 	Removed     bool      `json:"removed"`
 	CreatedAt   time.Time `json:"created_at"`
@@ -42,7 +46,11 @@ type cacheInvalidator interface {
 	Delete(ctx context.Context, goodId string) error
 }
 
-func New(log *slog.Logger, db goodPatcher, cache cacheInvalidator) http.HandlerFunc {
+type changePublisher interface {
+	Publish(ev changefeed.Event) changefeed.Event
+}
+
+func New(log *slog.Logger, db goodPatcher, cache cacheInvalidator, feed changePublisher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "good.post.New"
 
@@ -77,12 +85,14 @@ func New(log *slog.Logger, db goodPatcher, cache cacheInvalidator) http.HandlerF
 		if errors.Is(err, io.EOF) {
 			// body of request is empty
 			log.Error("request body is empty")
+			render.Status(r, http.StatusBadRequest)
 			render.JSON(w, r, http_serv.Error("empty request"))
 			return
 		}
 
 		if err != nil {
 			log.Error("failed to decode request body", logger.Err(err))
+			render.Status(r, http.StatusBadRequest)
 			render.JSON(w, r, http_serv.Error("failed to decode request"))
 			return
 		}
@@ -91,9 +101,10 @@ func New(log *slog.Logger, db goodPatcher, cache cacheInvalidator) http.HandlerF
 		req.Payload.ProjectId = projectIdNum
 		log.Info("request body decoded", slog.Any("request", req))
 
-		if err := validator.New().Struct(req.Payload); err != nil {
+		if err := validation.PatchedGood(models.Good(req.Payload)); err != nil {
 			validateErr := err.(validator.ValidationErrors)
 			log.Error("invalid request", logger.Err(err))
+			render.Status(r, http.StatusBadRequest)
 			render.JSON(w, r, http_serv.ValidationError(validateErr))
 			return
 		}
@@ -104,7 +115,13 @@ func New(log *slog.Logger, db goodPatcher, cache cacheInvalidator) http.HandlerF
 		good, err := db.PatchGood(r.Context(), models.Good(req.Payload))
 		if errors.Is(err, storage.ErrEntryDoesntExist) {
 			log.Info("good doesn't exist")
-			http_serv.RespondWithErr(err, w, r, "good doesn't exist", http.StatusNotFound)
+			http_serv.RespondWithErr(err, w, r, "good doesn't exist", errmap.HTTPStatus(err))
+			return
+		}
+
+		if errors.Is(err, storage.ErrEntryAlreadyExists) {
+			log.Info("priority is taken", slog.Any("priority", req.Payload.Priority))
+			http_serv.RespondWithErr(err, w, r, "priority is taken", errmap.HTTPStatus(err))
 			return
 		}
 
@@ -119,13 +136,27 @@ func New(log *slog.Logger, db goodPatcher, cache cacheInvalidator) http.HandlerF
 		}
 
 		// invalidate cache
-		err = cache.Delete(r.Context(), fmt.Sprintf("%s$%s", goodId, projectId))
+		err = cache.Delete(r.Context(), redis.GoodKey(goodId, projectId))
 		if err != nil {
 			log.Error("failed to delete good from cache", logger.Err(err))
 		}
 
 		log.Info("good patched", slog.Int64("id", int64(good.ID)))
 
+		// an update that sets the priority moves the good in the project ordering
+		eventType := changefeed.EventUpdate
+		if req.Payload.Priority != nil {
+			eventType = changefeed.EventReprioritize
+		}
+
+		feed.Publish(changefeed.Event{
+			Type:      eventType,
+			ProjectId: projectIdNum,
+			GoodId:    goodIdNum,
+			Good:      &good,
+			Actor:     auth.SubjectFrom(r.Context()),
+		})
+
 		render.JSON(w, r, good)
 	}
 }
@@ -0,0 +1,140 @@
+package patch_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/clients/redis"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/http-server/handlers/good/patch"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+type fakeStorage struct {
+	err   error
+	calls int
+}
+
+func (s *fakeStorage) PatchGood(_ context.Context, good models.Good) (models.Good, error) {
+	s.calls++
+	if s.err != nil {
+		return models.Good{}, s.err
+	}
+
+	if good.Priority == nil {
+		priority := 1
+		good.Priority = &priority
+	}
+
+	return good, nil
+}
+
+type fakeCache struct {
+	err error
+	// deleted are the invalidated keys
+	deleted []string
+}
+
+func (c *fakeCache) Delete(_ context.Context, key string) error {
+	c.deleted = append(c.deleted, key)
+	return c.err
+}
+
+type fakeFeed struct {
+	events []changefeed.Event
+}
+
+func (f *fakeFeed) Publish(ev changefeed.Event) changefeed.Event {
+	f.events = append(f.events, ev)
+	return ev
+}
+
+func TestPatch(t *testing.T) {
+	cases := []struct {
+		name     string
+		query    string
+		body     string
+		dbErr    error
+		cacheErr error
+		status   int
+		// errMsg is the returned error when failed
+		errMsg    string
+		dbCalls   int
+		eventType changefeed.EventType
+	}{
+		{"update", "?id=1&projectId=1", `{"Payload":{"name":"new","description":"new"}}`, nil, nil, http.StatusOK, "", 1, changefeed.EventUpdate},
+		{"reprioritize", "?id=1&projectId=1", `{"Payload":{"name":"new","description":"new","priority":5}}`, nil, nil, http.StatusOK, "", 1, changefeed.EventReprioritize},
+		{"cache failure", "?id=1&projectId=1", `{"Payload":{"name":"new","description":"new"}}`, nil, errors.New("connection refused"), http.StatusOK, "", 1, changefeed.EventUpdate},
+		{"missing", "?id=1&projectId=1", `{"Payload":{"name":"new","description":"new"}}`, storage.ErrEntryDoesntExist, nil, http.StatusNotFound, "good doesn't exist", 1, ""},
+		{"taken priority", "?id=1&projectId=1", `{"Payload":{"name":"new","description":"new","priority":2}}`, storage.ErrEntryAlreadyExists, nil, http.StatusConflict, "priority is taken", 1, ""},
+		{"database failure", "?id=1&projectId=1", `{"Payload":{"name":"new","description":"new"}}`, errors.New("connection refused"), nil, http.StatusInternalServerError, "failed to patch good", 1, ""},
+		{"invalid id", "?id=x&projectId=1", `{"Payload":{"name":"new","description":"new"}}`, nil, nil, http.StatusBadRequest, "bad request", 0, ""},
+		{"invalid project id", "?id=1", `{"Payload":{"name":"new","description":"new"}}`, nil, nil, http.StatusBadRequest, "bad request", 0, ""},
+		{"empty body", "?id=1&projectId=1", ``, nil, nil, http.StatusBadRequest, "empty request", 0, ""},
+		{"without description", "?id=1&projectId=1", `{"Payload":{"name":"new"}}`, nil, nil, http.StatusBadRequest, "field Description is a required field", 0, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &fakeStorage{err: tc.dbErr}
+			cache := &fakeCache{err: tc.cacheErr}
+			feed := &fakeFeed{}
+
+			handler := patch.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, cache, feed)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/good/update"+tc.query, strings.NewReader(tc.body)))
+
+			if rec.Code != tc.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+
+			if db.calls != tc.dbCalls {
+				t.Errorf("got %d database calls, want %d", db.calls, tc.dbCalls)
+			}
+
+			if tc.status != http.StatusOK {
+				var resp http_serv.Response
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatalf("decode error: %v", err)
+				}
+				if resp.Status != http_serv.StatusError || resp.Error != tc.errMsg {
+					t.Errorf("got response %+v, want error %q", resp, tc.errMsg)
+				}
+
+				if len(cache.deleted) != 0 || len(feed.events) != 0 {
+					t.Errorf("got invalidated keys %v and events %+v, want none", cache.deleted, feed.events)
+				}
+				return
+			}
+
+			var good models.Good
+			if err := json.NewDecoder(rec.Body).Decode(&good); err != nil {
+				t.Fatalf("decode good: %v", err)
+			}
+			if good.ID != 1 || good.ProjectId != 1 || good.Name != "new" {
+				t.Errorf("got good %+v, want the patched good 1", good)
+			}
+
+			if len(cache.deleted) != 1 || cache.deleted[0] != redis.GoodKey("1", "1") {
+				t.Errorf("got invalidated keys %v, want %q", cache.deleted, redis.GoodKey("1", "1"))
+			}
+
+			if len(feed.events) != 1 {
+				t.Fatalf("got %d events, want 1", len(feed.events))
+			}
+			if ev := feed.events[0]; ev.Type != tc.eventType || ev.GoodId != 1 || ev.ProjectId != 1 {
+				t.Errorf("got event %+v, want %s of good 1", ev, tc.eventType)
+			}
+		})
+	}
+}
@@ -13,10 +13,14 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator"
+	"github.com/kldd0/goods-service/internal/changefeed"
 	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/errmap"
 	http_server "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/auth"
 	"github.com/kldd0/goods-service/internal/logger"
 	"github.com/kldd0/goods-service/internal/storage"
+	"github.com/kldd0/goods-service/internal/validation"
 )
 
 type Request struct {
@@ -27,7 +31,13 @@ type goodSaver interface {
 	SaveGood(ctx context.Context, good models.Good) (models.Good, error)
 }
 
-func New(log *slog.Logger, db goodSaver) http.HandlerFunc {
+type changePublisher interface {
+	Publish(ev changefeed.Event) changefeed.Event
+}
+
+// New creates the good in the project of the request. The id of the payload
+// is kept when clientIds is set and ignored otherwise.
+func New(log *slog.Logger, db goodSaver, feed changePublisher, clientIds bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "good.post.New"
 
@@ -52,30 +62,42 @@ func New(log *slog.Logger, db goodSaver) http.HandlerFunc {
 		if errors.Is(err, io.EOF) {
 			// body of request is empty
 			log.Error("request body is empty")
+			render.Status(r, http.StatusBadRequest)
 			render.JSON(w, r, http_server.Error("empty request"))
 			return
 		}
 
 		if err != nil {
 			log.Error("failed to decode request body", logger.Err(err))
+			render.Status(r, http.StatusBadRequest)
 			render.JSON(w, r, http_server.Error("failed to decode request"))
 			return
 		}
 
 		req.Payload.ProjectId = projectIdNum
+		if !clientIds {
+			req.Payload.ID = 0
+		}
 		log.Info("request body decoded", slog.Any("request", req))
 
-		if err := validator.New().Struct(req.Payload); err != nil {
+		if err := validation.Good(req.Payload); err != nil {
 			validateErr := err.(validator.ValidationErrors)
 			log.Error("invalid request", logger.Err(err))
+			render.Status(r, http.StatusBadRequest)
 			render.JSON(w, r, http_server.ValidationError(validateErr))
 			return
 		}
 
 		good, err := db.SaveGood(r.Context(), req.Payload)
 		if errors.Is(err, storage.ErrEntryAlreadyExists) {
-			log.Info("good already exists")
-			RespondWithErr(err, w, r, "good already exists", http.StatusConflict)
+			log.Info("good or its priority already exists")
+			RespondWithErr(err, w, r, "good or its priority already exists", errmap.HTTPStatus(err))
+			return
+		}
+
+		if errors.Is(err, storage.ErrEntryDoesntExist) {
+			log.Info("project not found", slog.Int("projectId", projectIdNum))
+			RespondWithErr(err, w, r, "project not found", errmap.HTTPStatus(err))
 			return
 		}
 
@@ -91,6 +113,14 @@ func New(log *slog.Logger, db goodSaver) http.HandlerFunc {
 
 		log.Info("good added", slog.Int64("id", int64(good.ID)))
 
+		feed.Publish(changefeed.Event{
+			Type:      changefeed.EventCreate,
+			ProjectId: good.ProjectId,
+			GoodId:    good.ID,
+			Good:      &good,
+			Actor:     auth.SubjectFrom(r.Context()),
+		})
+
 		render.JSON(w, r, good)
 	}
 }
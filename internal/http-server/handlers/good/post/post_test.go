@@ -0,0 +1,118 @@
+package post_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/http-server/handlers/good/post"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+type fakeStorage struct {
+	err error
+	// saved are the goods passed to the storage
+	saved []models.Good
+}
+
+func (s *fakeStorage) SaveGood(_ context.Context, good models.Good) (models.Good, error) {
+	s.saved = append(s.saved, good)
+	if s.err != nil {
+		return models.Good{}, s.err
+	}
+
+	if good.ID == 0 {
+		good.ID = 7
+	}
+
+	return good, nil
+}
+
+type fakeFeed struct {
+	events []changefeed.Event
+}
+
+func (f *fakeFeed) Publish(ev changefeed.Event) changefeed.Event {
+	f.events = append(f.events, ev)
+	return ev
+}
+
+func TestPost(t *testing.T) {
+	cases := []struct {
+		name      string
+		query     string
+		body      string
+		clientIds bool
+		dbErr     error
+		status    int
+		// id is the id of the created good, the returned error when failed
+		id     int
+		errMsg string
+	}{
+		{"create", "?projectId=1", `{"Payload":{"name":"good"}}`, false, nil, http.StatusOK, 7, ""},
+		{"client id ignored", "?projectId=1", `{"Payload":{"id":3,"name":"good"}}`, false, nil, http.StatusOK, 7, ""},
+		{"client id kept", "?projectId=1", `{"Payload":{"id":3,"name":"good"}}`, true, nil, http.StatusOK, 3, ""},
+		{"taken", "?projectId=1", `{"Payload":{"id":3,"name":"good"}}`, true, storage.ErrEntryAlreadyExists, http.StatusConflict, 0, "good or its priority already exists"},
+		{"missing project", "?projectId=2", `{"Payload":{"name":"good"}}`, false, storage.ErrEntryDoesntExist, http.StatusNotFound, 0, "project not found"},
+		{"database failure", "?projectId=1", `{"Payload":{"name":"good"}}`, false, errors.New("connection refused"), http.StatusInternalServerError, 0, "failed to add good"},
+		{"invalid project id", "?projectId=x", `{"Payload":{"name":"good"}}`, false, nil, http.StatusBadRequest, 0, "bad request"},
+		{"empty body", "?projectId=1", ``, false, nil, http.StatusBadRequest, 0, "empty request"},
+		{"malformed body", "?projectId=1", `{"Payload":`, false, nil, http.StatusBadRequest, 0, "failed to decode request"},
+		{"without name", "?projectId=1", `{"Payload":{}}`, false, nil, http.StatusBadRequest, 0, "field Name is a required field"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &fakeStorage{err: tc.dbErr}
+			feed := &fakeFeed{}
+
+			handler := post.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, feed, tc.clientIds)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/good/create"+tc.query, strings.NewReader(tc.body)))
+
+			if rec.Code != tc.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+
+			if tc.status != http.StatusOK {
+				var resp http_serv.Response
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatalf("decode error: %v", err)
+				}
+				if resp.Status != http_serv.StatusError || resp.Error != tc.errMsg {
+					t.Errorf("got response %+v, want error %q", resp, tc.errMsg)
+				}
+
+				if len(feed.events) != 0 {
+					t.Errorf("got events %+v, want none", feed.events)
+				}
+				return
+			}
+
+			var good models.Good
+			if err := json.NewDecoder(rec.Body).Decode(&good); err != nil {
+				t.Fatalf("decode good: %v", err)
+			}
+			if good.ID != tc.id || good.ProjectId != 1 || good.Name != "good" {
+				t.Errorf("got good %+v, want %q with id %d in project 1", good, "good", tc.id)
+			}
+
+			if len(feed.events) != 1 {
+				t.Fatalf("got %d events, want 1", len(feed.events))
+			}
+			if ev := feed.events[0]; ev.Type != changefeed.EventCreate || ev.GoodId != tc.id || ev.ProjectId != 1 {
+				t.Errorf("got event %+v, want the creation of good %d", ev, tc.id)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"log/slog"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/logger"
+)
+
+// defaultLimit is the number of goods found when no limit is requested
+const defaultLimit = 20
+
+type Meta struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type Response struct {
+	Meta `json:"meta"`
+
+	Goods []models.GoodMatch `json:"goods"`
+}
+
+type goodsSearcher interface {
+	SearchGoods(ctx context.Context, projectId string, query string, offset, limit string) ([]models.GoodMatch, error)
+}
+
+// New finds the goods by the words of their name and description, the best
+// matches first. The words match the longer ones starting with them. The
+// requested limit is capped by maxLimit. The goods of every project are
+// searched when no project is requested, which needs access to all the projects.
+func New(log *slog.Logger, db goodsSearcher, maxLimit int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "good.search.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		query := r.URL.Query()
+
+		text := strings.TrimSpace(query.Get("q"))
+		if text == "" {
+			log.Info("bad request", slog.String("q", text))
+			http_serv.RespondWithErr(nil, w, r, "missing q", http.StatusBadRequest)
+			return
+		}
+
+		projectId := query.Get("projectId")
+		if projectId != "" {
+			if id, err := strconv.Atoi(projectId); err != nil || id <= 0 {
+				log.Info("bad request", slog.String("projectId", projectId))
+				http_serv.RespondWithErr(err, w, r, "invalid projectId", http.StatusBadRequest)
+				return
+			}
+		}
+
+		limit, err := intParam(query.Get("limit"), defaultLimit)
+		if err != nil {
+			log.Info("bad request", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		if maxLimit > 0 && limit > maxLimit {
+			limit = maxLimit
+		}
+
+		offset, err := intParam(query.Get("offset"), 0)
+		if err != nil {
+			log.Info("bad request", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "invalid offset", http.StatusBadRequest)
+			return
+		}
+
+		goods, err := db.SearchGoods(r.Context(), projectId, text, strconv.Itoa(offset), strconv.Itoa(limit))
+		if err != nil {
+			log.Error("failed to search the goods", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		if goods == nil {
+			goods = []models.GoodMatch{}
+		}
+
+		render.JSON(w, r, Response{
+			Meta:  Meta{len(goods), limit, offset},
+			Goods: goods,
+		})
+	}
+}
+
+// intParam parses the non-negative parameter, def when it is empty.
+func intParam(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid parameter %q", value)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,251 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"log/slog"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/gorilla/websocket"
+	"github.com/kldd0/goods-service/internal/changefeed"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/logger"
+)
+
+// eventReset tells the client that some events can't be replayed
+// and the state of the project has to be fetched again
+const eventReset = "reset"
+
+const (
+	// writeWait is the time allowed to write a message to a websocket client
+	writeWait = 10 * time.Second
+
+	defaultHeartbeat = 15 * time.Second
+)
+
+type changeSubscriber interface {
+	Subscribe(projectId int) (<-chan changefeed.Event, func())
+	SubscribeFrom(projectId int, lastID uint64) ([]changefeed.Event, <-chan changefeed.Event, func(), bool)
+}
+
+type subscription struct {
+	missed []changefeed.Event
+	events <-chan changefeed.Event
+	cancel func()
+	reset  bool
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// New streams the changes of the goods of a project. The events are sent as
+// Server-Sent Events, or as JSON messages when the client asks for
+// a WebSocket upgrade.
+func New(log *slog.Logger, feed changeSubscriber, heartbeat time.Duration) http.HandlerFunc {
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeat
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "good.watch.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		projectId := r.URL.Query().Get("projectId")
+
+		// check if string id is number
+		projectIdNum, err := strconv.Atoi(projectId)
+		if projectId == "" || err != nil {
+			log.Info("bad request", slog.Any("projectId", projectId))
+			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		// EventSource sends the header on reconnects, the query parameter
+		// is for the clients that can't set headers
+		lastEventId := r.Header.Get("Last-Event-ID")
+		if lastEventId == "" {
+			lastEventId = r.URL.Query().Get("lastEventId")
+		}
+
+		var sub subscription
+
+		if lastEventId != "" {
+			lastEventIdNum, err := strconv.ParseUint(lastEventId, 10, 64)
+			if err != nil {
+				log.Info("bad request", slog.Any("lastEventId", lastEventId))
+				http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+				return
+			}
+
+			var ok bool
+			sub.missed, sub.events, sub.cancel, ok = feed.SubscribeFrom(projectIdNum, lastEventIdNum)
+			sub.reset = !ok
+		} else {
+			sub.events, sub.cancel = feed.Subscribe(projectIdNum)
+		}
+		defer sub.cancel()
+
+		log.Info("watcher connected", slog.Int("projectId", projectIdNum))
+
+		if websocket.IsWebSocketUpgrade(r) {
+			serveWebSocket(log, w, r, sub, heartbeat)
+		} else {
+			serveSSE(log, w, r, sub, heartbeat)
+		}
+
+		log.Info("watcher disconnected", slog.Int("projectId", projectIdNum))
+	}
+}
+
+func serveSSE(log *slog.Logger, w http.ResponseWriter, r *http.Request, sub subscription, heartbeat time.Duration) {
+	rc := http.NewResponseController(w)
+
+	// the stream outlives the write timeout of the server
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Error("failed to clear write deadline", logger.Err(err))
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(format string, args ...any) bool {
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+
+		return rc.Flush() == nil
+	}
+
+	if !send("retry: %d\n\n", time.Second.Milliseconds()) {
+		return
+	}
+
+	if sub.reset && !send("event: %s\ndata: {}\n\n", eventReset) {
+		return
+	}
+
+	sendEvent := func(ev changefeed.Event) bool {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			log.Error("failed marshalling event", logger.Err(err))
+			return true
+		}
+
+		return send("id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	}
+
+	for _, ev := range sub.missed {
+		if !sendEvent(ev) {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			// comment line keeping proxies from closing an idle connection
+			if !send(": heartbeat\n\n") {
+				return
+			}
+		case ev, ok := <-sub.events:
+			if !ok {
+				// the client fell too far behind, it reconnects
+				// and resumes from the last event it has received
+				return
+			}
+
+			if !sendEvent(ev) {
+				return
+			}
+		}
+	}
+}
+
+func serveWebSocket(log *slog.Logger, w http.ResponseWriter, r *http.Request, sub subscription, heartbeat time.Duration) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already responded to the client
+		log.Info("failed to upgrade connection", logger.Err(err))
+		return
+	}
+	defer conn.Close()
+
+	// the client isn't expected to send anything, reading only
+	// processes control frames and notices the disconnect
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+
+		conn.SetReadLimit(512)
+		_ = conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		})
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(v any) bool {
+		_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+		return conn.WriteJSON(v) == nil
+	}
+
+	if sub.reset && !send(map[string]string{"type": eventReset}) {
+		return
+	}
+
+	for _, ev := range sub.missed {
+		if !send(ev) {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+			if err != nil {
+				return
+			}
+		case ev, ok := <-sub.events:
+			if !ok {
+				_ = conn.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "watcher fell too far behind"),
+					time.Now().Add(writeWait),
+				)
+				return
+			}
+
+			if !send(ev) {
+				return
+			}
+		}
+	}
+}
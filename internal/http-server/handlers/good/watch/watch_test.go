@@ -0,0 +1,312 @@
+package watch_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/http-server/handlers/good/watch"
+)
+
+// countingFeed counts the cancelled subscriptions of the hub
+type countingFeed struct {
+	*changefeed.Hub
+	cancelled atomic.Int32
+}
+
+func (f *countingFeed) Subscribe(projectId int) (<-chan changefeed.Event, func()) {
+	events, cancel := f.Hub.Subscribe(projectId)
+	return events, f.counted(cancel)
+}
+
+func (f *countingFeed) SubscribeFrom(projectId int, lastID uint64) ([]changefeed.Event, <-chan changefeed.Event, func(), bool) {
+	missed, events, cancel, ok := f.Hub.SubscribeFrom(projectId, lastID)
+	return missed, events, f.counted(cancel), ok
+}
+
+func (f *countingFeed) counted(cancel func()) func() {
+	return func() {
+		f.cancelled.Add(1)
+		cancel()
+	}
+}
+
+func newServer(t *testing.T, historySize int, heartbeat time.Duration) (*httptest.Server, *countingFeed) {
+	t.Helper()
+
+	feed := &countingFeed{Hub: changefeed.NewHub(historySize)}
+	srv := httptest.NewServer(watch.New(slog.New(slog.NewTextHandler(io.Discard, nil)), feed, heartbeat))
+	t.Cleanup(srv.Close)
+
+	return srv, feed
+}
+
+func publish(feed *countingFeed, projectId, goodId int) changefeed.Event {
+	return feed.Publish(changefeed.Event{Type: changefeed.EventCreate, ProjectId: projectId, GoodId: goodId})
+}
+
+// sseStream reads the frames of an event stream
+type sseStream struct {
+	t      *testing.T
+	reader *bufio.Reader
+}
+
+func openSSE(t *testing.T, ctx context.Context, url string, lastEventId string) (*sseStream, *http.Response) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return &sseStream{t: t, reader: bufio.NewReader(resp.Body)}, resp
+}
+
+// frame returns the lines of the next frame, the frames end with a blank line
+func (s *sseStream) frame() []string {
+	s.t.Helper()
+
+	var lines []string
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			s.t.Fatalf("read frame: %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+// event reads the next frame as an event
+func (s *sseStream) event() (string, changefeed.Event) {
+	s.t.Helper()
+
+	lines := s.frame()
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "id: ") || !strings.HasPrefix(lines[1], "event: ") {
+		s.t.Fatalf("got frame %q, want an event", lines)
+	}
+
+	var ev changefeed.Event
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &ev); err != nil {
+		s.t.Fatalf("decode event %q: %v", lines[2], err)
+	}
+
+	if id := strings.TrimPrefix(lines[0], "id: "); id != strconv.FormatUint(ev.ID, 10) {
+		s.t.Errorf("got frame id %s, want the event id %d", id, ev.ID)
+	}
+
+	return strings.TrimPrefix(lines[1], "event: "), ev
+}
+
+func TestSSE(t *testing.T) {
+	srv, feed := newServer(t, 16, time.Minute)
+
+	// the events published before the client reconnected
+	first := publish(feed, 1, 1)
+	publish(feed, 2, 2)
+	missed := publish(feed, 1, 3)
+
+	stream, resp := openSSE(t, context.Background(), srv.URL+"?projectId=1", strconv.FormatUint(first.ID, 10))
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("got content type %q, want text/event-stream", ct)
+	}
+
+	if lines := stream.frame(); len(lines) != 1 || lines[0] != "retry: 1000" {
+		t.Fatalf("got first frame %q, want the retry interval", lines)
+	}
+
+	// only the missed event of the project is replayed
+	typ, ev := stream.event()
+	if typ != string(changefeed.EventCreate) || ev.ID != missed.ID || ev.GoodId != 3 {
+		t.Errorf("got %s event %+v, want the missed event %d", typ, ev, missed.ID)
+	}
+
+	// the live events of the other projects are filtered out
+	publish(feed, 2, 4)
+	live := publish(feed, 1, 5)
+
+	if _, ev := stream.event(); ev.ID != live.ID || ev.ProjectId != 1 {
+		t.Errorf("got event %+v, want the live event %d", ev, live.ID)
+	}
+}
+
+func TestSSEReset(t *testing.T) {
+	srv, feed := newServer(t, 2, time.Minute)
+
+	// the events 1..3 are evicted from the buffer of 2
+	for i := 1; i <= 5; i++ {
+		publish(feed, 1, i)
+	}
+
+	stream, _ := openSSE(t, context.Background(), srv.URL+"?projectId=1", "1")
+	stream.frame()
+
+	if lines := stream.frame(); len(lines) != 2 || lines[0] != "event: reset" || lines[1] != "data: {}" {
+		t.Fatalf("got frame %q, want a reset", lines)
+	}
+
+	// the buffered events follow the reset
+	for _, want := range []uint64{4, 5} {
+		if _, ev := stream.event(); ev.ID != want {
+			t.Errorf("got event %d, want %d", ev.ID, want)
+		}
+	}
+}
+
+func TestSSEHeartbeat(t *testing.T) {
+	srv, _ := newServer(t, 1, 10*time.Millisecond)
+
+	stream, _ := openSSE(t, context.Background(), srv.URL+"?projectId=1", "")
+	stream.frame()
+
+	if lines := stream.frame(); len(lines) != 1 || lines[0] != ": heartbeat" {
+		t.Fatalf("got frame %q, want a heartbeat", lines)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	srv, feed := newServer(t, 16, time.Minute)
+
+	first := publish(feed, 1, 1)
+	missed := publish(feed, 1, 2)
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "?projectId=1&lastEventId=" + strconv.FormatUint(first.ID, 10)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var ev changefeed.Event
+	if err := conn.ReadJSON(&ev); err != nil {
+		t.Fatalf("read missed event: %v", err)
+	}
+	if ev.ID != missed.ID {
+		t.Errorf("got event %+v, want the missed event %d", ev, missed.ID)
+	}
+
+	publish(feed, 2, 3)
+	live := publish(feed, 1, 4)
+
+	if err := conn.ReadJSON(&ev); err != nil {
+		t.Fatalf("read live event: %v", err)
+	}
+	if ev.ID != live.ID || ev.ProjectId != 1 {
+		t.Errorf("got event %+v, want the live event %d", ev, live.ID)
+	}
+}
+
+func TestWebSocketReset(t *testing.T) {
+	srv, feed := newServer(t, 1, time.Minute)
+
+	for i := 1; i <= 3; i++ {
+		publish(feed, 1, i)
+	}
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "?projectId=1&lastEventId=1"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var msg map[string]any
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if msg["type"] != "reset" {
+		t.Errorf("got message %v, want a reset", msg)
+	}
+}
+
+func TestUnsubscribeOnDisconnect(t *testing.T) {
+	cases := []struct {
+		name string
+		dial func(t *testing.T, url string) (disconnect func())
+	}{
+		{"sse", func(t *testing.T, url string) func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			stream, _ := openSSE(t, ctx, url, "")
+			stream.frame()
+
+			return cancel
+		}},
+		{"websocket", func(t *testing.T, url string) func() {
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+
+			return func() { conn.Close() }
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, feed := newServer(t, 1, time.Minute)
+
+			disconnect := tc.dial(t, srv.URL+"?projectId=1")
+			if n := feed.cancelled.Load(); n != 0 {
+				t.Fatalf("got %d cancelled subscriptions while connected, want none", n)
+			}
+
+			disconnect()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for feed.cancelled.Load() == 0 {
+				if time.Now().After(deadline) {
+					t.Fatal("the subscription wasn't cancelled after the client disconnected")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestBadRequest(t *testing.T) {
+	srv, _ := newServer(t, 1, time.Minute)
+
+	for _, query := range []string{"", "?projectId=x", "?projectId=1&lastEventId=x"} {
+		resp, err := http.Get(srv.URL + query)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d for %q, want %d", resp.StatusCode, query, http.StatusBadRequest)
+		}
+	}
+}
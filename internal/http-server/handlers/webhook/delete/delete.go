@@ -0,0 +1,68 @@
+package delete
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"log/slog"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/errmap"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/logger"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+type Response struct {
+	ID        int  `json:"id"`
+	ProjectId int  `json:"project_id"`
+	Removed   bool `json:"removed"`
+}
+
+type webhookDeleter interface {
+	DeleteWebhook(ctx context.Context, projectId string, webhookId string) error
+}
+
+func New(log *slog.Logger, db webhookDeleter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "webhook.delete.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		projectId := chi.URLParam(r, "projectId")
+		webhookId := chi.URLParam(r, "webhookId")
+
+		// check if string ids are numbers
+		projectIdNum, projectErr := strconv.Atoi(projectId)
+		webhookIdNum, webhookErr := strconv.Atoi(webhookId)
+		if err := errors.Join(projectErr, webhookErr); err != nil {
+			log.Info("bad request", slog.Any("projectId", projectId), slog.Any("webhookId", webhookId))
+			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		err := db.DeleteWebhook(r.Context(), projectId, webhookId)
+		if errors.Is(err, storage.ErrEntryDoesntExist) {
+			log.Info("webhook doesn't exist")
+			http_serv.RespondWithErr(err, w, r, "webhook doesn't exist", errmap.HTTPStatus(err))
+			return
+		}
+
+		if err != nil {
+			log.Error("failed to delete webhook", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "failed to delete webhook", http.StatusInternalServerError)
+			return
+		}
+
+		log.Info("webhook removed", slog.Int("id", webhookIdNum))
+
+		render.JSON(w, r, Response{webhookIdNum, projectIdNum, true})
+	}
+}
@@ -0,0 +1,115 @@
+package deliveries
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"log/slog"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/errmap"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/logger"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+type Meta struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type Response struct {
+	Meta `json:"meta"`
+
+	Deliveries []models.WebhookDelivery `json:"deliveries"`
+}
+
+type deliveriesGetter interface {
+	GetWebhook(ctx context.Context, projectId string, webhookId string) (models.Webhook, error)
+	ListWebhookDeliveries(ctx context.Context, webhookId string, offset, limit string) ([]models.WebhookDelivery, error)
+}
+
+// New lists the delivery log of the webhook, the latest deliveries first.
+// The requested limit is capped by maxLimit.
+func New(log *slog.Logger, db deliveriesGetter, maxLimit int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "webhook.deliveries.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		projectId := chi.URLParam(r, "projectId")
+		webhookId := chi.URLParam(r, "webhookId")
+
+		// check if string ids are numbers
+		_, projectErr := strconv.Atoi(projectId)
+		_, webhookErr := strconv.Atoi(webhookId)
+		if err := errors.Join(projectErr, webhookErr); err != nil {
+			log.Info("bad request", slog.Any("projectId", projectId), slog.Any("webhookId", webhookId))
+			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		limit := r.URL.Query().Get("limit")
+
+		limitNum, err := strconv.Atoi(limit)
+		if limit == "" || err != nil || limitNum < 0 {
+			log.Info("bad request", slog.Any("limit", limit))
+			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		if maxLimit > 0 && limitNum > maxLimit {
+			limitNum = maxLimit
+		}
+
+		offset := r.URL.Query().Get("offset")
+
+		offsetNum, err := strconv.Atoi(offset)
+		if offset == "" || err != nil || offsetNum < 0 {
+			log.Info("bad request", slog.Any("offset", offset))
+			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		// the deliveries are only listed for a webhook of the project
+		_, err = db.GetWebhook(r.Context(), projectId, webhookId)
+		if errors.Is(err, storage.ErrEntryDoesntExist) {
+			log.Info("webhook doesn't exist")
+			http_serv.RespondWithErr(err, w, r, "webhook doesn't exist", errmap.HTTPStatus(err))
+			return
+		}
+
+		if err != nil {
+			log.Error("failed to get webhook", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		deliveries, err := db.ListWebhookDeliveries(r.Context(), webhookId, strconv.Itoa(offsetNum), strconv.Itoa(limitNum))
+		if err != nil {
+			log.Error("failed to list deliveries", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		if deliveries == nil {
+			deliveries = []models.WebhookDelivery{}
+		}
+
+		render.JSON(w, r, Response{
+			Meta: Meta{
+				Limit:  limitNum,
+				Offset: offsetNum,
+			},
+			Deliveries: deliveries,
+		})
+	}
+}
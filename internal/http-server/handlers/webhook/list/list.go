@@ -0,0 +1,62 @@
+package list
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"log/slog"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/logger"
+)
+
+type Response struct {
+	Webhooks []models.Webhook `json:"webhooks"`
+}
+
+type webhooksGetter interface {
+	ListWebhooks(ctx context.Context, projectId string) ([]models.Webhook, error)
+}
+
+func New(log *slog.Logger, db webhooksGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "webhook.list.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		projectId := chi.URLParam(r, "projectId")
+
+		// check if string id is number
+		if _, err := strconv.Atoi(projectId); err != nil {
+			log.Info("bad request", slog.Any("projectId", projectId))
+			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		webhooks, err := db.ListWebhooks(r.Context(), projectId)
+		if err != nil {
+			log.Error("failed to list webhooks", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		// the secrets are only shown on creation
+		for i := range webhooks {
+			webhooks[i].Secret = ""
+		}
+
+		if webhooks == nil {
+			webhooks = []models.Webhook{}
+		}
+
+		render.JSON(w, r, Response{Webhooks: webhooks})
+	}
+}
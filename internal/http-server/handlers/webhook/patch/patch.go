@@ -0,0 +1,138 @@
+package patch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"log/slog"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/errmap"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/logger"
+	"github.com/kldd0/goods-service/internal/storage"
+	"github.com/kldd0/goods-service/internal/validation"
+)
+
+// webhookPatched holds the fields to change, the omitted ones are kept.
+type webhookPatched struct {
+	URL *string `json:"url"`
+	// Secret rotates the secret of the webhook
+	Secret     *string   `json:"secret"`
+	EventTypes *[]string `json:"event_types"`
+	// Enabled re-enables a disabled webhook, resetting its failures
+	Enabled *bool `json:"enabled"`
+}
+
+type Request struct {
+	Payload webhookPatched `json:"Payload"`
+}
+
+type webhookPatcher interface {
+	GetWebhook(ctx context.Context, projectId string, webhookId string) (models.Webhook, error)
+	PatchWebhook(ctx context.Context, patchedWebhook models.Webhook) (models.Webhook, error)
+}
+
+func New(log *slog.Logger, db webhookPatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "webhook.patch.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		projectId := chi.URLParam(r, "projectId")
+		webhookId := chi.URLParam(r, "webhookId")
+
+		// check if string ids are numbers
+		_, projectErr := strconv.Atoi(projectId)
+		_, webhookErr := strconv.Atoi(webhookId)
+		if err := errors.Join(projectErr, webhookErr); err != nil {
+			log.Info("bad request", slog.Any("projectId", projectId), slog.Any("webhookId", webhookId))
+			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		var req Request
+
+		err := render.DecodeJSON(r.Body, &req)
+		if errors.Is(err, io.EOF) {
+			// body of request is empty
+			log.Error("request body is empty")
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, http_serv.Error("empty request"))
+			return
+		}
+
+		if err != nil {
+			log.Error("failed to decode request body", logger.Err(err))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, http_serv.Error("failed to decode request"))
+			return
+		}
+
+		webhook, err := db.GetWebhook(r.Context(), projectId, webhookId)
+		if errors.Is(err, storage.ErrEntryDoesntExist) {
+			log.Info("webhook doesn't exist")
+			http_serv.RespondWithErr(err, w, r, "webhook doesn't exist", errmap.HTTPStatus(err))
+			return
+		}
+
+		if err != nil {
+			log.Error("failed to get webhook", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "failed to patch webhook", http.StatusInternalServerError)
+			return
+		}
+
+		// an empty secret keeps the current one
+		webhook.Secret = ""
+
+		if req.Payload.URL != nil {
+			webhook.URL = *req.Payload.URL
+		}
+		if req.Payload.Secret != nil {
+			webhook.Secret = *req.Payload.Secret
+		}
+		if req.Payload.EventTypes != nil {
+			webhook.EventTypes = *req.Payload.EventTypes
+		}
+		if req.Payload.Enabled != nil {
+			webhook.Enabled = *req.Payload.Enabled
+		}
+
+		if err := validation.Webhook(webhook); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.Error("invalid request", logger.Err(err))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, http_serv.ValidationError(validateErr))
+			return
+		}
+
+		webhook, err = db.PatchWebhook(r.Context(), webhook)
+		if errors.Is(err, storage.ErrEntryDoesntExist) {
+			log.Info("webhook doesn't exist")
+			http_serv.RespondWithErr(err, w, r, "webhook doesn't exist", errmap.HTTPStatus(err))
+			return
+		}
+
+		if err != nil {
+			log.Error("failed to patch webhook", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "failed to patch webhook", http.StatusInternalServerError)
+			return
+		}
+
+		log.Info("webhook patched", slog.Int("id", webhook.ID))
+
+		webhook.Secret = ""
+
+		render.JSON(w, r, webhook)
+	}
+}
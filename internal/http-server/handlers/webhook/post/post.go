@@ -0,0 +1,121 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"log/slog"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/errmap"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/logger"
+	"github.com/kldd0/goods-service/internal/storage"
+	"github.com/kldd0/goods-service/internal/validation"
+	"github.com/kldd0/goods-service/internal/webhooks"
+)
+
+type newWebhook struct {
+	URL string `json:"url"`
+	// Secret is generated when empty
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+}
+
+type Request struct {
+	Payload newWebhook `json:"Payload"`
+}
+
+type webhookSaver interface {
+	SaveWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error)
+}
+
+// New registers a webhook of the project. The response is the only one
+// holding the secret of the webhook.
+func New(log *slog.Logger, db webhookSaver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "webhook.post.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		projectId := chi.URLParam(r, "projectId")
+
+		// check if string id is number
+		projectIdNum, err := strconv.Atoi(projectId)
+		if err != nil {
+			log.Info("bad request", slog.Any("projectId", projectId))
+			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		var req Request
+
+		err = render.DecodeJSON(r.Body, &req)
+		if errors.Is(err, io.EOF) {
+			// body of request is empty
+			log.Error("request body is empty")
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, http_serv.Error("empty request"))
+			return
+		}
+
+		if err != nil {
+			log.Error("failed to decode request body", logger.Err(err))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, http_serv.Error("failed to decode request"))
+			return
+		}
+
+		webhook := models.Webhook{
+			ProjectId:  projectIdNum,
+			URL:        req.Payload.URL,
+			Secret:     req.Payload.Secret,
+			EventTypes: req.Payload.EventTypes,
+			Enabled:    true,
+		}
+
+		if err := validation.Webhook(webhook); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.Error("invalid request", logger.Err(err))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, http_serv.ValidationError(validateErr))
+			return
+		}
+
+		if webhook.Secret == "" {
+			webhook.Secret, err = webhooks.GenerateSecret()
+			if err != nil {
+				log.Error("failed to generate secret", logger.Err(err))
+				http_serv.RespondWithErr(err, w, r, "failed to add webhook", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		webhook, err = db.SaveWebhook(r.Context(), webhook)
+		if errors.Is(err, storage.ErrEntryDoesntExist) {
+			log.Info("project doesn't exist")
+			http_serv.RespondWithErr(err, w, r, "project doesn't exist", errmap.HTTPStatus(err))
+			return
+		}
+
+		if err != nil {
+			log.Error("failed to add webhook", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "failed to add webhook", http.StatusInternalServerError)
+			return
+		}
+
+		log.Info("webhook added", slog.Int("id", webhook.ID))
+
+		render.JSON(w, r, webhook)
+	}
+}
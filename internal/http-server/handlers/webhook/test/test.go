@@ -0,0 +1,76 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"log/slog"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/errmap"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/logger"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+type webhookGetter interface {
+	GetWebhook(ctx context.Context, projectId string, webhookId string) (models.Webhook, error)
+}
+
+type webhookTester interface {
+	Test(ctx context.Context, webhook models.Webhook) (models.WebhookDelivery, error)
+}
+
+// New sends a test event to the webhook and responds with the delivery,
+// a failed delivery is reported in it rather than with an error status.
+func New(log *slog.Logger, db webhookGetter, tester webhookTester) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "webhook.test.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		projectId := chi.URLParam(r, "projectId")
+		webhookId := chi.URLParam(r, "webhookId")
+
+		// check if string ids are numbers
+		_, projectErr := strconv.Atoi(projectId)
+		_, webhookErr := strconv.Atoi(webhookId)
+		if err := errors.Join(projectErr, webhookErr); err != nil {
+			log.Info("bad request", slog.Any("projectId", projectId), slog.Any("webhookId", webhookId))
+			http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		webhook, err := db.GetWebhook(r.Context(), projectId, webhookId)
+		if errors.Is(err, storage.ErrEntryDoesntExist) {
+			log.Info("webhook doesn't exist")
+			http_serv.RespondWithErr(err, w, r, "webhook doesn't exist", errmap.HTTPStatus(err))
+			return
+		}
+
+		if err != nil {
+			log.Error("failed to get webhook", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		delivery, err := tester.Test(r.Context(), webhook)
+		if err != nil {
+			log.Error("failed to test webhook", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Info("test event sent", slog.Int("id", webhook.ID), slog.Bool("success", delivery.Success))
+
+		render.JSON(w, r, delivery)
+	}
+}
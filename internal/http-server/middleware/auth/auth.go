@@ -0,0 +1,303 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"log/slog"
+
+	"github.com/go-chi/chi"
+	"github.com/kldd0/goods-service/internal/config"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	mwlogger "github.com/kldd0/goods-service/internal/http-server/middleware"
+	"github.com/kldd0/goods-service/internal/logger"
+)
+
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+	// ScopeAdmin grants the operational endpoints of the service
+	ScopeAdmin Scope = "admin"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Claims are the permissions of an authenticated caller.
+type Claims struct {
+	Subject     string
+	Projects    []int
+	AllProjects bool
+	Scopes      []Scope
+}
+
+// Allows reports whether the caller may access the project with the scope,
+// a write scope implies the read one. A zero projectId means a request
+// that isn't limited to a single project, it needs access to all of them.
+func (c Claims) Allows(projectId int, scope Scope) bool {
+	if !slices.Contains(c.Scopes, scope) && !(scope == ScopeRead && slices.Contains(c.Scopes, ScopeWrite)) {
+		return false
+	}
+
+	if c.AllProjects {
+		return true
+	}
+
+	return projectId != 0 && slices.Contains(c.Projects, projectId)
+}
+
+type claimsKey struct{}
+
+// ClaimsFrom returns the claims of the caller authenticated by the middleware.
+func ClaimsFrom(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
+
+// SubjectFrom returns the subject of the authenticated caller, if any.
+func SubjectFrom(ctx context.Context) string {
+	claims, _ := ClaimsFrom(ctx)
+	return claims.Subject
+}
+
+// ClientKey identifies the client by its authenticated subject, its
+// authenticated api key or else by its ip address. The credentials aren't
+// verified when the authentication is disabled, a client could send new ones
+// on every request, so they aren't used then.
+func ClientKey(r *http.Request) string {
+	claims, ok := ClaimsFrom(r.Context())
+	if !ok {
+		return "ip:" + remoteHost(r)
+	}
+
+	if claims.Subject != "" {
+		return "sub:" + claims.Subject
+	}
+
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		// the key itself is a secret, it isn't stored
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+
+	return "ip:" + remoteHost(r)
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return host
+}
+
+type Authenticator struct {
+	log     *slog.Logger
+	enabled bool
+	apiKeys map[string]Claims
+	tokens  *tokenParser
+}
+
+// New creates the authenticator of the config, every caller has full
+// access when it is disabled. The tokens signed with a method whose
+// secret or key set isn't configured are rejected.
+func New(log *slog.Logger, cfg config.Auth) (*Authenticator, error) {
+	const op = "middleware.auth.New"
+
+	a := &Authenticator{
+		log:     log,
+		enabled: cfg.Enabled,
+		apiKeys: make(map[string]Claims, len(cfg.APIKeys)),
+	}
+
+	if !cfg.Enabled {
+		return a, nil
+	}
+
+	for _, key := range cfg.APIKeys {
+		if key.Key == "" {
+			return nil, fmt.Errorf("%s: api key of %q is empty", op, key.Subject)
+		}
+
+		scopes, err := parseScopes(key.Scopes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: api key of %q: %w", op, key.Subject, err)
+		}
+
+		a.apiKeys[key.Key] = Claims{
+			Subject:     key.Subject,
+			Projects:    key.Projects,
+			AllProjects: key.AllProjects,
+			Scopes:      scopes,
+		}
+	}
+
+	tokens, err := newTokenParser(cfg.JWT)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	a.tokens = tokens
+
+	return a, nil
+}
+
+// Authenticate rejects the requests without valid credentials with 401
+// and stores the claims of the caller in the request context.
+// A nil or disabled authenticator lets every request through.
+func (a *Authenticator) Authenticate(next http.Handler) http.Handler {
+	if a == nil || !a.enabled {
+		return next
+	}
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		claims, err := a.authenticate(r)
+		if err != nil {
+			a.log.Info("unauthenticated request", slog.String("url path", r.URL.Path), logger.Err(err))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="goods-service"`)
+			http_serv.RespondWithErr(err, w, r, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		mwlogger.AddAttrs(r.Context(), slog.String("subject", claims.Subject))
+
+		next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// Require rejects with 403 the requests whose caller may not access
+// the project of the request with the scope, and with 400 the requests
+// whose project id is malformed. It has to be registered per route,
+// after the url parameters are known.
+func (a *Authenticator) Require(scope Scope) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if a == nil || !a.enabled {
+			return next
+		}
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFrom(r.Context())
+			if !ok {
+				http_serv.RespondWithErr(ErrNoCredentials, w, r, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			projectId, err := projectIdOf(r)
+			if err != nil {
+				// the project can't be checked, so the request isn't let through
+				http_serv.RespondWithErr(err, w, r, "bad request", http.StatusBadRequest)
+				return
+			}
+
+			if !claims.Allows(projectId, scope) {
+				a.log.Info(
+					"forbidden request",
+					slog.String("subject", claims.Subject),
+					slog.Int("projectId", projectId),
+					slog.String("scope", string(scope)),
+				)
+				http_serv.RespondWithErr(nil, w, r, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Enabled reports whether the calls are authenticated.
+func (a *Authenticator) Enabled() bool {
+	return a != nil && a.enabled
+}
+
+// Credentials authenticates the caller by an api key or, without one,
+// by the value of an Authorization header. It is for the transports other
+// than http, which pass the credentials in their own way.
+func (a *Authenticator) Credentials(apiKey, authorization string) (Claims, error) {
+	if !a.Enabled() {
+		return Claims{}, nil
+	}
+
+	return a.credentials(apiKey, authorization)
+}
+
+// WithClaims returns a copy of ctx carrying the claims of the caller.
+func WithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+func (a *Authenticator) authenticate(r *http.Request) (Claims, error) {
+	return a.credentials(r.Header.Get(apiKeyHeader), r.Header.Get("Authorization"))
+}
+
+func (a *Authenticator) credentials(key, header string) (Claims, error) {
+	if key != "" {
+		for k, claims := range a.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+				return claims, nil
+			}
+		}
+
+		return Claims{}, ErrInvalidCredentials
+	}
+
+	if header == "" {
+		return Claims{}, ErrNoCredentials
+	}
+
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return Claims{}, ErrInvalidCredentials
+	}
+
+	return a.tokens.parse(strings.TrimSpace(token))
+}
+
+// projectIdOf returns the project of the request, taken from the url
+// parameters or the query, or zero for requests not limited to a project.
+func projectIdOf(r *http.Request) (int, error) {
+	projectId := chi.URLParam(r, "projectId")
+	if projectId == "" {
+		projectId = r.URL.Query().Get("projectId")
+	}
+
+	if projectId == "" {
+		return 0, nil
+	}
+
+	return strconv.Atoi(projectId)
+}
+
+func parseScopes(list []string) ([]Scope, error) {
+	scopes := make([]Scope, 0, len(list))
+
+	for _, s := range list {
+		switch scope := Scope(s); scope {
+		case ScopeRead, ScopeWrite, ScopeAdmin:
+			scopes = append(scopes, scope)
+		default:
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+	}
+
+	return scopes, nil
+}
@@ -0,0 +1,217 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kldd0/goods-service/internal/config"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/auth"
+)
+
+const hmacSecret = "secret"
+
+func writeJWKS(t *testing.T, kid string, key *rsa.PublicKey) string {
+	t.Helper()
+
+	set := map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestAuthenticator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), config.Auth{
+		Enabled: true,
+		APIKeys: []config.APIKey{
+			{Key: "reader", Subject: "reader", Projects: []int{1}, Scopes: []string{"read"}},
+			{Key: "admin", Subject: "admin", AllProjects: true, Scopes: []string{"write"}},
+		},
+		JWT: config.JWT{
+			HS256Secret: hmacSecret,
+			JWKSFile:    writeJWKS(t, "k1", &rsaKey.PublicKey),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := chi.NewRouter()
+	router.Use(a.Authenticate)
+	// reached counts the requests let through to the handlers
+	var reached int
+	router.With(a.Require(auth.ScopeRead)).Get("/good/{id}/{projectId}", func(w http.ResponseWriter, r *http.Request) {
+		reached++
+		_, _ = io.WriteString(w, auth.SubjectFrom(r.Context()))
+	})
+	router.With(a.Require(auth.ScopeWrite)).Post("/good/create", func(w http.ResponseWriter, r *http.Request) {
+		reached++
+	})
+	router.With(a.Require(auth.ScopeRead)).Get("/goods/list", func(w http.ResponseWriter, r *http.Request) {
+		reached++
+	})
+
+	exp := time.Now().Add(time.Hour).Unix()
+
+	hsToken := sign(t, jwt.SigningMethodHS256, []byte(hmacSecret), "", jwt.MapClaims{
+		"sub": "hs", "projects": []int{2}, "scope": "read write", "exp": exp,
+	})
+	rsToken := sign(t, jwt.SigningMethodRS256, rsaKey, "k1", jwt.MapClaims{
+		"sub": "rs", "projects": "*", "scope": "read", "exp": exp,
+	})
+	expiredToken := sign(t, jwt.SigningMethodHS256, []byte(hmacSecret), "", jwt.MapClaims{
+		"sub": "hs", "projects": "*", "scope": "read", "exp": time.Now().Add(-time.Hour).Unix(),
+	})
+	forgedToken := sign(t, jwt.SigningMethodHS256, []byte("other"), "", jwt.MapClaims{
+		"sub": "hs", "projects": "*", "scope": "read", "exp": exp,
+	})
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		apiKey string
+		token  string
+		status int
+	}{
+		{"no credentials", http.MethodGet, "/good/1/1", "", "", http.StatusUnauthorized},
+		{"unknown api key", http.MethodGet, "/good/1/1", "nope", "", http.StatusUnauthorized},
+		{"api key of the project", http.MethodGet, "/good/1/1", "reader", "", http.StatusOK},
+		{"api key of another project", http.MethodGet, "/good/1/2", "reader", "", http.StatusForbidden},
+		{"api key without write scope", http.MethodPost, "/good/create?projectId=1", "reader", "", http.StatusForbidden},
+		{"api key limited to a project lists all", http.MethodGet, "/goods/list", "reader", "", http.StatusForbidden},
+		{"write scope implies read", http.MethodGet, "/good/1/5", "admin", "", http.StatusOK},
+		{"hs256 token", http.MethodPost, "/good/create?projectId=2", "", hsToken, http.StatusOK},
+		{"hs256 token of another project", http.MethodPost, "/good/create?projectId=1", "", hsToken, http.StatusForbidden},
+		{"rs256 token of all projects", http.MethodGet, "/goods/list", "", rsToken, http.StatusOK},
+		{"rs256 token without write scope", http.MethodPost, "/good/create?projectId=1", "", rsToken, http.StatusForbidden},
+		{"expired token", http.MethodGet, "/good/1/1", "", expiredToken, http.StatusUnauthorized},
+		{"forged token", http.MethodGet, "/good/1/1", "", forgedToken, http.StatusUnauthorized},
+		{"malformed project id in the path", http.MethodGet, "/good/1/x", "reader", "", http.StatusBadRequest},
+		{"malformed project id in the query", http.MethodPost, "/good/create?projectId=x", "admin", "", http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.apiKey != "" {
+				req.Header.Set("X-API-Key", tc.apiKey)
+			}
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+
+			reached = 0
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Errorf("got status %d, want %d, body: %s", rec.Code, tc.status, rec.Body)
+			}
+
+			// only the allowed requests reach the handlers
+			if want := tc.status == http.StatusOK; (reached > 0) != want {
+				t.Errorf("got the handler reached %d times", reached)
+			}
+		})
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	enabled, err := auth.New(log, config.Auth{
+		Enabled: true,
+		APIKeys: []config.APIKey{{Key: "reader", Subject: "reader", AllProjects: true, Scopes: []string{"read"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled, err := auth.New(log, config.Auth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		authn  *auth.Authenticator
+		apiKey string
+		key    string
+	}{
+		{"anonymous", disabled, "", "ip:10.0.0.1"},
+		// the keys aren't verified, the clients could rotate them to reset their limit
+		{"unverified api key", disabled, "reader", "ip:10.0.0.1"},
+		{"authenticated api key", enabled, "reader", "sub:reader"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var key string
+			handler := tc.authn.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				key = auth.ClientKey(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			if tc.apiKey != "" {
+				req.Header.Set("X-API-Key", tc.apiKey)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if key != tc.key {
+				t.Errorf("got client key %q, want %q", key, tc.key)
+			}
+		})
+	}
+}
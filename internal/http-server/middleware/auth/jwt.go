@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kldd0/goods-service/internal/config"
+)
+
+// allProjects is the value of the projects claim granting access to every project
+const allProjects = "*"
+
+// tokenClaims are the claims of the JWTs accepted by the service:
+//
+//	{"sub": "billing", "projects": [1, 2], "scope": "read write"}
+//
+// projects may also be "*" to access every project.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+
+	Projects projectsClaim `json:"projects"`
+	Scope    string        `json:"scope"`
+}
+
+type projectsClaim struct {
+	all bool
+	ids []int
+}
+
+func (p *projectsClaim) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if s != allProjects {
+			return fmt.Errorf("unknown projects value %q", s)
+		}
+
+		p.all = true
+		return nil
+	}
+
+	return json.Unmarshal(data, &p.ids)
+}
+
+type tokenParser struct {
+	hmacSecret []byte
+	rsaKeys    map[string]*rsa.PublicKey
+	parser     *jwt.Parser
+}
+
+func newTokenParser(cfg config.JWT) (*tokenParser, error) {
+	p := &tokenParser{}
+
+	var methods []string
+
+	if cfg.HS256Secret != "" {
+		p.hmacSecret = []byte(cfg.HS256Secret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	if cfg.JWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+
+		p.rsaKeys = keys
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+	}
+
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+
+	p.parser = jwt.NewParser(opts...)
+
+	return p, nil
+}
+
+func (p *tokenParser) parse(raw string) (Claims, error) {
+	if p.hmacSecret == nil && p.rsaKeys == nil {
+		return Claims{}, ErrInvalidCredentials
+	}
+
+	var tc tokenClaims
+
+	_, err := p.parser.ParseWithClaims(raw, &tc, p.key)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	if tc.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+
+	scopes, err := parseScopes(strings.Fields(tc.Scope))
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	return Claims{
+		Subject:     tc.Subject,
+		Projects:    tc.Projects.ids,
+		AllProjects: tc.Projects.all,
+		Scopes:      scopes,
+	}, nil
+}
+
+// key returns the key verifying the signature of the token,
+// the signing method was already checked by the parser.
+func (p *tokenParser) key(token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		return p.hmacSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := p.rsaKeys[kid]; ok {
+		return key, nil
+	}
+
+	// a token without kid is accepted when there is a single key
+	if kid == "" && len(p.rsaKeys) == 1 {
+		for _, key := range p.rsaKeys {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// loadJWKS reads the RSA public keys of a JSON Web Key Set file by their ids.
+func loadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading jwks file: %w", err)
+	}
+
+	var set jwks
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing jwks file: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("decoding modulus of key %q: %w", k.Kid, err)
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("decoding exponent of key %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("jwks file has no RSA signing keys")
+	}
+
+	return keys, nil
+}
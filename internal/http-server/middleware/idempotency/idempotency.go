@@ -0,0 +1,276 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"log/slog"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/kldd0/goods-service/internal/clients/redis"
+	"github.com/kldd0/goods-service/internal/config"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/auth"
+	"github.com/kldd0/goods-service/internal/logger"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	maxBodySize  = 1 << 20
+
+	pollInterval = 50 * time.Millisecond
+)
+
+const (
+	stateProcessing = "processing"
+	stateDone       = "done"
+)
+
+type Store interface {
+	ReserveIdempotencyKey(ctx context.Context, key string, record []byte, ttl time.Duration) (bool, error)
+	GetIdempotencyRecord(ctx context.Context, key string) ([]byte, error)
+	SaveIdempotencyRecord(ctx context.Context, key string, record []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+type record struct {
+	State       string `json:"state"`
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+type Keeper struct {
+	log   *slog.Logger
+	store Store
+	cfg   config.Idempotency
+}
+
+// New creates a keeper replaying the responses for cfg.TTL. The key of a
+// request whose replica crashed while processing it is freed after
+// cfg.LockTTL, and a retry waits cfg.WaitTimeout for the first response.
+func New(log *slog.Logger, store Store, cfg config.Idempotency) *Keeper {
+	return &Keeper{
+		log:   log,
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// Handle makes the requests carrying an Idempotency-Key header idempotent:
+// the first response for a key of a client within a project is stored and
+// replayed on the retries. A retry with a different request gets 422 and a
+// retry arriving while the first request is processed waits for its response.
+// Server errors, panics and responses without a status aren't stored, so the
+// request may be retried with the same key.
+// A nil Keeper passes the requests through.
+func (k *Keeper) Handle(next http.Handler) http.Handler {
+	if k == nil {
+		return next
+	}
+
+	log, store, cfg := k.log, k.store, k.cfg
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		const op = "middleware.idempotency"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		key := r.Header.Get(Header)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxKeyLength {
+			log.Info("bad request", slog.Int("key length", len(key)))
+			http_serv.RespondWithErr(nil, w, r, "idempotency key is too long", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+		if err != nil {
+			log.Error("failed to read request body", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "failed to read request", http.StatusBadRequest)
+			return
+		}
+
+		if len(body) > maxBodySize {
+			http_serv.RespondWithErr(nil, w, r, "request is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		recordKey := storeKey(r, key)
+		fingerprint := fingerprint(r, body)
+
+		rec, reserved, err := reserve(r.Context(), store, recordKey, fingerprint, cfg)
+		if err != nil {
+			log.Error("idempotency store error", logger.Err(err))
+			http_serv.RespondWithErr(err, w, r, "idempotency store is unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		if !reserved {
+			replay(log, w, r, rec, fingerprint)
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		respBody := &bytes.Buffer{}
+		ww.Tee(respBody)
+
+		// the response is stored even if the client has gone away meanwhile
+		ctx := context.WithoutCancel(r.Context())
+
+		// completed stays false when the handler panics, the recoverer
+		// further up responds with 500 after this has run
+		completed := false
+
+		defer func() {
+			if !completed || ww.Status() == 0 || ww.Status() >= http.StatusInternalServerError {
+				if err := store.Delete(ctx, recordKey); err != nil {
+					log.Error("failed to release idempotency key", logger.Err(err))
+				}
+				return
+			}
+
+			data, err := json.Marshal(record{
+				State:       stateDone,
+				Fingerprint: fingerprint,
+				Status:      ww.Status(),
+				ContentType: ww.Header().Get("Content-Type"),
+				Body:        respBody.Bytes(),
+			})
+			if err != nil {
+				log.Error("failed marshalling idempotency record", logger.Err(err))
+				return
+			}
+
+			if err := store.SaveIdempotencyRecord(ctx, recordKey, data, cfg.TTL); err != nil {
+				log.Error("failed to save idempotency record", logger.Err(err))
+			}
+		}()
+
+		next.ServeHTTP(ww, r)
+		completed = true
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// reserve stores a processing record under the key. When the key is taken
+// by a request being processed it waits for its response, and returns the
+// stored record.
+func reserve(ctx context.Context, store Store, key, fingerprint string, cfg config.Idempotency) (record, bool, error) {
+	processing, err := json.Marshal(record{
+		State:       stateProcessing,
+		Fingerprint: fingerprint,
+	})
+	if err != nil {
+		return record{}, false, fmt.Errorf("marshalling record: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.WaitTimeout)
+	defer cancel()
+
+	for {
+		// the lock ttl frees the key of a request whose replica has crashed
+		ok, err := store.ReserveIdempotencyKey(ctx, key, processing, cfg.LockTTL)
+		if err != nil {
+			return record{}, false, err
+		}
+
+		if ok {
+			return record{}, true, nil
+		}
+
+		data, err := store.GetIdempotencyRecord(ctx, key)
+		if errors.Is(err, redis.ErrKeyNotFound) {
+			// released meanwhile, try to take it again
+			continue
+		}
+
+		if err != nil {
+			return record{}, false, err
+		}
+
+		var rec record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return record{}, false, fmt.Errorf("unmarshalling record: %w", err)
+		}
+
+		if rec.State == stateDone || rec.Fingerprint != fingerprint {
+			return rec, false, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			// still processing, reported to the client as a conflict
+			return rec, false, nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func replay(log *slog.Logger, w http.ResponseWriter, r *http.Request, rec record, fingerprint string) {
+	if rec.Fingerprint != fingerprint {
+		log.Info("idempotency key reused with a different request")
+		http_serv.RespondWithErr(nil, w, r, "idempotency key was used for a different request", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if rec.State != stateDone {
+		log.Info("request with the idempotency key is still processed")
+		http_serv.RespondWithErr(nil, w, r, "request with the idempotency key is in progress", http.StatusConflict)
+		return
+	}
+
+	log.Info("replaying stored response", slog.Int("status", rec.Status))
+
+	if rec.ContentType != "" {
+		w.Header().Set("Content-Type", rec.ContentType)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	_, _ = w.Write(rec.Body)
+}
+
+// storeKey scopes the key to the caller and the project of the request.
+func storeKey(r *http.Request, key string) string {
+	projectId := chi.URLParam(r, "projectId")
+	if projectId == "" {
+		projectId = r.URL.Query().Get("projectId")
+	}
+
+	sum := sha256.Sum256([]byte(key))
+
+	return fmt.Sprintf("idempotency:%s:%s:%s", auth.SubjectFrom(r.Context()), projectId, hex.EncodeToString(sum[:]))
+}
+
+// fingerprint identifies the request sent with the key.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+
+	_, _ = io.WriteString(h, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+"\n")
+	_, _ = h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,229 @@
+package idempotency_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kldd0/goods-service/internal/clients/redis"
+	"github.com/kldd0/goods-service/internal/config"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/idempotency"
+)
+
+type fakeStore struct {
+	mu      sync.Mutex
+	records map[string][]byte
+}
+
+func (s *fakeStore) ReserveIdempotencyKey(_ context.Context, key string, record []byte, _ time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[key]; ok {
+		return false, nil
+	}
+
+	s.records[key] = record
+
+	return true, nil
+}
+
+func (s *fakeStore) GetIdempotencyRecord(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if !ok {
+		return nil, redis.ErrKeyNotFound
+	}
+
+	return record, nil
+}
+
+func (s *fakeStore) SaveIdempotencyRecord(_ context.Context, key string, record []byte, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[key] = record
+
+	return nil
+}
+
+func (s *fakeStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+
+	return nil
+}
+
+func newHandler(status int, delay time.Duration, calls *atomic.Int32) http.Handler {
+	cfg := config.Idempotency{
+		TTL:         time.Hour,
+		LockTTL:     time.Minute,
+		WaitTimeout: time.Second,
+	}
+
+	keeper := idempotency.New(slog.New(slog.NewTextHandler(io.Discard, nil)), &fakeStore{records: map[string][]byte{}}, cfg)
+
+	return keeper.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		time.Sleep(delay)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, `{"call":`+strconv.Itoa(int(n))+`}`)
+	}))
+}
+
+func do(h http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/good/create?projectId=1", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(idempotency.Header, key)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestReplay(t *testing.T) {
+	var calls atomic.Int32
+	h := newHandler(http.StatusOK, 0, &calls)
+
+	first := do(h, "key", `{"name":"good"}`)
+	second := do(h, "key", `{"name":"good"}`)
+
+	if calls.Load() != 1 {
+		t.Fatalf("handler called %d times, want 1", calls.Load())
+	}
+
+	if second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Errorf("replayed %d %q, want %d %q", second.Code, second.Body, first.Code, first.Body)
+	}
+
+	if second.Header().Get(idempotency.ReplayedHeader) != "true" {
+		t.Error("replayed response isn't marked")
+	}
+
+	if first.Header().Get(idempotency.ReplayedHeader) != "" {
+		t.Error("first response is marked as replayed")
+	}
+}
+
+func TestDifferentRequest(t *testing.T) {
+	var calls atomic.Int32
+	h := newHandler(http.StatusOK, 0, &calls)
+
+	do(h, "key", `{"name":"good"}`)
+
+	if rec := do(h, "key", `{"name":"other"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestWithoutKey(t *testing.T) {
+	var calls atomic.Int32
+	h := newHandler(http.StatusOK, 0, &calls)
+
+	do(h, "", `{"name":"good"}`)
+	do(h, "", `{"name":"good"}`)
+
+	if calls.Load() != 2 {
+		t.Errorf("handler called %d times, want 2", calls.Load())
+	}
+}
+
+func TestServerErrorIsNotStored(t *testing.T) {
+	var calls atomic.Int32
+	h := newHandler(http.StatusInternalServerError, 0, &calls)
+
+	do(h, "key", `{"name":"good"}`)
+	do(h, "key", `{"name":"good"}`)
+
+	if calls.Load() != 2 {
+		t.Errorf("handler called %d times, want 2", calls.Load())
+	}
+}
+
+func TestPanicIsNotStored(t *testing.T) {
+	keeper := idempotency.New(slog.New(slog.NewTextHandler(io.Discard, nil)), &fakeStore{records: map[string][]byte{}}, config.Idempotency{
+		TTL:         time.Hour,
+		LockTTL:     time.Minute,
+		WaitTimeout: time.Second,
+	})
+
+	var calls atomic.Int32
+	handler := keeper.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			panic("boom")
+		case 2:
+			w.WriteHeader(http.StatusOK)
+			panic("boom")
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	// recovers like the recoverer of the router
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if recover() != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}()
+
+		handler.ServeHTTP(w, r)
+	})
+
+	// the key is released after the panics, whether a status was written
+	// or not, the retries run the handler again
+	do(h, "key", `{"name":"good"}`)
+	do(h, "key", `{"name":"good"}`)
+	if rec := do(h, "key", `{"name":"good"}`); rec.Code != http.StatusCreated {
+		t.Errorf("got status %d for the retry, want %d", rec.Code, http.StatusCreated)
+	}
+
+	if calls.Load() != 3 {
+		t.Errorf("handler called %d times, want 3", calls.Load())
+	}
+}
+
+func TestConcurrentRetries(t *testing.T) {
+	var calls atomic.Int32
+	h := newHandler(http.StatusOK, 100*time.Millisecond, &calls)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i] = do(h, "key", `{"name":"good"}`).Body.String()
+		}(i)
+	}
+
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("handler called %d times, want 1", calls.Load())
+	}
+
+	for _, body := range bodies {
+		if body != bodies[0] {
+			t.Errorf("got %q, want %q", body, bodies[0])
+		}
+	}
+}
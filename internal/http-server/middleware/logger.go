@@ -1,26 +1,58 @@
 package logger
 
 import (
+	"context"
 	"net/http"
+	"sync"
 	"time"
 
 	"log/slog"
 )
 
+type attrsKey struct{}
+
+// attrs collects the attributes added to the request log line
+// by the middlewares and handlers down the chain
+type attrs struct {
+	mu   sync.Mutex
+	list []slog.Attr
+}
+
+// AddAttrs adds attributes to the log line of the request.
+func AddAttrs(ctx context.Context, list ...slog.Attr) {
+	a, ok := ctx.Value(attrsKey{}).(*attrs)
+	if !ok {
+		return
+	}
+
+	a.mu.Lock()
+	a.list = append(a.list, list...)
+	a.mu.Unlock()
+}
+
 func New(log *slog.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			startTime := time.Now()
 
-			next.ServeHTTP(w, r)
+			extra := &attrs{}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), attrsKey{}, extra)))
 
-			log.Info(
-				"mw info",
+			args := []any{
 				slog.Any("method", r.Method),
 				slog.Any("url path", r.URL.Path),
 				slog.Any("remote addr", r.RemoteAddr),
 				slog.Any("duration", time.Since(startTime).String()),
-			)
+			}
+
+			extra.mu.Lock()
+			for _, attr := range extra.list {
+				args = append(args, attr)
+			}
+			extra.mu.Unlock()
+
+			log.Info("mw info", args...)
 		}
 
 		return http.HandlerFunc(fn)
@@ -0,0 +1,103 @@
+package primary
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/auth"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+// sweepInterval is how often the expired pins are dropped
+const sweepInterval = time.Minute
+
+// Pinner sends the reads of a client to the primary database for a while
+// after its write, so that the client reads its own writes however far the
+// replicas lag behind. The pins are kept in the memory of the process, so a
+// client is only pinned on the instance of the service it wrote through.
+// The goods read from a lagging replica by the other clients may still be
+// cached until the cache entry expires.
+type Pinner struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	pins      map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New creates a pinner keeping the clients on the primary for the window
+// after their writes, it is nil when the window isn't positive.
+func New(window time.Duration) *Pinner {
+	if window <= 0 {
+		return nil
+	}
+
+	return &Pinner{
+		window:    window,
+		pins:      make(map[string]time.Time),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Pin marks the requests of the pinned clients to read from the primary and
+// pins the clients whose write requests succeed. A nil Pinner passes the
+// requests through.
+func (p *Pinner) Pin(next http.Handler) http.Handler {
+	if p == nil {
+		return next
+	}
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		key := auth.ClientKey(r)
+
+		if p.pinned(key) {
+			r = r.WithContext(storage.WithPrimary(r.Context()))
+		}
+
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		// the failed requests are assumed to have written nothing
+		if ww.Status() < http.StatusBadRequest {
+			p.pin(key)
+		}
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func (p *Pinner) pinned(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	until, ok := p.pins[key]
+
+	return ok && p.now().Before(until)
+}
+
+func (p *Pinner) pin(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+
+	if now.Sub(p.lastSweep) > sweepInterval {
+		for k, until := range p.pins {
+			if !now.Before(until) {
+				delete(p.pins, k)
+			}
+		}
+		p.lastSweep = now
+	}
+
+	p.pins[key] = now.Add(p.window)
+}
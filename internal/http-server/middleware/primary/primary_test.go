@@ -0,0 +1,81 @@
+package primary_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kldd0/goods-service/internal/http-server/middleware/primary"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+// serve sends the request of the client to a handler responding with status
+// and reports whether the handler was asked to read from the primary.
+func serve(t *testing.T, p *primary.Pinner, method, client string, status int) bool {
+	t.Helper()
+
+	var onPrimary bool
+	handler := p.Pin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		onPrimary = storage.PrimaryRequired(r.Context())
+		w.WriteHeader(status)
+	}))
+
+	// the clients are told apart by their address without authentication
+	r := httptest.NewRequest(method, "/good/1/1", nil)
+	r.RemoteAddr = client + ":1234"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	return onPrimary
+}
+
+func TestPinAfterWrite(t *testing.T) {
+	p := primary.New(time.Hour)
+
+	if serve(t, p, http.MethodGet, "10.0.0.1", http.StatusOK) {
+		t.Fatal("read before any write went to the primary")
+	}
+
+	serve(t, p, http.MethodPatch, "10.0.0.1", http.StatusOK)
+
+	if !serve(t, p, http.MethodGet, "10.0.0.1", http.StatusOK) {
+		t.Error("read after the write didn't go to the primary")
+	}
+	if serve(t, p, http.MethodGet, "10.0.0.2", http.StatusOK) {
+		t.Error("read of another client went to the primary")
+	}
+}
+
+func TestFailedWriteDoesntPin(t *testing.T) {
+	p := primary.New(time.Hour)
+
+	serve(t, p, http.MethodPost, "10.0.0.1", http.StatusConflict)
+
+	if serve(t, p, http.MethodGet, "10.0.0.1", http.StatusOK) {
+		t.Error("read after a failed write went to the primary")
+	}
+}
+
+func TestPinExpires(t *testing.T) {
+	p := primary.New(20 * time.Millisecond)
+
+	serve(t, p, http.MethodDelete, "10.0.0.1", http.StatusOK)
+	time.Sleep(40 * time.Millisecond)
+
+	if serve(t, p, http.MethodGet, "10.0.0.1", http.StatusOK) {
+		t.Error("read after the window went to the primary")
+	}
+}
+
+func TestNilPinner(t *testing.T) {
+	p := primary.New(0)
+	if p != nil {
+		t.Fatal("pinner without window isn't nil")
+	}
+
+	serve(t, p, http.MethodPost, "10.0.0.1", http.StatusOK)
+
+	if serve(t, p, http.MethodGet, "10.0.0.1", http.StatusOK) {
+		t.Error("nil pinner sent the read to the primary")
+	}
+}
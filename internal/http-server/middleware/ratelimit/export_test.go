@@ -0,0 +1,8 @@
+package ratelimit
+
+import "time"
+
+// SetClock replaces the clock of the store.
+func (s *MemoryStore) SetClock(now func() time.Time) {
+	s.now = now
+}
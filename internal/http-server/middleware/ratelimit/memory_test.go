@@ -0,0 +1,50 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kldd0/goods-service/internal/http-server/middleware/ratelimit"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+
+	s := ratelimit.NewMemoryStore()
+	s.SetClock(func() time.Time { return now })
+
+	// the steps share the bucket of 3 tokens refilled with 2 tokens per second
+	steps := []struct {
+		name    string
+		elapsed time.Duration
+		allowed bool
+		tokens  float64
+	}{
+		{"full bucket", 0, true, 2},
+		{"burst", 0, true, 1},
+		{"last token", 0, true, 0},
+		{"empty bucket", 0, false, 0},
+		{"partial refill", 250 * time.Millisecond, false, 0.5},
+		{"refilled token", 250 * time.Millisecond, true, 0},
+		{"refill capped at burst", time.Hour, true, 2},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.elapsed)
+
+		allowed, tokens, err := s.TakeToken(context.Background(), "key", 2, 3)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		if allowed != step.allowed || tokens != step.tokens {
+			t.Errorf("%s: got allowed %v with %v tokens, want %v with %v", step.name, allowed, tokens, step.allowed, step.tokens)
+		}
+	}
+
+	// the other keys have their own buckets
+	if allowed, tokens, _ := s.TakeToken(context.Background(), "other", 2, 3); !allowed || tokens != 2 {
+		t.Errorf("got allowed %v with %v tokens for another key, want a full bucket", allowed, tokens)
+	}
+}
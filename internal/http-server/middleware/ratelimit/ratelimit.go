@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"log/slog"
+
+	"github.com/kldd0/goods-service/internal/config"
+	http_serv "github.com/kldd0/goods-service/internal/http-server"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/auth"
+	"github.com/kldd0/goods-service/internal/logger"
+)
+
+// storeTimeout bounds the calls to the shared store made on every request
+const storeTimeout = 100 * time.Millisecond
+
+// Store keeps the token buckets.
+type Store interface {
+	TakeToken(ctx context.Context, key string, rate float64, burst int) (bool, float64, error)
+}
+
+type Limiter struct {
+	log      *slog.Logger
+	store    Store
+	fallback *MemoryStore
+	groups   map[string]config.Limit
+}
+
+// New creates a limiter keeping the buckets in store, which is shared by the
+// replicas of the service. The buckets are kept in memory while the store
+// is unavailable, or always when store is nil. The routes of a group
+// without a limit aren't limited.
+func New(log *slog.Logger, store Store, groups map[string]config.Limit) *Limiter {
+	return &Limiter{
+		log:      log,
+		store:    store,
+		fallback: NewMemoryStore(),
+		groups:   groups,
+	}
+}
+
+// Limit limits the rate of the requests of every client to the routes of
+// the group, rejecting the requests over the limit with 429. A nil limiter
+// or a group without configured limit lets every request through.
+func (l *Limiter) Limit(group string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+
+		limit, ok := l.groups[group]
+		if !ok || limit.Rate <= 0 || limit.Burst <= 0 {
+			return next
+		}
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := fmt.Sprintf("ratelimit:%s:%s", group, auth.ClientKey(r))
+
+			allowed, tokens := l.take(r.Context(), key, limit)
+
+			remaining := int(math.Floor(tokens))
+			// seconds until the bucket is full again
+			reset := int(math.Ceil((float64(limit.Burst) - tokens) / limit.Rate))
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(reset))
+
+			if !allowed {
+				// seconds until the next token
+				retryAfter := int(math.Ceil((1 - tokens) / limit.Rate))
+
+				l.log.Info("rate limit exceeded", slog.String("group", group), slog.String("url path", r.URL.Path))
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				http_serv.RespondWithErr(nil, w, r, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func (l *Limiter) take(ctx context.Context, key string, limit config.Limit) (bool, float64) {
+	if l.store != nil {
+		ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+		defer cancel()
+
+		allowed, tokens, err := l.store.TakeToken(ctx, key, limit.Rate, limit.Burst)
+		if err == nil {
+			return allowed, tokens
+		}
+
+		l.log.Error("rate limit store failed, using in-memory buckets", logger.Err(err))
+	}
+
+	allowed, tokens, _ := l.fallback.TakeToken(ctx, key, limit.Rate, limit.Burst)
+
+	return allowed, tokens
+}
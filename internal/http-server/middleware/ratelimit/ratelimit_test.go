@@ -0,0 +1,135 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"log/slog"
+
+	"github.com/kldd0/goods-service/internal/config"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/ratelimit"
+)
+
+// failingStore is a shared store that is down
+type failingStore struct {
+	calls atomic.Int32
+}
+
+func (s *failingStore) TakeToken(context.Context, string, float64, int) (bool, float64, error) {
+	s.calls.Add(1)
+	return false, 0, errors.New("connection refused")
+}
+
+func newHandler(store ratelimit.Store, group string) http.Handler {
+	l := ratelimit.New(slog.New(slog.NewTextHandler(io.Discard, nil)), store, map[string]config.Limit{
+		"read":  {Rate: 0.5, Burst: 2},
+		"write": {Rate: 0.5, Burst: 1},
+	})
+
+	return l.Limit(group)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+}
+
+func serve(handler http.Handler, client, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = client + ":1234"
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestLimit(t *testing.T) {
+	handler := newHandler(nil, "read")
+
+	// the bucket of 2 tokens is refilled with a token every 2 seconds
+	steps := []struct {
+		status     int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{http.StatusOK, "1", "2", ""},
+		{http.StatusOK, "0", "4", ""},
+		{http.StatusTooManyRequests, "0", "4", "2"},
+	}
+
+	for i, step := range steps {
+		rec := serve(handler, "10.0.0.1", "")
+
+		if rec.Code != step.status {
+			t.Errorf("request %d: got status %d, want %d", i, rec.Code, step.status)
+		}
+
+		h := rec.Header()
+		if h.Get("RateLimit-Limit") != "2" || h.Get("RateLimit-Remaining") != step.remaining || h.Get("RateLimit-Reset") != step.reset {
+			t.Errorf(
+				"request %d: got limit %q, remaining %q and reset %q, want 2, %s and %s",
+				i, h.Get("RateLimit-Limit"), h.Get("RateLimit-Remaining"), h.Get("RateLimit-Reset"), step.remaining, step.reset,
+			)
+		}
+		if h.Get("Retry-After") != step.retryAfter {
+			t.Errorf("request %d: got retry after %q, want %q", i, h.Get("Retry-After"), step.retryAfter)
+		}
+	}
+
+	// every client has its own bucket
+	if rec := serve(handler, "10.0.0.2", ""); rec.Code != http.StatusOK {
+		t.Errorf("got status %d for another client, want %d", rec.Code, http.StatusOK)
+	}
+
+	// the unverified api keys don't give the client new buckets
+	if rec := serve(handler, "10.0.0.1", "rotated"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d with a new api key, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestLimitGroups(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	read, write := newHandler(store, "read"), newHandler(store, "write")
+
+	if rec := serve(write, "10.0.0.1", ""); rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := serve(write, "10.0.0.1", ""); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d over the limit, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+
+	// the groups share the store but not the buckets
+	if rec := serve(read, "10.0.0.1", ""); rec.Code != http.StatusOK {
+		t.Errorf("got status %d in another group, want %d", rec.Code, http.StatusOK)
+	}
+
+	// the groups without a limit aren't limited
+	unlimited := newHandler(store, "other")
+	for i := 0; i < 5; i++ {
+		if rec := serve(unlimited, "10.0.0.1", ""); rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("got status %d with limit %q in a group without limit", rec.Code, rec.Header().Get("RateLimit-Limit"))
+		}
+	}
+}
+
+func TestLimitFallback(t *testing.T) {
+	store := &failingStore{}
+	handler := newHandler(store, "write")
+
+	// the in-memory buckets keep limiting while the store is down
+	if rec := serve(handler, "10.0.0.1", ""); rec.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := serve(handler, "10.0.0.1", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d over the limit, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+
+	if n := store.calls.Load(); n != 2 {
+		t.Errorf("got %d calls to the store, want every request to try it", n)
+	}
+}
@@ -0,0 +1,190 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"log/slog"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/kldd0/goods-service/internal/analytics"
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/clients/clickhouse"
+	"github.com/kldd0/goods-service/internal/deadletter"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	anedited "github.com/kldd0/goods-service/internal/http-server/handlers/analytics/edited"
+	anevents "github.com/kldd0/goods-service/internal/http-server/handlers/analytics/events"
+	anremovals "github.com/kldd0/goods-service/internal/http-server/handlers/analytics/removals"
+	auditlist "github.com/kldd0/goods-service/internal/http-server/handlers/audit/list"
+	dbstats "github.com/kldd0/goods-service/internal/http-server/handlers/db/stats"
+	dlqget "github.com/kldd0/goods-service/internal/http-server/handlers/deadletter/get"
+	dlqlist "github.com/kldd0/goods-service/internal/http-server/handlers/deadletter/list"
+	dlqreplay "github.com/kldd0/goods-service/internal/http-server/handlers/deadletter/replay"
+	"github.com/kldd0/goods-service/internal/http-server/handlers/good/delete"
+	"github.com/kldd0/goods-service/internal/http-server/handlers/good/get"
+	"github.com/kldd0/goods-service/internal/http-server/handlers/good/page"
+	"github.com/kldd0/goods-service/internal/http-server/handlers/good/patch"
+	"github.com/kldd0/goods-service/internal/http-server/handlers/good/post"
+	"github.com/kldd0/goods-service/internal/http-server/handlers/good/search"
+	"github.com/kldd0/goods-service/internal/http-server/handlers/good/watch"
+	whdelete "github.com/kldd0/goods-service/internal/http-server/handlers/webhook/delete"
+	whdeliveries "github.com/kldd0/goods-service/internal/http-server/handlers/webhook/deliveries"
+	whget "github.com/kldd0/goods-service/internal/http-server/handlers/webhook/get"
+	whlist "github.com/kldd0/goods-service/internal/http-server/handlers/webhook/list"
+	whpatch "github.com/kldd0/goods-service/internal/http-server/handlers/webhook/patch"
+	whpost "github.com/kldd0/goods-service/internal/http-server/handlers/webhook/post"
+	whtest "github.com/kldd0/goods-service/internal/http-server/handlers/webhook/test"
+	mw "github.com/kldd0/goods-service/internal/http-server/middleware"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/auth"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/idempotency"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/primary"
+	"github.com/kldd0/goods-service/internal/http-server/middleware/ratelimit"
+	"github.com/kldd0/goods-service/internal/http-server/openapi"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+type Cache interface {
+	GetGood(ctx context.Context, key string) (models.Good, error)
+	SetGood(ctx context.Context, key string, value models.Good) error
+	Delete(ctx context.Context, key string) error
+}
+
+type DBStats interface {
+	PoolStats() storage.PoolStats
+}
+
+type WebhookTester interface {
+	Test(ctx context.Context, webhook models.Webhook) (models.WebhookDelivery, error)
+}
+
+type Options struct {
+	// SwaggerUI enables the Swagger UI page at /docs
+	SwaggerUI bool
+	// WatchHeartbeat is the interval of keep-alive messages on watch streams
+	WatchHeartbeat time.Duration
+	// Auth authenticates and authorizes the api calls, nil disables it
+	Auth *auth.Authenticator
+	// RateLimiter limits the rate of the api calls per client, nil disables it
+	RateLimiter *ratelimit.Limiter
+	// MaxPageLimit caps the limit of the list requests
+	MaxPageLimit int
+	// ClientIds lets the clients choose the ids of the goods they create
+	ClientIds bool
+	// Idempotency replays the responses of retried create requests, nil disables it
+	Idempotency *idempotency.Keeper
+	// DeadLetters enables the admin endpoints of the dead-lettered commands
+	DeadLetters *deadletter.Queue
+	// Webhooks enables the endpoints of the project webhooks, their test
+	// events are sent by WebhookTester
+	Webhooks      storage.WebhookStorage
+	WebhookTester WebhookTester
+	// Audit enables the query api of the logged changes, nil disables it
+	Audit clickhouse.AuditLog
+	// Analytics enables the reports over the logged changes, nil disables them
+	Analytics *analytics.Service
+	// DBStats enables the admin endpoint of the storage connection pool
+	DBStats DBStats
+	// Primary sends the reads of the clients to the primary database for
+	// a while after their writes, nil disables it
+	Primary *primary.Pinner
+}
+
+// New builds the http router with every route of the service registered.
+func New(log *slog.Logger, db storage.Storage, cache Cache, feed *changefeed.Hub, opts Options) http.Handler {
+	router := chi.NewRouter()
+
+	router.Use(middleware.RequestID)
+	router.Use(middleware.Logger)
+	router.Use(mw.New(log))
+	router.Use(middleware.Recoverer)
+
+	// api documentation, registered outside of the URLFormat middleware
+	// so that the extension of /openapi.json is kept for routing
+	router.Get("/openapi.json", openapi.Handler())
+	if opts.SwaggerUI {
+		router.Get("/docs", openapi.UIHandler("/openapi.json"))
+	}
+
+	router.Mount("/", api(log, db, cache, feed, opts))
+
+	return router
+}
+
+func api(log *slog.Logger, db storage.Storage, cache Cache, feed *changefeed.Hub, opts Options) http.Handler {
+	router := chi.NewRouter()
+
+	router.Use(middleware.URLFormat)
+
+	// healthcheck route
+	router.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+
+		_ = json.NewEncoder(w).Encode(map[string]bool{
+			"pong": true,
+		})
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(opts.Auth.Authenticate)
+		r.Use(opts.Primary.Pin)
+
+		read := chi.Chain(opts.Auth.Require(auth.ScopeRead), opts.RateLimiter.Limit("read"))
+		write := chi.Chain(opts.Auth.Require(auth.ScopeWrite), opts.RateLimiter.Limit("write"))
+		list := chi.Chain(opts.Auth.Require(auth.ScopeRead), opts.RateLimiter.Limit("list"))
+		admin := chi.Chain(opts.Auth.Require(auth.ScopeAdmin))
+
+		r.Route("/good", func(r chi.Router) {
+			r.With(read...).Get("/{id}/{projectId}", get.New(log, db, cache))
+
+			r.With(write...).With(opts.Idempotency.Handle).Post("/create", post.New(log, db, feed, opts.ClientIds))
+			r.With(write...).Patch("/update", patch.New(log, db, cache, feed))
+			r.With(write...).Delete("/remove", delete.New(log, db, cache, feed))
+		})
+
+		r.With(list...).Get("/goods/list", page.New(log, db, cache, opts.MaxPageLimit))
+		r.With(list...).Get("/goods/search", search.New(log, db, opts.MaxPageLimit))
+		r.With(read...).Get("/goods/watch", watch.New(log, feed, opts.WatchHeartbeat))
+
+		if opts.Audit != nil {
+			r.With(list...).Get("/audit", auditlist.New(log, opts.Audit, opts.MaxPageLimit))
+		}
+
+		if opts.Analytics != nil {
+			r.Route("/analytics", func(r chi.Router) {
+				r.With(list...).Get("/events", anevents.New(log, opts.Analytics, opts.MaxPageLimit))
+				r.With(list...).Get("/removals", anremovals.New(log, opts.Analytics, opts.MaxPageLimit))
+				r.With(list...).Get("/most-edited", anedited.New(log, opts.Analytics, opts.MaxPageLimit))
+			})
+		}
+
+		if opts.Webhooks != nil {
+			r.Route("/project/{projectId}/webhooks", func(r chi.Router) {
+				r.With(read...).Get("/", whlist.New(log, opts.Webhooks))
+				r.With(write...).Post("/", whpost.New(log, opts.Webhooks))
+				r.With(read...).Get("/{webhookId}", whget.New(log, opts.Webhooks))
+				r.With(write...).Patch("/{webhookId}", whpatch.New(log, opts.Webhooks))
+				r.With(write...).Delete("/{webhookId}", whdelete.New(log, opts.Webhooks))
+				r.With(read...).Get("/{webhookId}/deliveries", whdeliveries.New(log, opts.Webhooks, opts.MaxPageLimit))
+				r.With(write...).Post("/{webhookId}/test", whtest.New(log, opts.Webhooks, opts.WebhookTester))
+			})
+		}
+
+		if opts.DeadLetters != nil {
+			r.Route("/admin/dlq", func(r chi.Router) {
+				r.With(admin...).Get("/", dlqlist.New(log, opts.DeadLetters, opts.MaxPageLimit))
+				r.With(admin...).Get("/{id}", dlqget.New(log, opts.DeadLetters))
+				r.With(admin...).Post("/{id}/replay", dlqreplay.New(log, opts.DeadLetters))
+			})
+		}
+
+		if opts.DBStats != nil {
+			r.With(admin...).Get("/admin/db/stats", dbstats.New(opts.DBStats))
+		}
+	})
+
+	return router
+}
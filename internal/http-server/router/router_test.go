@@ -0,0 +1,578 @@
+package router_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/go-chi/chi"
+	"github.com/kldd0/goods-service/internal/analytics"
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/clients/clickhouse"
+	"github.com/kldd0/goods-service/internal/clients/redis"
+	"github.com/kldd0/goods-service/internal/deadletter"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/http-server/openapi"
+	"github.com/kldd0/goods-service/internal/http-server/router"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+type fakeStorage struct {
+	mu     sync.Mutex
+	nextId int
+	goods  map[string]models.Good
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{nextId: 1, goods: map[string]models.Good{}}
+}
+
+func key(goodId, projectId string) string {
+	return goodId + "$" + projectId
+}
+
+func (s *fakeStorage) GetGood(_ context.Context, goodId string, projectId string) (models.Good, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	good, ok := s.goods[key(goodId, projectId)]
+	if !ok {
+		return models.Good{}, storage.ErrEntryDoesntExist
+	}
+
+	return good, nil
+}
+
+func (s *fakeStorage) SaveGood(_ context.Context, good models.Good) (models.Good, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if good.ProjectId != 1 {
+		return models.Good{}, storage.ErrEntryDoesntExist
+	}
+
+	if good.ID == 0 {
+		good.ID = s.nextId
+		s.nextId++
+	}
+
+	if _, ok := s.goods[key(strconv.Itoa(good.ID), strconv.Itoa(good.ProjectId))]; ok {
+		return models.Good{}, storage.ErrEntryAlreadyExists
+	}
+
+	if good.Priority == nil {
+		priority := good.ID
+		good.Priority = &priority
+	}
+	good.CreatedAt = time.Now()
+
+	s.goods[key(strconv.Itoa(good.ID), strconv.Itoa(good.ProjectId))] = good
+
+	return good, nil
+}
+
+func (s *fakeStorage) PatchGood(_ context.Context, patchedGood models.Good) (models.Good, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := key(strconv.Itoa(patchedGood.ID), strconv.Itoa(patchedGood.ProjectId))
+
+	good, ok := s.goods[k]
+	if !ok {
+		return models.Good{}, storage.ErrEntryDoesntExist
+	}
+
+	if patchedGood.Priority != nil {
+		for other, taken := range s.goods {
+			if other != k && taken.ProjectId == good.ProjectId && *taken.Priority == *patchedGood.Priority {
+				return models.Good{}, storage.ErrEntryAlreadyExists
+			}
+		}
+
+		good.Priority = patchedGood.Priority
+	}
+
+	good.Name = patchedGood.Name
+	good.Description = patchedGood.Description
+	good.Removed = patchedGood.Removed
+	s.goods[k] = good
+
+	return good, nil
+}
+
+func (s *fakeStorage) DeleteGood(_ context.Context, goodId string, projectId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.goods[key(goodId, projectId)]; !ok {
+		return storage.ErrEntryDoesntExist
+	}
+
+	delete(s.goods, key(goodId, projectId))
+
+	return nil
+}
+
+func (s *fakeStorage) ListGoodsWithPagination(_ context.Context, offset, limit string) ([]models.Good, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var goods []models.Good
+	for _, good := range s.goods {
+		goods = append(goods, good)
+	}
+
+	return goods, nil
+}
+
+func (s *fakeStorage) SearchGoods(_ context.Context, projectId string, query string, offset, limit string) ([]models.GoodMatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matches []models.GoodMatch
+	for _, good := range s.goods {
+		if projectId != "" && strconv.Itoa(good.ProjectId) != projectId {
+			continue
+		}
+
+		if strings.Contains(strings.ToLower(good.Name+" "+good.Description), strings.ToLower(query)) {
+			matches = append(matches, models.GoodMatch{Good: good, Rank: 1, NameHighlight: good.Name})
+		}
+	}
+
+	return matches, nil
+}
+
+func (s *fakeStorage) PoolStats() storage.PoolStats {
+	return storage.PoolStats{MaxConns: 10, TotalConns: 1, IdleConns: 1}
+}
+
+func (s *fakeStorage) GetProject(_ context.Context, projectId string) (models.Project, error) {
+	return models.Project{}, storage.ErrEntryDoesntExist
+}
+
+func (s *fakeStorage) SaveProject(_ context.Context, project models.Project) (models.Project, error) {
+	return project, nil
+}
+
+func (s *fakeStorage) PatchProject(_ context.Context, patchedProject models.Project) (models.Project, error) {
+	return models.Project{}, storage.ErrEntryDoesntExist
+}
+
+func (s *fakeStorage) DeleteProject(_ context.Context, projectId string) error {
+	return storage.ErrEntryDoesntExist
+}
+
+func (s *fakeStorage) ListProjectsWithPagination(_ context.Context, offset, limit string) ([]models.Project, error) {
+	return nil, nil
+}
+
+type fakeCache struct {
+	mu    sync.Mutex
+	goods map[string]models.Good
+}
+
+func (c *fakeCache) GetGood(_ context.Context, key string) (models.Good, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	good, ok := c.goods[key]
+	if !ok {
+		return models.Good{}, redis.ErrKeyNotFound
+	}
+
+	return good, nil
+}
+
+func (c *fakeCache) SetGood(_ context.Context, key string, value models.Good) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.goods[key] = value
+
+	return nil
+}
+
+func (c *fakeCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.goods, key)
+
+	return nil
+}
+
+// fakeWebhooks keeps the webhooks of project 1, the only existing project.
+type fakeWebhooks struct {
+	mu         sync.Mutex
+	webhooks   map[string]models.Webhook
+	deliveries []models.WebhookDelivery
+}
+
+func (s *fakeWebhooks) GetWebhook(_ context.Context, projectId string, webhookId string) (models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, ok := s.webhooks[webhookId]
+	if !ok || strconv.Itoa(webhook.ProjectId) != projectId {
+		return models.Webhook{}, storage.ErrEntryDoesntExist
+	}
+
+	return webhook, nil
+}
+
+func (s *fakeWebhooks) SaveWebhook(_ context.Context, webhook models.Webhook) (models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if webhook.ProjectId != 1 {
+		return models.Webhook{}, storage.ErrEntryDoesntExist
+	}
+
+	webhook.ID = len(s.webhooks) + 1
+	webhook.CreatedAt = time.Now()
+	s.webhooks[strconv.Itoa(webhook.ID)] = webhook
+
+	return webhook, nil
+}
+
+func (s *fakeWebhooks) PatchWebhook(_ context.Context, patchedWebhook models.Webhook) (models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, ok := s.webhooks[strconv.Itoa(patchedWebhook.ID)]
+	if !ok || webhook.ProjectId != patchedWebhook.ProjectId {
+		return models.Webhook{}, storage.ErrEntryDoesntExist
+	}
+
+	if patchedWebhook.Secret == "" {
+		patchedWebhook.Secret = webhook.Secret
+	}
+	s.webhooks[strconv.Itoa(webhook.ID)] = patchedWebhook
+
+	return patchedWebhook, nil
+}
+
+func (s *fakeWebhooks) DeleteWebhook(ctx context.Context, projectId string, webhookId string) error {
+	if _, err := s.GetWebhook(ctx, projectId, webhookId); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.webhooks, webhookId)
+
+	return nil
+}
+
+func (s *fakeWebhooks) ListWebhooks(_ context.Context, projectId string) ([]models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var webhooks []models.Webhook
+	for _, webhook := range s.webhooks {
+		if strconv.Itoa(webhook.ProjectId) == projectId {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+
+	return webhooks, nil
+}
+
+func (s *fakeWebhooks) RecordWebhookResult(context.Context, string, bool, int) (models.Webhook, error) {
+	return models.Webhook{}, nil
+}
+
+func (s *fakeWebhooks) SaveWebhookDelivery(_ context.Context, delivery models.WebhookDelivery) (models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery.ID = len(s.deliveries) + 1
+	delivery.CreatedAt = time.Now()
+	s.deliveries = append(s.deliveries, delivery)
+
+	return delivery, nil
+}
+
+func (s *fakeWebhooks) ListWebhookDeliveries(_ context.Context, webhookId string, _, _ string) ([]models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deliveries []models.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if strconv.Itoa(delivery.WebhookId) == webhookId {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	return deliveries, nil
+}
+
+// fakeTester records a failed delivery of the test event.
+type fakeTester struct {
+	db *fakeWebhooks
+}
+
+func (t fakeTester) Test(ctx context.Context, webhook models.Webhook) (models.WebhookDelivery, error) {
+	return t.db.SaveWebhookDelivery(ctx, models.WebhookDelivery{
+		WebhookId: webhook.ID,
+		EventType: "test",
+		Attempt:   1,
+		Error:     "connection refused",
+	})
+}
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+
+	loader := openapi3.NewLoader()
+
+	doc, err := loader.LoadFromData(openapi.Spec())
+	if err != nil {
+		t.Fatalf("failed loading spec: %v", err)
+	}
+
+	if err := doc.Validate(loader.Context); err != nil {
+		t.Fatalf("invalid spec: %v", err)
+	}
+
+	return doc
+}
+
+// specRouter resolves requests sent to the test server to the documented operations.
+func specRouter(t *testing.T, doc *openapi3.T, serverURL string) routers.Router {
+	t.Helper()
+
+	doc.Servers = openapi3.Servers{{URL: serverURL}}
+
+	r, err := legacy.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("failed creating spec router: %v", err)
+	}
+
+	return r
+}
+
+func decodePlain(body io.Reader, _ http.Header, _ *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (interface{}, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+func newRouter() http.Handler {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	deadLetters := deadletter.NewQueue(func(uint64, []byte) error { return nil })
+	deadLetters.Add(1, deadletter.Message{
+		Subject:  "goods.commands",
+		Sequence: 7,
+		Attempts: 5,
+		Reason:   "connection refused",
+		Data:     []byte(`{"correlation_id":"1","type":"delete","good":{"id":1,"project_id":1}}`),
+		FailedAt: time.Now(),
+	})
+
+	webhooks := &fakeWebhooks{webhooks: map[string]models.Webhook{}}
+
+	description := "desc"
+	audit := clickhouse.NewFake(
+		clickhouse.AuditEntry{GoodId: 1, ProjectId: 1, EventType: "create", Name: "good", Description: &description, EventTime: time.Now().Add(-time.Hour)},
+		clickhouse.AuditEntry{GoodId: 1, ProjectId: 1, EventType: "update", Actor: "admin", Name: "good", EventTime: time.Now().Add(-30 * time.Minute)},
+		clickhouse.AuditEntry{GoodId: 1, ProjectId: 1, EventType: "delete", Actor: "admin", Name: "good", Removed: true, EventTime: time.Now()},
+	)
+
+	db := newFakeStorage()
+
+	return router.New(log, db, &fakeCache{goods: map[string]models.Good{}}, changefeed.NewHub(16), router.Options{
+		SwaggerUI:     true,
+		ClientIds:     true,
+		DeadLetters:   deadLetters,
+		Webhooks:      webhooks,
+		WebhookTester: fakeTester{webhooks},
+		Audit:         audit,
+		Analytics:     analytics.New(log, audit, nil, 0),
+		DBStats:       db,
+	})
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	doc := loadSpec(t)
+
+	routes, ok := newRouter().(chi.Routes)
+	if !ok {
+		t.Fatal("router doesn't expose its routes")
+	}
+
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route = strings.TrimSuffix(strings.ReplaceAll(route, "/*/", "/"), "/")
+
+		item := doc.Paths.Find(route)
+		if item == nil {
+			t.Errorf("route %s is not documented", route)
+			return nil
+		}
+
+		if item.GetOperation(method) == nil {
+			t.Errorf("method %s of route %s is not documented", method, route)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed walking routes: %v", err)
+	}
+}
+
+func TestResponsesMatchSpec(t *testing.T) {
+	doc := loadSpec(t)
+
+	srv := httptest.NewServer(newRouter())
+	defer srv.Close()
+
+	specRouter := specRouter(t, doc, srv.URL)
+
+	// the swagger ui page is validated as a plain string
+	openapi3filter.RegisterBodyDecoder("text/html", decodePlain)
+	defer openapi3filter.UnregisterBodyDecoder("text/html")
+
+	// the cases are run in order, later ones rely on the good created by the first one
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"create", http.MethodPost, "/good/create?projectId=1", `{"Payload":{"name":"good","description":"desc"}}`, http.StatusOK},
+		{"create with id", http.MethodPost, "/good/create?projectId=1", `{"Payload":{"id":10,"name":"good","description":"desc"}}`, http.StatusOK},
+		{"create with taken id", http.MethodPost, "/good/create?projectId=1", `{"Payload":{"id":10,"name":"good","description":"desc"}}`, http.StatusConflict},
+		{"create in missing project", http.MethodPost, "/good/create?projectId=2", `{"Payload":{"name":"good"}}`, http.StatusNotFound},
+		{"create with bad project", http.MethodPost, "/good/create?projectId=abc", `{"Payload":{"name":"good"}}`, http.StatusBadRequest},
+		{"create without name", http.MethodPost, "/good/create?projectId=1", `{"Payload":{"description":"desc"}}`, http.StatusBadRequest},
+		{"create with empty body", http.MethodPost, "/good/create?projectId=1", ``, http.StatusBadRequest},
+		{"get from db", http.MethodGet, "/good/1/1", ``, http.StatusOK},
+		{"get from cache", http.MethodGet, "/good/1/1", ``, http.StatusOK},
+		{"get missing", http.MethodGet, "/good/2/1", ``, http.StatusNotFound},
+		{"get with bad id", http.MethodGet, "/good/abc/1", ``, http.StatusBadRequest},
+		{"update", http.MethodPatch, "/good/update?id=1&projectId=1", `{"Payload":{"name":"new","description":"new desc","priority":5}}`, http.StatusOK},
+		{"update to taken priority", http.MethodPatch, "/good/update?id=1&projectId=1", `{"Payload":{"name":"new","description":"new desc","priority":10}}`, http.StatusConflict},
+		{"update missing", http.MethodPatch, "/good/update?id=2&projectId=1", `{"Payload":{"name":"new","description":"new desc"}}`, http.StatusNotFound},
+		{"update without description", http.MethodPatch, "/good/update?id=1&projectId=1", `{"Payload":{"name":"new"}}`, http.StatusBadRequest},
+		{"list", http.MethodGet, "/goods/list?limit=10&offset=0", ``, http.StatusOK},
+		{"list with bad limit", http.MethodGet, "/goods/list?limit=abc&offset=0", ``, http.StatusBadRequest},
+		{"search", http.MethodGet, "/goods/search?q=new&projectId=1", ``, http.StatusOK},
+		{"search every project", http.MethodGet, "/goods/search?q=desc&limit=5&offset=0", ``, http.StatusOK},
+		{"search without text", http.MethodGet, "/goods/search?projectId=1", ``, http.StatusBadRequest},
+		{"search with bad project", http.MethodGet, "/goods/search?q=new&projectId=abc", ``, http.StatusBadRequest},
+		{"remove", http.MethodDelete, "/good/remove?id=1&projectId=1", ``, http.StatusOK},
+		{"remove missing", http.MethodDelete, "/good/remove?id=1&projectId=1", ``, http.StatusNotFound},
+		{"list empty", http.MethodGet, "/goods/list?limit=10&offset=0", ``, http.StatusOK},
+		{"create webhook", http.MethodPost, "/project/1/webhooks", `{"Payload":{"url":"https://example.com/hook","event_types":["create","delete"]}}`, http.StatusOK},
+		{"create webhook without url", http.MethodPost, "/project/1/webhooks", `{"Payload":{"secret":"secret"}}`, http.StatusBadRequest},
+		{"create webhook with bad event type", http.MethodPost, "/project/1/webhooks", `{"Payload":{"url":"https://example.com/hook","event_types":["rename"]}}`, http.StatusBadRequest},
+		{"create webhook with another scheme", http.MethodPost, "/project/1/webhooks", `{"Payload":{"url":"file:///etc/passwd"}}`, http.StatusBadRequest},
+		{"create webhook of missing project", http.MethodPost, "/project/2/webhooks", `{"Payload":{"url":"https://example.com/hook"}}`, http.StatusNotFound},
+		{"list webhooks", http.MethodGet, "/project/1/webhooks", ``, http.StatusOK},
+		{"get webhook", http.MethodGet, "/project/1/webhooks/1", ``, http.StatusOK},
+		{"get webhook of another project", http.MethodGet, "/project/2/webhooks/1", ``, http.StatusNotFound},
+		{"get webhook with bad id", http.MethodGet, "/project/1/webhooks/abc", ``, http.StatusBadRequest},
+		{"update webhook", http.MethodPatch, "/project/1/webhooks/1", `{"Payload":{"enabled":false}}`, http.StatusOK},
+		{"update webhook with bad url", http.MethodPatch, "/project/1/webhooks/1", `{"Payload":{"url":"not a url"}}`, http.StatusBadRequest},
+		{"update webhook with another scheme", http.MethodPatch, "/project/1/webhooks/1", `{"Payload":{"url":"gopher://127.0.0.1:6379/_"}}`, http.StatusBadRequest},
+		{"test webhook", http.MethodPost, "/project/1/webhooks/1/test", ``, http.StatusOK},
+		{"list webhook deliveries", http.MethodGet, "/project/1/webhooks/1/deliveries?limit=10&offset=0", ``, http.StatusOK},
+		{"list deliveries of missing webhook", http.MethodGet, "/project/1/webhooks/2/deliveries?limit=10&offset=0", ``, http.StatusNotFound},
+		{"remove webhook", http.MethodDelete, "/project/1/webhooks/1", ``, http.StatusOK},
+		{"remove missing webhook", http.MethodDelete, "/project/1/webhooks/1", ``, http.StatusNotFound},
+		{"query audit", http.MethodGet, "/audit?projectId=1&goodId=1&type=delete&from=2024-01-01T00:00:00Z&limit=10&offset=0", ``, http.StatusOK},
+		{"query audit of every project", http.MethodGet, "/audit?limit=10&offset=0", ``, http.StatusOK},
+		{"query audit with bad type", http.MethodGet, "/audit?type=rename&limit=10&offset=0", ``, http.StatusBadRequest},
+		{"query audit with bad time range", http.MethodGet, "/audit?from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z&limit=10&offset=0", ``, http.StatusBadRequest},
+		{"query audit without limit", http.MethodGet, "/audit?offset=0", ``, http.StatusBadRequest},
+		{"count events", http.MethodGet, "/analytics/events?projectId=1&bucket=hour&groupBy=event_type", ``, http.StatusOK},
+		{"count events of every project", http.MethodGet, "/analytics/events?groupBy=project&from=2024-01-01T00:00:00Z", ``, http.StatusOK},
+		{"count events over too many buckets", http.MethodGet, "/analytics/events?bucket=hour&from=2023-01-01T00:00:00Z&to=2024-01-01T00:00:00Z", ``, http.StatusBadRequest},
+		{"count events with bad bucket", http.MethodGet, "/analytics/events?bucket=month", ``, http.StatusBadRequest},
+		{"count removals", http.MethodGet, "/analytics/removals?projectId=1&bucket=week", ``, http.StatusOK},
+		{"count removals with bad time range", http.MethodGet, "/analytics/removals?from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z", ``, http.StatusBadRequest},
+		{"list most edited goods", http.MethodGet, "/analytics/most-edited?projectId=1&limit=5", ``, http.StatusOK},
+		{"list most edited goods with bad limit", http.MethodGet, "/analytics/most-edited?limit=0", ``, http.StatusBadRequest},
+		{"db pool stats", http.MethodGet, "/admin/db/stats", ``, http.StatusOK},
+		{"list dead letters", http.MethodGet, "/admin/dlq?limit=10&offset=0", ``, http.StatusOK},
+		{"get dead letter", http.MethodGet, "/admin/dlq/1", ``, http.StatusOK},
+		{"get missing dead letter", http.MethodGet, "/admin/dlq/2", ``, http.StatusNotFound},
+		{"get dead letter with bad id", http.MethodGet, "/admin/dlq/abc", ``, http.StatusBadRequest},
+		{"replay dead letter", http.MethodPost, "/admin/dlq/1/replay", ``, http.StatusOK},
+		{"replay replayed dead letter", http.MethodPost, "/admin/dlq/1/replay", ``, http.StatusNotFound},
+		{"ping", http.MethodGet, "/ping", ``, http.StatusOK},
+		{"openapi", http.MethodGet, "/openapi.json", ``, http.StatusOK},
+		{"docs", http.MethodGet, "/docs", ``, http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		req, err := http.NewRequest(tc.method, srv.URL+tc.path, strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatalf("%s: failed creating request: %v", tc.name, err)
+		}
+
+		if tc.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tc.name, err)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: failed reading body: %v", tc.name, err)
+		}
+
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: got status %d, want %d, body: %s", tc.name, resp.StatusCode, tc.status, body)
+			continue
+		}
+
+		route, pathParams, err := specRouter.FindRoute(req)
+		if err != nil {
+			t.Errorf("%s: no documented route: %v", tc.name, err)
+			continue
+		}
+
+		input := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+			},
+			Status: resp.StatusCode,
+			Header: resp.Header,
+			Body:   io.NopCloser(bytes.NewReader(body)),
+			Options: &openapi3filter.Options{
+				IncludeResponseStatus: true,
+			},
+		}
+
+		if err := openapi3filter.ValidateResponse(context.Background(), input); err != nil {
+			t.Errorf("%s: response doesn't match the spec: %v", tc.name, err)
+		}
+	}
+}
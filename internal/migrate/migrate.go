@@ -0,0 +1,241 @@
+// Package migrate runs the embedded goose migrations of the postgres schema
+// and of the ClickHouse audit log.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+
+	chmigrations "github.com/kldd0/goods-service/clickhouse/migrations"
+	"github.com/kldd0/goods-service/migrations"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/database"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// ErrSchemaTooNew is returned when the database was migrated past the
+// latest migration of the set, by a newer build.
+var ErrSchemaTooNew = errors.New("schema is newer than the migrations")
+
+// Set is the migrations of a database.
+type Set struct {
+	Name    string
+	Dialect goose.Dialect
+	// Driver is the database/sql driver the set is applied with
+	Driver string
+	// FS holds the migration files at its root
+	FS fs.FS
+	// Dir is where the migration files are kept in the repository,
+	// the new migrations are created there
+	Dir string
+}
+
+var (
+	Postgres = Set{
+		Name:    "postgres",
+		Dialect: goose.DialectPostgres,
+		Driver:  "pgx",
+		FS:      migrations.FS,
+		Dir:     "migrations",
+	}
+	ClickHouse = Set{
+		Name:    "clickhouse",
+		Dialect: goose.DialectClickHouse,
+		Driver:  "clickhouse",
+		FS:      chmigrations.FS,
+		Dir:     "clickhouse/migrations",
+	}
+)
+
+// Lookup returns the set by its name.
+func Lookup(name string) (Set, bool) {
+	for _, set := range []Set{Postgres, ClickHouse} {
+		if set.Name == name {
+			return set, true
+		}
+	}
+
+	return Set{}, false
+}
+
+// Provider returns a goose provider applying the set to db.
+func (s Set) Provider(db *sql.DB, opts ...goose.ProviderOption) (*goose.Provider, error) {
+	const op = "migrate.Set.Provider"
+
+	p, err := goose.NewProvider(s.Dialect, db, s.FS, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, s.Name, err)
+	}
+
+	return p, nil
+}
+
+// LockedProvider is Provider holding the postgres migrations under an
+// advisory lock, so that the commands run together wait for each other.
+func (s Set) LockedProvider(db *sql.DB) (*goose.Provider, error) {
+	const op = "migrate.Set.LockedProvider"
+
+	var opts []goose.ProviderOption
+	if s.Dialect == goose.DialectPostgres {
+		locker, err := lock.NewPostgresSessionLocker()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		opts = append(opts, goose.WithSessionLocker(locker))
+	}
+
+	return s.Provider(db, opts...)
+}
+
+// Up applies the pending migrations of the set with a locked provider, so
+// that of the replicas started together one migrates while the others wait
+// for it and find nothing pending.
+// It fails with ErrSchemaTooNew before and after migrating when the database
+// has a version the set doesn't know.
+func (s Set) Up(ctx context.Context, db *sql.DB) ([]*goose.MigrationResult, error) {
+	const op = "migrate.Set.Up"
+
+	p, err := s.LockedProvider(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkVersion(ctx, p); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	results, err := p.Up(ctx)
+	if err != nil {
+		return results, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// a newer replica may have migrated while waiting for the lock
+	if err := checkVersion(ctx, p); err != nil {
+		return results, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return results, nil
+}
+
+// checkVersion fails when the version of the database is past the latest
+// migration of the provider.
+func checkVersion(ctx context.Context, p *goose.Provider) error {
+	version, err := p.GetDBVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("get version: %w", err)
+	}
+
+	sources := p.ListSources()
+	if latest := sources[len(sources)-1].Version; version > latest {
+		return fmt.Errorf("%w: version %d, latest migration %d", ErrSchemaTooNew, version, latest)
+	}
+
+	return nil
+}
+
+// Applied returns the versions applied to db without writing to it, unlike
+// the provider that creates the version table and takes the lock first.
+// A database without the version table has nothing applied.
+func (s Set) Applied(ctx context.Context, db *sql.DB) (map[int64]bool, error) {
+	const op = "migrate.Set.Applied"
+
+	// the table is looked up like goose does, in the search path of postgres
+	// and in the current database of ClickHouse
+	query := "SELECT to_regclass($1) IS NOT NULL"
+	if s.Dialect == goose.DialectClickHouse {
+		query = "SELECT count() > 0 FROM system.tables WHERE database = currentDatabase() AND name = ?"
+	}
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, query, goose.DefaultTablename).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, s.Name, err)
+	}
+
+	applied := make(map[int64]bool)
+	if !exists {
+		return applied, nil
+	}
+
+	store, err := database.NewStore(s.Dialect, goose.DefaultTablename)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, s.Name, err)
+	}
+
+	rows, err := store.ListMigrations(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, s.Name, err)
+	}
+
+	// the rows are the latest first, the latest row of a version is its state
+	for _, r := range rows {
+		if _, ok := applied[r.Version]; !ok {
+			applied[r.Version] = r.IsApplied
+		}
+	}
+
+	// version 0 is the row goose adds when creating the table
+	delete(applied, 0)
+	for version, ok := range applied {
+		if !ok {
+			delete(applied, version)
+		}
+	}
+
+	return applied, nil
+}
+
+// Load parses the migrations of the set ordered by version, the error
+// joins every problem found in the files.
+func (s Set) Load() ([]Migration, error) {
+	const op = "migrate.Set.Load"
+
+	names, err := fs.Glob(s.FS, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, s.Name, err)
+	}
+
+	var (
+		loaded []Migration
+		errs   []error
+		// files are the file names by version
+		files = make(map[int64]string, len(names))
+	)
+
+	for _, name := range names {
+		f, err := s.FS.Open(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		m, err := Parse(name, f)
+		_ = f.Close()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if other, ok := files[m.Version]; ok {
+			errs = append(errs, fmt.Errorf("%s: version %d is taken by %s", name, m.Version, other))
+			continue
+		}
+		files[m.Version] = name
+
+		loaded = append(loaded, m)
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %s: %w", op, s.Name, errors.Join(errs...))
+	}
+
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].Version < loaded[j].Version
+	})
+
+	return loaded, nil
+}
@@ -0,0 +1,173 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/kldd0/goods-service/internal/migrate"
+)
+
+// uriEnv names the uri of a disposable database the migrations are applied
+// to, the tests needing it are skipped without it.
+const uriEnv = "TEST_POSTGRES_URI"
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	uri := os.Getenv(uriEnv)
+	if uri == "" {
+		t.Skipf("%s isn't set", uriEnv)
+	}
+
+	db, err := sql.Open(migrate.Postgres.Driver, uri)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestUpConcurrently(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+
+	loaded, err := migrate.Postgres.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	const replicas = 3
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		applied = make(map[int64]int)
+		errs    = make(chan error, replicas)
+	)
+
+	for i := 0; i < replicas; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			results, err := migrate.Postgres.Up(ctx, db)
+			errs <- err
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, r := range results {
+				applied[r.Source.Version]++
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("up: %v", err)
+		}
+	}
+
+	// every migration is applied by one of the replicas at most
+	for version, n := range applied {
+		if n > 1 {
+			t.Errorf("got migration %d applied %d times", version, n)
+		}
+	}
+
+	var version int64
+	err = db.QueryRowContext(ctx, "SELECT max(version_id) FROM goose_db_version WHERE is_applied").Scan(&version)
+	if err != nil {
+		t.Fatalf("get version: %v", err)
+	}
+	if latest := loaded[len(loaded)-1].Version; version != latest {
+		t.Errorf("got version %d, want %d", version, latest)
+	}
+}
+
+func TestUpSchemaTooNew(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+
+	if _, err := migrate.Postgres.Up(ctx, db); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	loaded, err := migrate.Postgres.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	newer := loaded[len(loaded)-1].Version + 1
+
+	// a migration applied by a newer build
+	if _, err := db.ExecContext(ctx, "INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, true)", newer); err != nil {
+		t.Fatalf("insert version: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.ExecContext(ctx, "DELETE FROM goose_db_version WHERE version_id = $1", newer)
+	})
+
+	if _, err := migrate.Postgres.Up(ctx, db); !errors.Is(err, migrate.ErrSchemaTooNew) {
+		t.Fatalf("got error %v, want %v", err, migrate.ErrSchemaTooNew)
+	}
+}
+
+func TestApplied(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+
+	// an empty schema of its own, the one connection keeps its search path
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, "CREATE SCHEMA migrate_applied_test; SET search_path TO migrate_applied_test"); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.ExecContext(ctx, "DROP SCHEMA migrate_applied_test CASCADE")
+	})
+
+	applied, err := migrate.Postgres.Applied(ctx, db)
+	if err != nil {
+		t.Fatalf("applied: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("got applied versions %v of a new database, want none", applied)
+	}
+
+	// reading doesn't create the version table
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('goose_db_version') IS NOT NULL").Scan(&exists); err != nil {
+		t.Fatalf("check version table: %v", err)
+	}
+	if exists {
+		t.Fatal("got the version table created by reading the applied versions")
+	}
+
+	if _, err := migrate.Postgres.Up(ctx, db); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	loaded, err := migrate.Postgres.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	applied, err = migrate.Postgres.Applied(ctx, db)
+	if err != nil {
+		t.Fatalf("applied: %v", err)
+	}
+	if len(applied) != len(loaded) {
+		t.Errorf("got %d applied versions, want %d", len(applied), len(loaded))
+	}
+	for _, m := range loaded {
+		if !applied[m.Version] {
+			t.Errorf("got migration %d not applied", m.Version)
+		}
+	}
+}
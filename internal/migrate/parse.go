@@ -0,0 +1,175 @@
+package migrate
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pressly/goose/v3"
+)
+
+const annotationPrefix = "-- +goose"
+
+// Migration is a sql migration split into its directions.
+type Migration struct {
+	Version int64
+	// Path is the name of the file in the set
+	Path string
+	// Up and Down are the sql of the directions without the annotations
+	Up   string
+	Down string
+	// NoTx is set by the NO TRANSACTION annotation, the migration
+	// isn't run in a transaction then
+	NoTx bool
+}
+
+// Parse splits a sql migration into its directions. It checks what goose
+// would reject when applying it: the missing Up annotation, unbalanced
+// statement blocks and statements left without a semicolon. The error joins
+// every problem found, each prefixed with the file name and the line.
+func Parse(name string, r io.Reader) (Migration, error) {
+	m := Migration{Path: name}
+
+	version, err := goose.NumericComponent(name)
+	if err != nil {
+		return m, fmt.Errorf("%s: %w", name, err)
+	}
+	m.Version = version
+
+	var (
+		errs []error
+		up   strings.Builder
+		down strings.Builder
+		// section is the direction being read, nil before the Up annotation
+		section *strings.Builder
+		// block is the line of the open StatementBegin, zero outside of blocks
+		block int
+		// unterminated is the line of a statement left without a semicolon
+		unterminated int
+		seenDown     bool
+		line         int
+	)
+
+	failf := func(line int, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s:%d: "+format, append([]any{name, line}, args...)...))
+	}
+
+	// closeSection checks that the statements of the section are complete
+	closeSection := func() {
+		if block != 0 {
+			failf(block, "StatementBegin isn't closed by StatementEnd")
+		}
+		if unterminated != 0 {
+			failf(unterminated, "statement isn't terminated by a semicolon")
+		}
+		block, unterminated = 0, 0
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+
+		if strings.HasPrefix(trimmed, annotationPrefix) {
+			annotation := strings.TrimSpace(strings.TrimPrefix(trimmed, annotationPrefix))
+
+			switch strings.ToLower(annotation) {
+			case "up":
+				if section != nil {
+					failf(line, "duplicate Up annotation")
+					continue
+				}
+				section = &up
+			case "down":
+				if section == nil {
+					failf(line, "Down annotation before Up")
+					continue
+				}
+				if seenDown {
+					failf(line, "duplicate Down annotation")
+					continue
+				}
+				closeSection()
+				section, seenDown = &down, true
+			case "statementbegin":
+				if section == nil {
+					failf(line, "StatementBegin before Up")
+					continue
+				}
+				if block != 0 {
+					failf(line, "StatementBegin inside the block opened at line %d", block)
+					continue
+				}
+				if unterminated != 0 {
+					failf(unterminated, "statement isn't terminated by a semicolon")
+					unterminated = 0
+				}
+				block = line
+			case "statementend":
+				if block == 0 {
+					failf(line, "StatementEnd without StatementBegin")
+					continue
+				}
+				block = 0
+			case "no transaction":
+				m.NoTx = true
+			case "envsub on", "envsub off":
+			default:
+				failf(line, "unknown annotation %q", annotation)
+			}
+
+			continue
+		}
+
+		if section == nil {
+			if trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				failf(line, "statement before the Up annotation")
+			}
+			continue
+		}
+
+		section.WriteString(text)
+		section.WriteByte('\n')
+
+		// the statements inside a block are sent as a whole
+		if block != 0 {
+			continue
+		}
+
+		if statement := stripComment(trimmed); statement != "" {
+			if strings.HasSuffix(statement, ";") {
+				unterminated = 0
+			} else if unterminated == 0 {
+				unterminated = line
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return m, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if section == nil {
+		errs = append(errs, fmt.Errorf("%s: missing %s Up annotation", name, annotationPrefix))
+	}
+	closeSection()
+
+	m.Up = strings.TrimSpace(up.String())
+	m.Down = strings.TrimSpace(down.String())
+
+	return m, errors.Join(errs...)
+}
+
+// stripComment cuts the trailing line comment off a statement.
+func stripComment(s string) string {
+	if i := strings.Index(s, "--"); i >= 0 {
+		s = s[:i]
+	}
+
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,146 @@
+package migrate_test
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kldd0/goods-service/internal/migrate"
+)
+
+func TestEmbeddedSets(t *testing.T) {
+	for _, set := range []migrate.Set{migrate.Postgres, migrate.ClickHouse} {
+		t.Run(set.Name, func(t *testing.T) {
+			loaded, err := set.Load()
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if len(loaded) == 0 {
+				t.Fatal("got no migrations")
+			}
+
+			for i, m := range loaded {
+				if m.Up == "" {
+					t.Errorf("%s: got an empty up migration", m.Path)
+				}
+				if m.Down == "" {
+					t.Errorf("%s: got an empty down migration", m.Path)
+				}
+				if i > 0 && m.Version <= loaded[i-1].Version {
+					t.Errorf("%s: got version %d after %d", m.Path, m.Version, loaded[i-1].Version)
+				}
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name string
+		file string
+		sql  string
+		// errMsg is a part of the returned error, none when empty
+		errMsg string
+		up     string
+		down   string
+		noTx   bool
+	}{
+		{
+			name: "statements",
+			file: "00001_init.sql",
+			sql:  "-- +goose Up\nCREATE TABLE a (id int);\n\n-- +goose Down\nDROP TABLE a; -- gone\n",
+			up:   "CREATE TABLE a (id int);",
+			down: "DROP TABLE a; -- gone",
+		},
+		{
+			name: "blocks",
+			file: "00002_func.sql",
+			sql:  "-- leading comment\n-- +goose Up\n-- +goose StatementBegin\nCREATE FUNCTION f() RETURNS int AS $$\nBEGIN\n  RETURN 1\nEND $$ LANGUAGE plpgsql;\n-- +goose StatementEnd\n-- +goose Down\nDROP FUNCTION f;\n",
+			up:   "CREATE FUNCTION f() RETURNS int AS $$\nBEGIN\n  RETURN 1\nEND $$ LANGUAGE plpgsql;",
+			down: "DROP FUNCTION f;",
+		},
+		{
+			name: "no transaction",
+			file: "00003_index.sql",
+			sql:  "-- +goose NO TRANSACTION\n-- +goose Up\nCREATE INDEX CONCURRENTLY i ON a (id);\n",
+			up:   "CREATE INDEX CONCURRENTLY i ON a (id);",
+			noTx: true,
+		},
+		{
+			name:   "without version",
+			file:   "init.sql",
+			sql:    "-- +goose Up\nSELECT 1;\n",
+			errMsg: "init.sql",
+		},
+		{
+			name:   "without up",
+			file:   "00004_empty.sql",
+			sql:    "SELECT 1;\n",
+			errMsg: "00004_empty.sql:1: statement before the Up annotation",
+		},
+		{
+			name:   "unclosed block",
+			file:   "00005_open.sql",
+			sql:    "-- +goose Up\n-- +goose StatementBegin\nSELECT 1;\n-- +goose Down\nSELECT 2;\n",
+			errMsg: "00005_open.sql:2: StatementBegin isn't closed",
+		},
+		{
+			name:   "end without begin",
+			file:   "00006_end.sql",
+			sql:    "-- +goose Up\nSELECT 1;\n-- +goose StatementEnd\n",
+			errMsg: "00006_end.sql:3: StatementEnd without StatementBegin",
+		},
+		{
+			name:   "missing semicolon",
+			file:   "00007_semicolon.sql",
+			sql:    "-- +goose Up\nSELECT 1;\nSELECT\n  2\n-- +goose Down\nSELECT 3;\n",
+			errMsg: "00007_semicolon.sql:3: statement isn't terminated",
+		},
+		{
+			name:   "duplicate down",
+			file:   "00008_down.sql",
+			sql:    "-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 2;\n-- +goose Down\n",
+			errMsg: "00008_down.sql:5: duplicate Down annotation",
+		},
+		{
+			name:   "unknown annotation",
+			file:   "00009_typo.sql",
+			sql:    "-- +goose Up\n-- +goose StatmentBegin\nSELECT 1;\n",
+			errMsg: `00009_typo.sql:2: unknown annotation "StatmentBegin"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := migrate.Parse(tc.file, strings.NewReader(tc.sql))
+
+			if tc.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+					t.Fatalf("got error %v, want %q", err, tc.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			if m.Up != tc.up || m.Down != tc.down || m.NoTx != tc.noTx {
+				t.Errorf("got up %q, down %q, no transaction %v, want %q, %q, %v", m.Up, m.Down, m.NoTx, tc.up, tc.down, tc.noTx)
+			}
+		})
+	}
+}
+
+func TestLoadDuplicateVersions(t *testing.T) {
+	set := migrate.Set{
+		Name: "test",
+		FS: fstest.MapFS{
+			"00001_a.sql": {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+			"00001_b.sql": {Data: []byte("-- +goose Up\nSELECT 2;\n")},
+		},
+	}
+
+	if _, err := set.Load(); err == nil || !strings.Contains(err.Error(), "version 1 is taken") {
+		t.Fatalf("got error %v, want the taken version", err)
+	}
+}
@@ -1,5 +1,79 @@
 package nats_streaming
 
-type Subscriber interface {
-	Subscribe() (func() error, error)
+import (
+	"context"
+	"fmt"
+
+	"log/slog"
+
+	"github.com/kldd0/goods-service/internal/config"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Setup creates the stream of the service or updates it to the config.
+func Setup(ctx context.Context, log *slog.Logger, nc *nats.Conn, cfg config.JetStream) (jetstream.JetStream, jetstream.Stream, error) {
+	const op = "nats-streaming.Setup"
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: creating jetstream context: %w", op, err)
+	}
+
+	streamCfg, err := StreamConfig(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	stream, err := js.CreateOrUpdateStream(ctx, streamCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: creating stream: %w", op, err)
+	}
+
+	log.Info(
+		"jetstream stream is ready",
+		slog.String("stream", cfg.Stream),
+		slog.Any("subjects", streamCfg.Subjects),
+	)
+
+	return js, stream, nil
+}
+
+// StreamConfig builds the config of the stream keeping the commands,
+// their results and the dead letters.
+func StreamConfig(cfg config.JetStream) (jetstream.StreamConfig, error) {
+	// only the limits keep the messages for the consumers of the service:
+	// the results have no consumer, so an interest stream drops them, and the
+	// dead letters are read by an ordered consumer, which is refused by a
+	// work queue stream and removes them from an interest one
+	var retention jetstream.RetentionPolicy
+	switch cfg.Retention {
+	case "limits":
+		retention = jetstream.LimitsPolicy
+	case "interest", "workqueue":
+		return jetstream.StreamConfig{}, fmt.Errorf("retention policy %q isn't supported, use limits", cfg.Retention)
+	default:
+		return jetstream.StreamConfig{}, fmt.Errorf("unknown retention policy %q", cfg.Retention)
+	}
+
+	var storage jetstream.StorageType
+	switch cfg.Storage {
+	case "file":
+		storage = jetstream.FileStorage
+	case "memory":
+		storage = jetstream.MemoryStorage
+	default:
+		return jetstream.StreamConfig{}, fmt.Errorf("unknown storage type %q", cfg.Storage)
+	}
+
+	return jetstream.StreamConfig{
+		Name:       cfg.Stream,
+		Subjects:   []string{cfg.CommandsSubject, cfg.ResultsSubject, cfg.DeadLetterSubject},
+		Retention:  retention,
+		Storage:    storage,
+		MaxAge:     cfg.MaxAge,
+		MaxMsgs:    cfg.MaxMsgs,
+		MaxBytes:   cfg.MaxBytes,
+		Duplicates: cfg.DuplicateWindow,
+	}, nil
 }
@@ -0,0 +1,324 @@
+package nats_streaming_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kldd0/goods-service/internal/config"
+	nats_streaming "github.com/kldd0/goods-service/internal/nats-streaming"
+	"github.com/kldd0/goods-service/internal/nats-streaming/pub"
+	"github.com/kldd0/goods-service/internal/nats-streaming/sub"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// runServer starts a JetStream enabled server stopped with the test.
+func runServer(t *testing.T) *nats.Conn {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("failed creating nats server: %v", err)
+	}
+
+	go srv.Start()
+	t.Cleanup(srv.Shutdown)
+
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server isn't ready")
+	}
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("failed connecting to nats: %v", err)
+	}
+	t.Cleanup(nc.Close)
+
+	return nc
+}
+
+func testConfig() config.JetStream {
+	return config.JetStream{
+		Enabled:           true,
+		Stream:            "GOODS",
+		CommandsSubject:   "goods.commands",
+		ResultsSubject:    "goods.results",
+		DeadLetterSubject: "goods.commands.dlq",
+		Retention:         "limits",
+		Storage:           "memory",
+		MaxAge:            time.Hour,
+		MaxMsgs:           -1,
+		MaxBytes:          -1,
+		DuplicateWindow:   time.Minute,
+		Durable:           "goods-service",
+		AckWait:           5 * time.Second,
+		MaxAckPending:     25,
+		RetryDelay:        50 * time.Millisecond,
+		MaxAttempts:       3,
+	}
+}
+
+func setup(t *testing.T, cfg config.JetStream) (jetstream.JetStream, jetstream.Stream) {
+	t.Helper()
+
+	js, stream, err := nats_streaming.Setup(context.Background(), discard(), runServer(t), cfg)
+	if err != nil {
+		t.Fatalf("failed setting up stream: %v", err)
+	}
+
+	return js, stream
+}
+
+func discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// waitFor polls the condition until it holds or the time is out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type delivery struct {
+	sequence uint64
+	attempt  int
+	data     string
+}
+
+type recorder struct {
+	mu         sync.Mutex
+	deliveries []delivery
+	// failures is the number of deliveries the handler fails
+	failures int
+}
+
+func (r *recorder) handle(_ context.Context, _ string, sequence uint64, attempt int, data []byte) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deliveries = append(r.deliveries, delivery{sequence: sequence, attempt: attempt, data: string(data)})
+
+	if r.failures > 0 {
+		r.failures--
+		return false
+	}
+
+	return true
+}
+
+func (r *recorder) get() []delivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]delivery(nil), r.deliveries...)
+}
+
+func TestStreamFromConfig(t *testing.T) {
+	accepted := map[string]jetstream.RetentionPolicy{
+		"limits": jetstream.LimitsPolicy,
+	}
+
+	for retention, want := range accepted {
+		t.Run(retention, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Retention = retention
+
+			_, stream := setup(t, cfg)
+
+			info, err := stream.Info(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.Config.Retention != want {
+				t.Errorf("got retention %v, want %v", info.Config.Retention, want)
+			}
+
+			if info.Config.Duplicates != cfg.DuplicateWindow || info.Config.MaxAge != cfg.MaxAge {
+				t.Errorf("got duplicates window %v and max age %v", info.Config.Duplicates, info.Config.MaxAge)
+			}
+
+			if len(info.Config.Subjects) != 3 {
+				t.Errorf("got subjects %v", info.Config.Subjects)
+			}
+
+			// the consumers of the service are allowed on the stream
+			s := sub.New(discard(), stream, cfg)
+			defer s.Close()
+
+			if err := s.Subscribe(context.Background(), (&recorder{}).handle); err != nil {
+				t.Errorf("subscribe to commands: %v", err)
+			}
+			if err := s.SubscribeDeadLetters(context.Background(), func(uint64, []byte) {}); err != nil {
+				t.Errorf("subscribe to dead letters: %v", err)
+			}
+		})
+	}
+
+	for _, retention := range []string{"interest", "workqueue", "forever"} {
+		cfg := testConfig()
+		cfg.Retention = retention
+
+		if _, err := nats_streaming.StreamConfig(cfg); err == nil {
+			t.Errorf("retention policy %q is accepted", retention)
+		}
+	}
+}
+
+func TestPublishDeduplicates(t *testing.T) {
+	cfg := testConfig()
+	js, stream := setup(t, cfg)
+
+	p := pub.New(js, cfg.CommandsSubject)
+
+	for _, id := range []string{"1", "1", "2"} {
+		if err := p.Publish(context.Background(), id, map[string]string{"correlation_id": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := stream.Info(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.State.Msgs != 2 {
+		t.Errorf("got %d messages, want 2", info.State.Msgs)
+	}
+}
+
+func TestRedeliveryUntilAcked(t *testing.T) {
+	cfg := testConfig()
+	js, stream := setup(t, cfg)
+
+	rec := &recorder{failures: 2}
+
+	s := sub.New(discard(), stream, cfg)
+	if err := s.Subscribe(context.Background(), rec.handle); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := pub.New(js, cfg.CommandsSubject).PublishData(context.Background(), "1", []byte("command")); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "three attempts", func() bool { return len(rec.get()) == 3 })
+
+	for i, d := range rec.get() {
+		if d.attempt != i+1 || d.data != "command" || d.sequence != 1 {
+			t.Errorf("got delivery %+v", d)
+		}
+	}
+
+	consumer, err := stream.Consumer(context.Background(), cfg.Durable)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the ack", func() bool {
+		info, err := consumer.Info(context.Background())
+		return err == nil && info.NumAckPending == 0 && info.AckFloor.Stream == 1
+	})
+}
+
+func TestDurableResumes(t *testing.T) {
+	cfg := testConfig()
+	js, stream := setup(t, cfg)
+
+	commands := pub.New(js, cfg.CommandsSubject)
+
+	first := &recorder{}
+	s := sub.New(discard(), stream, cfg)
+	if err := s.Subscribe(context.Background(), first.handle); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := commands.PublishData(context.Background(), "1", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the first command", func() bool { return len(first.get()) == 1 })
+
+	// the double ack is confirmed by the server before the handler returns
+	s.Close()
+
+	if err := commands.PublishData(context.Background(), "2", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	second := &recorder{}
+	s = sub.New(discard(), stream, cfg)
+	if err := s.Subscribe(context.Background(), second.handle); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	waitFor(t, "the second command", func() bool { return len(second.get()) == 1 })
+
+	if d := second.get()[0]; d.data != "second" {
+		t.Errorf("restarted durable got %+v", d)
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	cfg := testConfig()
+	js, stream := setup(t, cfg)
+
+	// the commands aren't listed as dead letters
+	if err := pub.New(js, cfg.CommandsSubject).PublishData(context.Background(), "1", []byte("command")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadLetters := pub.New(js, cfg.DeadLetterSubject)
+	for _, id := range []string{"dlq-1", "dlq-2"} {
+		if err := deadLetters.PublishData(context.Background(), id, []byte(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	got := map[uint64]string{}
+
+	s := sub.New(discard(), stream, cfg)
+	err := s.SubscribeDeadLetters(context.Background(), func(sequence uint64, data []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		got[sequence] = string(data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	waitFor(t, "the dead letters", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return len(got) == 2
+	})
+
+	if got[2] != "dlq-1" || got[3] != "dlq-2" {
+		t.Errorf("got dead letters %v", got)
+	}
+}
@@ -1 +1,46 @@
 package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type Publisher struct {
+	js      jetstream.JetStream
+	subject string
+}
+
+func New(js jetstream.JetStream, subject string) *Publisher {
+	return &Publisher{
+		js:      js,
+		subject: subject,
+	}
+}
+
+// PublishData sends the data to the subject as is and waits for the stream
+// to store it. The messages with the same id sent within the duplicate
+// window of the stream are stored once.
+func (p *Publisher) PublishData(ctx context.Context, msgID string, data []byte) error {
+	const op = "nats-streaming.pub.PublishData"
+
+	if _, err := p.js.Publish(ctx, p.subject, data, jetstream.WithMsgID(msgID)); err != nil {
+		return fmt.Errorf("%s: publishing to a subject: %w", op, err)
+	}
+
+	return nil
+}
+
+// Publish sends the value encoded as JSON, see PublishData.
+func (p *Publisher) Publish(ctx context.Context, msgID string, v any) error {
+	const op = "nats-streaming.pub.Publish"
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("%s: failed marshalling message: %w", op, err)
+	}
+
+	return p.PublishData(ctx, msgID, data)
+}
@@ -1,84 +1,139 @@
 package sub
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"time"
 
-	"github.com/nats-io/nats.go"
-	"github.com/nats-io/stan.go"
-)
+	"log/slog"
 
-const (
-	clusterID = "dev"
-	clientID  = "goods-service"
-	channel   = "db-logs"
+	"github.com/kldd0/goods-service/internal/config"
+	"github.com/kldd0/goods-service/internal/logger"
+	"github.com/nats-io/nats.go/jetstream"
 )
 
-type goodsSubscriber struct {
-	sc       stan.Conn
-	sub      stan.Subscription
-	recvChan chan stan.Msg
+// Handler processes a delivered message and reports whether it is done with.
+type Handler func(ctx context.Context, subject string, sequence uint64, attempt int, data []byte) bool
+
+type Subscriber struct {
+	log      *slog.Logger
+	stream   jetstream.Stream
+	cfg      config.JetStream
+	consumes []jetstream.ConsumeContext
+}
+
+func New(log *slog.Logger, stream jetstream.Stream, cfg config.JetStream) *Subscriber {
+	return &Subscriber{
+		log:    log,
+		stream: stream,
+		cfg:    cfg,
+	}
 }
 
-func New(nc *nats.Conn) (*goodsSubscriber, error) {
-	const op = "nats-streaming.sub.New"
-
-	// Connect to NATS cluster
-	sc, err := stan.Connect(
-		clusterID,
-		clientID,
-		stan.NatsConn(nc),
-		stan.SetConnectionLostHandler(func(_ stan.Conn, reason error) {
-			log.Fatalf("NATS Connection lost, reason: %v", reason)
-		}))
+// Subscribe creates the durable consumer of the commands and starts delivering
+// them to the handler. A message is acked when the handler is done with it,
+// otherwise it is redelivered after the retry delay.
+func (s *Subscriber) Subscribe(ctx context.Context, handler Handler) error {
+	const op = "nats-streaming.sub.Subscribe"
+
+	consumer, err := s.stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:       s.cfg.Durable,
+		FilterSubject: s.cfg.CommandsSubject,
+		// the first start of the durable reads the whole stream
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       s.cfg.AckWait,
+		MaxAckPending: s.cfg.MaxAckPending,
+		// the attempts are counted by the handler, which dead-letters the
+		// commands failing too many times
+		MaxDeliver: -1,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("%s: connecting to cluster: %w", op, err)
+		return fmt.Errorf("%s: creating consumer: %w", op, err)
 	}
 
-	log.Printf("Connected to %s clusterID: [%s] clientID: [%s]\n", nats.DefaultURL, clusterID, clientID)
+	cc, err := consumer.Consume(func(msg jetstream.Msg) {
+		s.handle(ctx, msg, handler)
+	}, jetstream.ConsumeErrHandler(s.consumeErr))
+	if err != nil {
+		return fmt.Errorf("%s: consuming: %w", op, err)
+	}
 
-	return &goodsSubscriber{
-		sc:       sc,
-		recvChan: make(chan stan.Msg),
-	}, nil
-}
+	s.consumes = append(s.consumes, cc)
 
-func (s *goodsSubscriber) Subscribe() (recvChan <-chan stan.Msg, err error) {
-	const op = "nats-streaming.consumer.Subscribe"
-
-	// Subscribe with manual ack mode
-	aw, _ := time.ParseDuration("60s")
-	s.sub, err = s.sc.Subscribe(
-		channel,
-		func(msg *stan.Msg) {
-			msg.Ack()
-
-			// sending msg into the output channel
-			s.recvChan <- *msg
-		},
-		stan.MaxInflight(25),
-		stan.SetManualAckMode(),
-		stan.AckWait(aw),
+	s.log.Info(
+		"subscribed to the subject",
+		slog.String("subject", s.cfg.CommandsSubject),
+		slog.String("durable", s.cfg.Durable),
 	)
 
+	return nil
+}
+
+func (s *Subscriber) handle(ctx context.Context, msg jetstream.Msg, handler Handler) {
+	const op = "nats-streaming.sub.handle"
+
+	log := s.log.With(slog.String("op", op))
+
+	meta, err := msg.Metadata()
 	if err != nil {
-		return nil, fmt.Errorf("%s: subscribing to a channel: %w", op, err)
+		log.Error("failed to get message metadata", logger.Err(err))
+		_ = msg.Term()
+		return
 	}
 
-	log.Printf("Subscribed to the channel: [%s] clientID: [%s]\n", channel, clientID)
+	if !handler(ctx, msg.Subject(), meta.Sequence.Stream, int(meta.NumDelivered), msg.Data()) {
+		if err := msg.NakWithDelay(s.cfg.RetryDelay); err != nil {
+			log.Error("failed to nak message", logger.Err(err))
+		}
+		return
+	}
 
-	return s.recvChan, nil
+	// the ack is confirmed, so that a lost one doesn't apply the command twice
+	if err := msg.DoubleAck(ctx); err != nil {
+		log.Error("failed to ack message", logger.Err(err))
+	}
 }
 
-func (s *goodsSubscriber) Close() {
-	if s.sc != nil {
-		s.sc.Close()
+// SubscribeDeadLetters delivers every message kept on the dead-letter subject
+// to the handler, starting from the oldest one.
+func (s *Subscriber) SubscribeDeadLetters(ctx context.Context, handler func(sequence uint64, data []byte)) error {
+	const op = "nats-streaming.sub.SubscribeDeadLetters"
+
+	consumer, err := s.stream.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{s.cfg.DeadLetterSubject},
+		DeliverPolicy:  jetstream.DeliverAllPolicy,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: creating consumer: %w", op, err)
 	}
-	if s.sub != nil {
-		if err := s.sub.Unsubscribe(); err != nil {
-			log.Fatal(err)
+
+	cc, err := consumer.Consume(func(msg jetstream.Msg) {
+		meta, err := msg.Metadata()
+		if err != nil {
+			s.log.Error("failed to get message metadata", slog.String("op", op), logger.Err(err))
+			return
 		}
+
+		handler(meta.Sequence.Stream, msg.Data())
+	}, jetstream.ConsumeErrHandler(s.consumeErr))
+	if err != nil {
+		return fmt.Errorf("%s: consuming: %w", op, err)
+	}
+
+	s.consumes = append(s.consumes, cc)
+
+	s.log.Info("subscribed to the subject", slog.String("subject", s.cfg.DeadLetterSubject))
+
+	return nil
+}
+
+func (s *Subscriber) consumeErr(_ jetstream.ConsumeContext, err error) {
+	s.log.Error("jetstream consume error", logger.Err(err))
+}
+
+// Close stops the delivery, the durable consumer keeps its position.
+func (s *Subscriber) Close() {
+	for _, cc := range s.consumes {
+		cc.Stop()
 	}
-	close(s.recvChan)
 }
@@ -1,63 +1,384 @@
 package service
 
-/*
-
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"strconv"
+	"time"
+
+	"log/slog"
 
 	"github.com/go-playground/validator"
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/clients/redis"
+	"github.com/kldd0/goods-service/internal/deadletter"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/errmap"
+	"github.com/kldd0/goods-service/internal/logger"
 	"github.com/kldd0/goods-service/internal/storage"
-	"github.com/nats-io/stan.go"
+	"github.com/kldd0/goods-service/internal/validation"
+)
+
+type CommandType string
+
+const (
+	CommandCreate CommandType = "create"
+	CommandUpdate CommandType = "update"
+	CommandDelete CommandType = "delete"
+)
+
+// Command is a change of a good sent to the commands subject.
+// Good holds the good to create, the updated good, or the id
+// and the project of the good to delete.
+type Command struct {
+	CorrelationID string      `json:"correlation_id"`
+	Type          CommandType `json:"type"`
+	Good          models.Good `json:"good"`
+}
+
+type ResultStatus string
+
+const (
+	ResultOK    ResultStatus = "ok"
+	ResultError ResultStatus = "error"
+)
+
+// Result is published to the results subject for every processed command.
+type Result struct {
+	CorrelationID string       `json:"correlation_id"`
+	Type          CommandType  `json:"type"`
+	Status        ResultStatus `json:"status"`
+	Good          *models.Good `json:"good,omitempty"`
+	Error         string       `json:"error,omitempty"`
+}
+
+var (
+	ErrMalformedCommand = errors.New("malformed command")
+	ErrUnknownCommand   = errors.New("unknown command type")
 )
 
+type Cache interface {
+	Delete(ctx context.Context, key string) error
+	GetCommandResult(ctx context.Context, key string) ([]byte, error)
+	SaveCommandResult(ctx context.Context, key string, result []byte, ttl time.Duration) error
+}
+
+type changePublisher interface {
+	Publish(ev changefeed.Event) changefeed.Event
+}
+
+// publisher drops the messages with the id of an already published one.
+type publisher interface {
+	Publish(ctx context.Context, msgID string, v any) error
+}
+
 type Service struct {
-	ctx context.Context
-	db  storage.Storage
+	log         *slog.Logger
+	db          storage.Storage
+	cache       Cache
+	feed        changePublisher
+	results     publisher
+	deadLetters publisher
+	maxAttempts int
+	resultTTL   time.Duration
 }
 
-func New(ctx context.Context, db storage.Storage) *Service {
+// New creates the consumer of the good commands. A command failing for a
+// reason retrying won't fix, or failing maxAttempts times, is moved to
+// the dead letters. The results of the applied commands are kept for
+// resultTTL, so that a command redelivered in that time isn't applied again.
+func New(log *slog.Logger, db storage.Storage, cache Cache, feed changePublisher, results, deadLetters publisher, maxAttempts int, resultTTL time.Duration) *Service {
 	return &Service{
-		ctx: ctx,
-		db:  db,
+		log:         log,
+		db:          db,
+		cache:       cache,
+		feed:        feed,
+		results:     results,
+		deadLetters: deadLetters,
+		maxAttempts: maxAttempts,
+		resultTTL:   resultTTL,
 	}
 }
 
-func (s *Service) Run(msgChan <-chan stan.Msg) {
-	for {
-		select {
-		case <-s.ctx.Done():
-			log.Println("Context cancelled")
-		case msg := <-msgChan:
-			if err := s.ProcessMessage(msg); err != nil {
-				log.Println("Error: processing message:", err)
-			}
-		}
+// Process is the handler of the commands subscription. It applies the command
+// delivered for the attempt time and reports whether the message is done with
+// and can be acked: the command is committed or dead-lettered.
+func (s *Service) Process(ctx context.Context, subject string, sequence uint64, attempt int, data []byte) bool {
+	const op = "service.Process"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Uint64("sequence", sequence),
+		slog.Int("attempt", attempt),
+	)
+
+	err := s.handle(ctx, sequence, data, attempt >= s.maxAttempts)
+	if err == nil {
+		return true
 	}
+
+	if !final(err) && attempt < s.maxAttempts {
+		return false
+	}
+
+	// the ids derived from the sequence of the command drop the messages
+	// published again on its redelivery
+	err = s.deadLetters.Publish(ctx, fmt.Sprintf("dlq-%d", sequence), deadletter.Message{
+		Subject:  subject,
+		Sequence: sequence,
+		Attempts: attempt,
+		Reason:   err.Error(),
+		Data:     data,
+		FailedAt: time.Now(),
+	})
+	if err != nil {
+		// redelivered until it is dead-lettered
+		log.Error("failed to dead-letter message", logger.Err(err))
+		return false
+	}
+
+	log.Info("message dead-lettered")
+
+	return true
 }
 
-func (s *Service) ProcessMessage(msg stan.Msg) error {
-	const op = "service.ProcessMessage"
+// handle applies the encoded command. The result of the command is published
+// when it is done with: it succeeded, failed for a reason retrying won't fix,
+// or failed on the last attempt.
+func (s *Service) handle(ctx context.Context, sequence uint64, data []byte, lastAttempt bool) error {
+	const op = "service.handle"
+
+	log := s.log.With(slog.String("op", op))
+
+	var cmd Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		err = fmt.Errorf("%w: %v", ErrMalformedCommand, err)
+		log.Error("failed unmarshalling command", logger.Err(err))
+		s.publish(ctx, log, sequence, Result{
+			Status: ResultError,
+			Error:  err.Error(),
+		})
+		return err
+	}
 
-	var order
-	err := json.Unmarshal(msg.Data, &order)
+	log = log.With(
+		slog.String("correlation_id", cmd.CorrelationID),
+		slog.String("type", string(cmd.Type)),
+	)
+
+	// a command redelivered after its ack was lost is already applied
+	if res, ok := s.appliedResult(ctx, log, cmd.CorrelationID); ok {
+		log.Info("command already applied")
+		s.publish(ctx, log, sequence, res)
+		return nil
+	}
+
+	good, err := s.apply(ctx, log, cmd)
+	if err != nil && !final(err) {
+		log.Error("failed applying command", logger.Err(err))
+
+		if !lastAttempt {
+			return err
+		}
+	}
+
+	res := Result{
+		CorrelationID: cmd.CorrelationID,
+		Type:          cmd.Type,
+		Status:        ResultOK,
+	}
 
 	if err != nil {
-		return fmt.Errorf("%s: failed unmarshalling data: %w", op, err)
+		log.Info("command rejected", logger.Err(err))
+		res.Status = ResultError
+		res.Error = message(err)
+	} else if cmd.Type != CommandDelete {
+		res.Good = &good
+	}
+
+	// the rejected commands are applied again when they are replayed
+	if err == nil {
+		s.saveResult(ctx, log, res)
+	}
+
+	s.publish(ctx, log, sequence, res)
+
+	return err
+}
+
+func (s *Service) apply(ctx context.Context, log *slog.Logger, cmd Command) (models.Good, error) {
+	if cmd.CorrelationID == "" {
+		return models.Good{}, fmt.Errorf("%w: correlation_id is required", ErrMalformedCommand)
+	}
+
+	switch cmd.Type {
+	case CommandCreate:
+		return s.create(ctx, log, cmd.Good)
+	case CommandUpdate:
+		return s.update(ctx, log, cmd.Good)
+	case CommandDelete:
+		return models.Good{}, s.delete(ctx, log, cmd.Good)
+	default:
+		return models.Good{}, fmt.Errorf("%w: %q", ErrUnknownCommand, cmd.Type)
+	}
+}
+
+func (s *Service) create(ctx context.Context, log *slog.Logger, newGood models.Good) (models.Good, error) {
+	// the id is assigned by the database
+	newGood.ID = 0
+
+	if err := validation.Good(newGood); err != nil {
+		return models.Good{}, err
+	}
+
+	good, err := s.db.SaveGood(ctx, newGood)
+	if errors.Is(err, storage.ErrGettingInsertedRows) {
+		log.Info("failed to get inserted row", logger.Err(err))
+	} else if err != nil {
+		return models.Good{}, err
+	}
+
+	log.Info("good added", slog.Int64("id", int64(good.ID)))
+
+	s.feed.Publish(changefeed.Event{
+		Type:      changefeed.EventCreate,
+		ProjectId: good.ProjectId,
+		GoodId:    good.ID,
+		Good:      &good,
+	})
+
+	return good, nil
+}
+
+func (s *Service) update(ctx context.Context, log *slog.Logger, patchedGood models.Good) (models.Good, error) {
+	if err := validation.PatchedGood(patchedGood); err != nil {
+		return models.Good{}, err
+	}
+
+	good, err := s.db.PatchGood(ctx, patchedGood)
+	if errors.Is(err, storage.ErrGettingInsertedRows) {
+		log.Info("failed getting inserted row", logger.Err(err))
+	} else if err != nil {
+		return models.Good{}, err
 	}
 
-	if err := validator.New().Struct(order); err != nil {
-		return fmt.Errorf("%s: invalid data: %w", op, err.(validator.ValidationErrors))
+	// invalidate cache
+	key := redis.GoodKey(strconv.Itoa(patchedGood.ID), strconv.Itoa(patchedGood.ProjectId))
+	if err := s.cache.Delete(ctx, key); err != nil {
+		log.Error("failed to delete good from cache", logger.Err(err))
 	}
 
-	if err = s.db.Save(s.ctx, order); err != nil {
-		return fmt.Errorf("%s: saving order: %w", op, err)
+	log.Info("good patched", slog.Int64("id", int64(good.ID)))
+
+	// an update that sets the priority moves the good in the project ordering
+	eventType := changefeed.EventUpdate
+	if patchedGood.Priority != nil {
+		eventType = changefeed.EventReprioritize
+	}
+
+	s.feed.Publish(changefeed.Event{
+		Type:      eventType,
+		ProjectId: patchedGood.ProjectId,
+		GoodId:    patchedGood.ID,
+		Good:      &good,
+	})
+
+	return good, nil
+}
+
+func (s *Service) delete(ctx context.Context, log *slog.Logger, good models.Good) error {
+	goodId := strconv.Itoa(good.ID)
+	projectId := strconv.Itoa(good.ProjectId)
+
+	if err := s.db.DeleteGood(ctx, goodId, projectId); err != nil {
+		return err
 	}
 
-	log.Printf("Message with order_uid: [%s] has been saved", order.OrderUid)
+	log.Info("good removed", slog.String("id", goodId))
+
+	// invalidate cache
+	if err := s.cache.Delete(ctx, redis.GoodKey(goodId, projectId)); err != nil {
+		log.Error("failed to delete good from cache", logger.Err(err))
+	}
+
+	s.feed.Publish(changefeed.Event{
+		Type:      changefeed.EventDelete,
+		ProjectId: good.ProjectId,
+		GoodId:    good.ID,
+	})
 
 	return nil
 }
-*/
+
+// appliedResult returns the saved result of the command with the
+// correlation id. The command is applied when the cache fails.
+func (s *Service) appliedResult(ctx context.Context, log *slog.Logger, correlationID string) (Result, bool) {
+	if correlationID == "" {
+		return Result{}, false
+	}
+
+	data, err := s.cache.GetCommandResult(ctx, redis.CommandKey(correlationID))
+	if err != nil {
+		if !errors.Is(err, redis.ErrKeyNotFound) {
+			log.Error("failed to get command result", logger.Err(err))
+		}
+		return Result{}, false
+	}
+
+	var res Result
+	if err := json.Unmarshal(data, &res); err != nil {
+		log.Error("failed unmarshalling command result", logger.Err(err))
+		return Result{}, false
+	}
+
+	return res, true
+}
+
+// saveResult keeps the result of the applied command until its redeliveries
+// are over, it is saved before the command is acked.
+func (s *Service) saveResult(ctx context.Context, log *slog.Logger, res Result) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		log.Error("failed marshalling command result", logger.Err(err))
+		return
+	}
+
+	if err := s.cache.SaveCommandResult(ctx, redis.CommandKey(res.CorrelationID), data, s.resultTTL); err != nil {
+		log.Error("failed to save command result", logger.Err(err))
+	}
+}
+
+// publish sends the result of a command. The command is already committed
+// when it fails, so the result is lost rather than the command applied twice.
+func (s *Service) publish(ctx context.Context, log *slog.Logger, sequence uint64, res Result) {
+	if err := s.results.Publish(ctx, fmt.Sprintf("result-%d", sequence), res); err != nil {
+		log.Error("failed to publish result", logger.Err(err))
+	}
+}
+
+// final reports whether the command fails the same way on every retry.
+func final(err error) bool {
+	if errors.Is(err, ErrMalformedCommand) || errors.Is(err, ErrUnknownCommand) {
+		return true
+	}
+
+	return errmap.KindOf(err) != errmap.Internal
+}
+
+func message(err error) string {
+	var validateErr validator.ValidationErrors
+	if errors.As(err, &validateErr) {
+		return validation.Message(validateErr)
+	}
+
+	switch {
+	case errors.Is(err, storage.ErrEntryDoesntExist):
+		return "good doesn't exist"
+	case errors.Is(err, storage.ErrEntryAlreadyExists):
+		return "good already exists"
+	default:
+		return err.Error()
+	}
+}
@@ -0,0 +1,226 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/clients/redis"
+	"github.com/kldd0/goods-service/internal/deadletter"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/service"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+// fakeStorage keeps the goods of project 1, the project methods aren't used.
+type fakeStorage struct {
+	storage.Storage
+
+	goods map[int]models.Good
+	err   error
+}
+
+func (s *fakeStorage) SaveGood(_ context.Context, good models.Good) (models.Good, error) {
+	if s.err != nil {
+		return models.Good{}, s.err
+	}
+
+	good.ID = len(s.goods) + 1
+	s.goods[good.ID] = good
+
+	return good, nil
+}
+
+func (s *fakeStorage) PatchGood(_ context.Context, good models.Good) (models.Good, error) {
+	if _, ok := s.goods[good.ID]; !ok {
+		return models.Good{}, storage.ErrEntryDoesntExist
+	}
+
+	s.goods[good.ID] = good
+
+	return good, nil
+}
+
+func (s *fakeStorage) DeleteGood(_ context.Context, goodId string, _ string) error {
+	id, _ := strconv.Atoi(goodId)
+	if _, ok := s.goods[id]; !ok {
+		return storage.ErrEntryDoesntExist
+	}
+
+	delete(s.goods, id)
+
+	return nil
+}
+
+// fakeCache keeps the command results, the goods aren't cached.
+type fakeCache struct {
+	results map[string][]byte
+}
+
+func newFakeCache() *fakeCache {
+	return &fakeCache{results: map[string][]byte{}}
+}
+
+func (*fakeCache) Delete(context.Context, string) error { return nil }
+
+func (c *fakeCache) GetCommandResult(_ context.Context, key string) ([]byte, error) {
+	result, ok := c.results[key]
+	if !ok {
+		return nil, redis.ErrKeyNotFound
+	}
+
+	return result, nil
+}
+
+func (c *fakeCache) SaveCommandResult(_ context.Context, key string, result []byte, _ time.Duration) error {
+	c.results[key] = result
+	return nil
+}
+
+type fakeResults struct {
+	results []service.Result
+}
+
+func (p *fakeResults) Publish(_ context.Context, _ string, v any) error {
+	p.results = append(p.results, v.(service.Result))
+	return nil
+}
+
+type fakeDeadLetters struct {
+	messages []deadletter.Message
+}
+
+func (p *fakeDeadLetters) Publish(_ context.Context, _ string, v any) error {
+	p.messages = append(p.messages, v.(deadletter.Message))
+	return nil
+}
+
+const maxAttempts = 3
+
+func TestProcess(t *testing.T) {
+	cases := []struct {
+		name    string
+		command string
+		dbErr   error
+		attempt int
+		acked   bool
+		// status of the published result, none when empty
+		status service.ResultStatus
+		dead   bool
+		goods  int
+	}{
+		{"create", `{"correlation_id":"1","type":"create","good":{"project_id":1,"name":"good"}}`, nil, 1, true, service.ResultOK, false, 2},
+		{"create without name", `{"correlation_id":"2","type":"create","good":{"project_id":1}}`, nil, 1, true, service.ResultError, true, 1},
+		{"update", `{"correlation_id":"3","type":"update","good":{"id":1,"project_id":1,"name":"new","description":"new"}}`, nil, 1, true, service.ResultOK, false, 1},
+		{"update missing", `{"correlation_id":"4","type":"update","good":{"id":5,"project_id":1,"name":"new","description":"new"}}`, nil, 1, true, service.ResultError, true, 1},
+		{"delete", `{"correlation_id":"5","type":"delete","good":{"id":1,"project_id":1}}`, nil, 1, true, service.ResultOK, false, 0},
+		{"unknown type", `{"correlation_id":"6","type":"rename","good":{}}`, nil, 1, true, service.ResultError, true, 1},
+		{"without correlation id", `{"type":"delete","good":{"id":1,"project_id":1}}`, nil, 1, true, service.ResultError, true, 1},
+		{"malformed", `{"type":`, nil, 1, true, service.ResultError, true, 1},
+		{"database failure", `{"correlation_id":"7","type":"create","good":{"project_id":1,"name":"good"}}`, errors.New("connection refused"), 1, false, "", false, 1},
+		{"database failure on last attempt", `{"correlation_id":"8","type":"create","good":{"project_id":1,"name":"good"}}`, errors.New("connection refused"), maxAttempts, true, service.ResultError, true, 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &fakeStorage{goods: map[int]models.Good{1: {ID: 1, ProjectId: 1, Name: "good"}}, err: tc.dbErr}
+			results := &fakeResults{}
+			deadLetters := &fakeDeadLetters{}
+
+			svc := service.New(
+				slog.New(slog.NewTextHandler(io.Discard, nil)),
+				db, newFakeCache(), changefeed.NewHub(16), results, deadLetters, maxAttempts, time.Hour,
+			)
+
+			acked := svc.Process(context.Background(), "goods.commands", 42, tc.attempt, []byte(tc.command))
+			if acked != tc.acked {
+				t.Fatalf("got acked %v, want %v", acked, tc.acked)
+			}
+
+			if len(db.goods) != tc.goods {
+				t.Errorf("got %d goods, want %d", len(db.goods), tc.goods)
+			}
+
+			if tc.status == "" && len(results.results) != 0 {
+				t.Errorf("got results %+v, want none", results.results)
+			}
+
+			if tc.status != "" {
+				if len(results.results) != 1 {
+					t.Fatalf("got %d results, want 1", len(results.results))
+				}
+
+				res := results.results[0]
+				if res.Status != tc.status {
+					data, _ := json.Marshal(res)
+					t.Errorf("got result %s, want status %s", data, tc.status)
+				}
+
+				var cmd service.Command
+				if json.Unmarshal([]byte(tc.command), &cmd) == nil && res.CorrelationID != cmd.CorrelationID {
+					t.Errorf("got correlation id %q, want %q", res.CorrelationID, cmd.CorrelationID)
+				}
+			}
+
+			if !tc.dead {
+				if len(deadLetters.messages) != 0 {
+					t.Errorf("got dead letters %+v, want none", deadLetters.messages)
+				}
+				return
+			}
+
+			if len(deadLetters.messages) != 1 {
+				t.Fatalf("got %d dead letters, want 1", len(deadLetters.messages))
+			}
+
+			msg := deadLetters.messages[0]
+			if string(msg.Data) != tc.command || msg.Sequence != 42 || msg.Attempts != tc.attempt || msg.Reason == "" {
+				t.Errorf("got dead letter %+v", msg)
+			}
+		})
+	}
+}
+
+func TestRedelivered(t *testing.T) {
+	db := &fakeStorage{goods: map[int]models.Good{}}
+	results := &fakeResults{}
+
+	svc := service.New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		db, newFakeCache(), changefeed.NewHub(16), results, &fakeDeadLetters{}, maxAttempts, time.Hour,
+	)
+
+	create := []byte(`{"correlation_id":"1","type":"create","good":{"project_id":1,"name":"good"}}`)
+	rejected := []byte(`{"correlation_id":"2","type":"update","good":{"id":5,"project_id":1,"name":"new","description":"new"}}`)
+
+	// the ack of the first delivery was lost
+	for attempt := 1; attempt <= 2; attempt++ {
+		if !svc.Process(context.Background(), "goods.commands", 42, attempt, create) {
+			t.Fatalf("the delivery %d of the create isn't acked", attempt)
+		}
+	}
+
+	if len(db.goods) != 1 {
+		t.Errorf("got %d goods, want the command applied once", len(db.goods))
+	}
+
+	if len(results.results) != 2 || results.results[1].Good == nil || results.results[1].Good.ID != results.results[0].Good.ID {
+		t.Errorf("got results %+v, want the first one published again", results.results)
+	}
+
+	// the rejected commands aren't saved, they are applied again on replay
+	svc.Process(context.Background(), "goods.commands", 43, 1, rejected)
+
+	db.goods[5] = models.Good{ID: 5, ProjectId: 1, Name: "good"}
+	svc.Process(context.Background(), "goods.commands", 44, 1, rejected)
+
+	if res := results.results[len(results.results)-1]; res.Status != service.ResultOK {
+		t.Errorf("got result %+v of the replayed command, want it applied", res)
+	}
+}
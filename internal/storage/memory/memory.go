@@ -0,0 +1,354 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+// Scheme is the scheme of the db uri selecting the storage.
+const Scheme = "memory://"
+
+// Storage keeps the data in the memory of the process, for the tests and
+// the local runs. It follows the constraints of the postgres storage: the
+// ids and the priorities are generated the same way, the goods and the
+// webhooks need their project and the priorities are unique in a project.
+type Storage struct {
+	mu sync.RWMutex
+
+	projects map[int]models.Project
+	goods    map[int]models.Good
+	// lastPriority is the last priority given in every project
+	lastPriority map[int]int
+
+	webhooks   map[int]models.Webhook
+	deliveries map[int]models.WebhookDelivery
+
+	// the next ids given when the entries are saved without one
+	nextProjectId  int
+	nextGoodId     int
+	nextWebhookId  int
+	nextDeliveryId int
+}
+
+// New creates a storage holding the project created by the migrations.
+func New() *Storage {
+	return &Storage{
+		projects: map[int]models.Project{
+			1: {ID: 1, Name: "Запись 1", CreatedAt: now()},
+		},
+		goods:          make(map[int]models.Good),
+		lastPriority:   make(map[int]int),
+		webhooks:       make(map[int]models.Webhook),
+		deliveries:     make(map[int]models.WebhookDelivery),
+		nextProjectId:  2,
+		nextGoodId:     1,
+		nextWebhookId:  1,
+		nextDeliveryId: 1,
+	}
+}
+
+func (s *Storage) GetGood(_ context.Context, goodId string, projectId string) (models.Good, error) {
+	const op = "storage.memory.GetGood"
+
+	id, project, err := ids(goodId, projectId)
+	if err != nil {
+		return models.Good{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	good, ok := s.goods[id]
+	if !ok || good.ProjectId != project {
+		return models.Good{}, storage.ErrEntryDoesntExist
+	}
+
+	return copyGood(good), nil
+}
+
+// SaveGood inserts the good with the id given by the client, if any,
+// or with the next id otherwise. The good takes the next priority of its
+// project when it has none.
+func (s *Storage) SaveGood(_ context.Context, good models.Good) (models.Good, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.projects[good.ProjectId]; !ok {
+		return models.Good{}, storage.ErrEntryDoesntExist
+	}
+
+	if good.ID == 0 {
+		good.ID = s.nextGoodId
+	}
+
+	if _, ok := s.goods[good.ID]; ok {
+		return models.Good{}, storage.ErrEntryAlreadyExists
+	}
+
+	priority := s.lastPriority[good.ProjectId] + 1
+	if good.Priority != nil {
+		priority = *good.Priority
+	}
+
+	if s.priorityTaken(good.ProjectId, priority, good.ID) {
+		return models.Good{}, storage.ErrEntryAlreadyExists
+	}
+
+	good.Priority = &priority
+	good.CreatedAt = now()
+
+	s.goods[good.ID] = good
+	s.lastPriority[good.ProjectId] = max(s.lastPriority[good.ProjectId], priority)
+	s.nextGoodId = max(s.nextGoodId, good.ID+1)
+
+	return copyGood(good), nil
+}
+
+// PatchGood updates the name, the description, the priority and the removal
+// of the good, the priority is kept when omitted.
+func (s *Storage) PatchGood(_ context.Context, patchedGood models.Good) (models.Good, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	good, ok := s.goods[patchedGood.ID]
+	if !ok || good.ProjectId != patchedGood.ProjectId {
+		return models.Good{}, storage.ErrEntryDoesntExist
+	}
+
+	if patchedGood.Priority != nil {
+		priority := *patchedGood.Priority
+
+		// the priority is taken by another good of the project
+		if s.priorityTaken(good.ProjectId, priority, good.ID) {
+			return models.Good{}, storage.ErrEntryAlreadyExists
+		}
+
+		good.Priority = &priority
+		s.lastPriority[good.ProjectId] = max(s.lastPriority[good.ProjectId], priority)
+	}
+
+	good.Name = patchedGood.Name
+	good.Description = patchedGood.Description
+	good.Removed = patchedGood.Removed
+
+	s.goods[good.ID] = good
+
+	return copyGood(good), nil
+}
+
+func (s *Storage) DeleteGood(_ context.Context, goodId string, projectId string) error {
+	const op = "storage.memory.DeleteGood"
+
+	id, project, err := ids(goodId, projectId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	good, ok := s.goods[id]
+	if !ok || good.ProjectId != project {
+		return storage.ErrEntryDoesntExist
+	}
+
+	delete(s.goods, id)
+
+	return nil
+}
+
+func (s *Storage) ListGoodsWithPagination(_ context.Context, offset, limit string) ([]models.Good, error) {
+	const op = "storage.memory.ListGoodsWithPagination"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	goods := make([]models.Good, 0, len(s.goods))
+	for _, good := range s.goods {
+		goods = append(goods, copyGood(good))
+	}
+
+	sort.Slice(goods, func(i, j int) bool { return goods[i].ID < goods[j].ID })
+
+	goods, err := page(goods, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return goods, nil
+}
+
+func (s *Storage) GetProject(_ context.Context, projectId string) (models.Project, error) {
+	const op = "storage.memory.GetProject"
+
+	id, err := strconv.Atoi(projectId)
+	if err != nil {
+		return models.Project{}, fmt.Errorf("%s: invalid id %q", op, projectId)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	project, ok := s.projects[id]
+	if !ok {
+		return models.Project{}, storage.ErrEntryDoesntExist
+	}
+
+	return project, nil
+}
+
+func (s *Storage) SaveProject(_ context.Context, project models.Project) (models.Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	project.ID = s.nextProjectId
+	project.CreatedAt = now()
+
+	s.projects[project.ID] = project
+	s.nextProjectId++
+
+	return project, nil
+}
+
+func (s *Storage) PatchProject(_ context.Context, patchedProject models.Project) (models.Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	project, ok := s.projects[patchedProject.ID]
+	if !ok {
+		return models.Project{}, storage.ErrEntryDoesntExist
+	}
+
+	project.Name = patchedProject.Name
+	s.projects[project.ID] = project
+
+	return project, nil
+}
+
+// DeleteProject deletes the project with its webhooks, a project with goods
+// can't be deleted.
+func (s *Storage) DeleteProject(_ context.Context, projectId string) error {
+	const op = "storage.memory.DeleteProject"
+
+	id, err := strconv.Atoi(projectId)
+	if err != nil {
+		return fmt.Errorf("%s: invalid id %q", op, projectId)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.projects[id]; !ok {
+		return storage.ErrEntryDoesntExist
+	}
+
+	for _, good := range s.goods {
+		if good.ProjectId == id {
+			return storage.ErrEntryInUse
+		}
+	}
+
+	for webhookId, webhook := range s.webhooks {
+		if webhook.ProjectId == id {
+			s.deleteWebhook(webhookId)
+		}
+	}
+
+	delete(s.projects, id)
+	delete(s.lastPriority, id)
+
+	return nil
+}
+
+func (s *Storage) ListProjectsWithPagination(_ context.Context, offset, limit string) ([]models.Project, error) {
+	const op = "storage.memory.ListProjectsWithPagination"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	projects := make([]models.Project, 0, len(s.projects))
+	for _, project := range s.projects {
+		projects = append(projects, project)
+	}
+
+	sort.Slice(projects, func(i, j int) bool { return projects[i].ID < projects[j].ID })
+
+	projects, err := page(projects, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return projects, nil
+}
+
+func (s *Storage) Close() error {
+	return nil
+}
+
+// priorityTaken reports whether another good of the project has the priority.
+func (s *Storage) priorityTaken(projectId int, priority int, goodId int) bool {
+	for _, good := range s.goods {
+		if good.ID != goodId && good.ProjectId == projectId && *good.Priority == priority {
+			return true
+		}
+	}
+
+	return false
+}
+
+// page cuts the page of the entries at offset, at most limit long.
+func page[T any](entries []T, offset, limit string) ([]T, error) {
+	from, err := strconv.Atoi(offset)
+	if err != nil || from < 0 {
+		return nil, fmt.Errorf("invalid offset %q", offset)
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid limit %q", limit)
+	}
+
+	if from >= len(entries) {
+		return []T{}, nil
+	}
+
+	return entries[from:min(from+n, len(entries))], nil
+}
+
+// ids parses the ids of an entry and of its project.
+func ids(entryId, projectId string) (int, int, error) {
+	id, err := strconv.Atoi(entryId)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid id %q", entryId)
+	}
+
+	project, err := strconv.Atoi(projectId)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid project id %q", projectId)
+	}
+
+	return id, project, nil
+}
+
+// copyGood copies the priority, so that the stored good isn't changed
+// through the returned one.
+func copyGood(good models.Good) models.Good {
+	if good.Priority != nil {
+		priority := *good.Priority
+		good.Priority = &priority
+	}
+
+	return good
+}
+
+// now is the time of the changes, as precise as the timestamps of postgres.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
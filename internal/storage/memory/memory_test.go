@@ -0,0 +1,109 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/storage"
+	"github.com/kldd0/goods-service/internal/storage/memory"
+	"github.com/kldd0/goods-service/internal/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return memory.New()
+	})
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestReturnedGoodIsCopy(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+
+	saved, err := db.SaveGood(ctx, models.Good{ProjectId: 1, Name: "good", Priority: intPtr(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*saved.Priority = 100
+
+	stored, err := db.GetGood(ctx, "1", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stored.Priority != 1 {
+		t.Error("the stored good was changed through the returned one")
+	}
+}
+
+func TestDeleteProject(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+
+	good, _ := db.SaveGood(ctx, models.Good{ProjectId: 1, Name: "a"})
+	webhook, err := db.SaveWebhook(ctx, models.Webhook{ProjectId: 1, URL: "http://example.com", Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteProject(ctx, "1"); err == nil {
+		t.Fatal("deleted the project with goods")
+	}
+
+	if err := db.DeleteGood(ctx, "1", "1"); err != nil {
+		t.Fatalf("delete good %d: %v", good.ID, err)
+	}
+
+	if err := db.DeleteProject(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.GetWebhook(ctx, "1", "1"); !errors.Is(err, storage.ErrEntryDoesntExist) {
+		t.Errorf("webhook %d of the deleted project: got %v, want %v", webhook.ID, err, storage.ErrEntryDoesntExist)
+	}
+}
+
+func TestSearchHighlights(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+
+	_, _ = db.SaveGood(ctx, models.Good{ProjectId: 1, Name: "Red apple", Description: "Apples and pears"})
+
+	matches, err := db.SearchGoods(ctx, "", "app", "0", "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("matches: got %+v, want the apple", matches)
+	}
+
+	if matches[0].NameHighlight != "Red <b>apple</b>" {
+		t.Errorf("name highlight: got %q", matches[0].NameHighlight)
+	}
+	if matches[0].DescriptionHighlight != "<b>Apples</b> and pears" {
+		t.Errorf("description highlight: got %q", matches[0].DescriptionHighlight)
+	}
+
+	// only the tags of the highlights are html
+	_, _ = db.SaveGood(ctx, models.Good{ProjectId: 1, Name: `<img src=x onerror="alert(1)">`, Description: "Tom & Jerry's"})
+
+	matches, err = db.SearchGoods(ctx, "1", "img jerry", "0", "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("matches: got %+v, want the image", matches)
+	}
+
+	if want := `&lt;<b>img</b> src=x onerror=&#34;alert(1)&#34;&gt;`; matches[0].NameHighlight != want {
+		t.Errorf("name highlight: got %q, want %q", matches[0].NameHighlight, want)
+	}
+	if want := `Tom &amp; <b>Jerry</b>&#39;s`; matches[0].DescriptionHighlight != want {
+		t.Errorf("description highlight: got %q, want %q", matches[0].DescriptionHighlight, want)
+	}
+}
@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kldd0/goods-service/internal/domain/models"
+)
+
+// words are the parts of the texts matched by the search
+var words = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// the weights of the matches in the name and in the description of a good
+const (
+	nameWeight        = 1.0
+	descriptionWeight = 0.4
+)
+
+// SearchGoods finds the goods having every word of the query or a longer
+// word starting with it in their name or description. Unlike postgres it
+// doesn't stem the words and highlights the whole description.
+func (s *Storage) SearchGoods(_ context.Context, projectId string, query string, offset, limit string) ([]models.GoodMatch, error) {
+	const op = "storage.memory.SearchGoods"
+
+	terms := words.FindAllString(strings.ToLower(query), -1)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	project := 0
+	if projectId != "" {
+		id, err := strconv.Atoi(projectId)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid project id %q", op, projectId)
+		}
+		project = id
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matches := []models.GoodMatch{}
+	for _, good := range s.goods {
+		if project != 0 && good.ProjectId != project {
+			continue
+		}
+
+		rank, ok := match(terms, good)
+		if !ok {
+			continue
+		}
+
+		matches = append(matches, models.GoodMatch{
+			Good:                 copyGood(good),
+			Rank:                 rank,
+			NameHighlight:        highlight(good.Name, terms),
+			DescriptionHighlight: highlight(good.Description, terms),
+		})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Rank != matches[j].Rank {
+			return matches[i].Rank > matches[j].Rank
+		}
+		return matches[i].ID < matches[j].ID
+	})
+
+	matches, err := page(matches, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return matches, nil
+}
+
+// match ranks the good by the words of its name and description starting
+// with the terms, it doesn't match unless every term is found.
+func match(terms []string, good models.Good) (float32, bool) {
+	name := words.FindAllString(strings.ToLower(good.Name), -1)
+	description := words.FindAllString(strings.ToLower(good.Description), -1)
+
+	var rank float32
+	for _, term := range terms {
+		inName := count(name, term)
+		inDescription := count(description, term)
+		if inName+inDescription == 0 {
+			return 0, false
+		}
+
+		rank += nameWeight*float32(inName) + descriptionWeight*float32(inDescription)
+	}
+
+	return rank / float32(len(name)+len(description)), true
+}
+
+// count is the number of the words starting with the term.
+func count(words []string, term string) int {
+	n := 0
+	for _, word := range words {
+		if strings.HasPrefix(word, term) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// highlight escapes the html of the text and wraps the words of the text
+// starting with a term in <b>.
+func highlight(text string, terms []string) string {
+	var b strings.Builder
+
+	last := 0
+	for _, loc := range words.FindAllStringIndex(text, -1) {
+		b.WriteString(html.EscapeString(text[last:loc[0]]))
+		last = loc[1]
+
+		word := text[loc[0]:loc[1]]
+		if hasPrefix(strings.ToLower(word), terms) {
+			b.WriteString("<b>" + word + "</b>")
+		} else {
+			b.WriteString(word)
+		}
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+
+	return b.String()
+}
+
+func hasPrefix(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,233 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+func (s *Storage) GetWebhook(_ context.Context, projectId string, webhookId string) (models.Webhook, error) {
+	const op = "storage.memory.GetWebhook"
+
+	id, project, err := ids(webhookId, projectId)
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhook, ok := s.webhooks[id]
+	if !ok || webhook.ProjectId != project {
+		return models.Webhook{}, storage.ErrEntryDoesntExist
+	}
+
+	return copyWebhook(webhook), nil
+}
+
+func (s *Storage) SaveWebhook(_ context.Context, webhook models.Webhook) (models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the project of the webhook doesn't exist
+	if _, ok := s.projects[webhook.ProjectId]; !ok {
+		return models.Webhook{}, storage.ErrEntryDoesntExist
+	}
+
+	webhook = copyWebhook(webhook)
+	webhook.ID = s.nextWebhookId
+	webhook.Failures = 0
+	webhook.CreatedAt = now()
+
+	s.webhooks[webhook.ID] = webhook
+	s.nextWebhookId++
+
+	return copyWebhook(webhook), nil
+}
+
+// PatchWebhook updates the url, the event types and the state of the webhook,
+// the secret is only updated when set. Enabling the webhook forgets its failures.
+func (s *Storage) PatchWebhook(_ context.Context, patchedWebhook models.Webhook) (models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, ok := s.webhooks[patchedWebhook.ID]
+	if !ok || webhook.ProjectId != patchedWebhook.ProjectId {
+		return models.Webhook{}, storage.ErrEntryDoesntExist
+	}
+
+	if patchedWebhook.Enabled && !webhook.Enabled {
+		webhook.Failures = 0
+	}
+
+	webhook.URL = patchedWebhook.URL
+	if patchedWebhook.Secret != "" {
+		webhook.Secret = patchedWebhook.Secret
+	}
+	webhook.EventTypes = copyWebhook(patchedWebhook).EventTypes
+	webhook.Enabled = patchedWebhook.Enabled
+
+	s.webhooks[webhook.ID] = webhook
+
+	return copyWebhook(webhook), nil
+}
+
+func (s *Storage) DeleteWebhook(_ context.Context, projectId string, webhookId string) error {
+	const op = "storage.memory.DeleteWebhook"
+
+	id, project, err := ids(webhookId, projectId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, ok := s.webhooks[id]
+	if !ok || webhook.ProjectId != project {
+		return storage.ErrEntryDoesntExist
+	}
+
+	s.deleteWebhook(id)
+
+	return nil
+}
+
+func (s *Storage) ListWebhooks(_ context.Context, projectId string) ([]models.Webhook, error) {
+	const op = "storage.memory.ListWebhooks"
+
+	project, err := strconv.Atoi(projectId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid project id %q", op, projectId)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhooks := []models.Webhook{}
+	for _, webhook := range s.webhooks {
+		if webhook.ProjectId == project {
+			webhooks = append(webhooks, copyWebhook(webhook))
+		}
+	}
+
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+
+	return webhooks, nil
+}
+
+func (s *Storage) RecordWebhookResult(_ context.Context, webhookId string, success bool, disableAfter int) (models.Webhook, error) {
+	const op = "storage.memory.RecordWebhookResult"
+
+	id, err := strconv.Atoi(webhookId)
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("%s: invalid id %q", op, webhookId)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return models.Webhook{}, storage.ErrEntryDoesntExist
+	}
+
+	if success {
+		webhook.Failures = 0
+	} else {
+		webhook.Enabled = webhook.Enabled && webhook.Failures+1 < disableAfter
+		webhook.Failures++
+	}
+
+	s.webhooks[id] = webhook
+
+	return copyWebhook(webhook), nil
+}
+
+func (s *Storage) SaveWebhookDelivery(_ context.Context, delivery models.WebhookDelivery) (models.WebhookDelivery, error) {
+	const op = "storage.memory.SaveWebhookDelivery"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[delivery.WebhookId]; !ok {
+		return models.WebhookDelivery{}, fmt.Errorf("%s: webhook %d doesn't exist", op, delivery.WebhookId)
+	}
+
+	delivery.ID = s.nextDeliveryId
+	delivery.StatusCode = copyStatus(delivery.StatusCode)
+	delivery.CreatedAt = now()
+
+	s.deliveries[delivery.ID] = delivery
+	s.nextDeliveryId++
+
+	return copyDelivery(delivery), nil
+}
+
+// ListWebhookDeliveries returns the deliveries of the webhook, the latest first.
+func (s *Storage) ListWebhookDeliveries(_ context.Context, webhookId string, offset, limit string) ([]models.WebhookDelivery, error) {
+	const op = "storage.memory.ListWebhookDeliveries"
+
+	id, err := strconv.Atoi(webhookId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid id %q", op, webhookId)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := []models.WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.WebhookId == id {
+			deliveries = append(deliveries, copyDelivery(delivery))
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+
+	deliveries, err = page(deliveries, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+// deleteWebhook deletes the webhook with its deliveries.
+func (s *Storage) deleteWebhook(id int) {
+	for deliveryId, delivery := range s.deliveries {
+		if delivery.WebhookId == id {
+			delete(s.deliveries, deliveryId)
+		}
+	}
+
+	delete(s.webhooks, id)
+}
+
+// copyWebhook copies the event types, no event types are kept as an empty
+// list rather than nil like in postgres.
+func copyWebhook(webhook models.Webhook) models.Webhook {
+	webhook.EventTypes = append([]string{}, webhook.EventTypes...)
+
+	return webhook
+}
+
+func copyDelivery(delivery models.WebhookDelivery) models.WebhookDelivery {
+	delivery.StatusCode = copyStatus(delivery.StatusCode)
+
+	return delivery
+}
+
+func copyStatus(code *int) *int {
+	if code == nil {
+		return nil
+	}
+
+	c := *code
+
+	return &c
+}
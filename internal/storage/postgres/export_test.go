@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	TxRetryDelay = txRetryDelay
+	MaxTxBackoff = maxTxBackoff
+)
+
+// TxIsolation returns the isolation level of the transaction of the context.
+func (s *Storage) TxIsolation(ctx context.Context) (string, error) {
+	rows, err := s.conn(ctx).Query(ctx, `SHOW transaction_isolation;`)
+	if err != nil {
+		return "", err
+	}
+
+	return pgx.CollectOneRow(rows, pgx.RowTo[string])
+}
+
+// NewWithReplicas returns a storage with a replica per health state, and its
+// primary and replica pools. The pools don't connect until they are used,
+// the addresses refuse the connections.
+func NewWithReplicas(t *testing.T, healthy ...bool) (*Storage, *pgxpool.Pool, []*pgxpool.Pool) {
+	t.Helper()
+
+	s := &Storage{pool: unreachablePool(t)}
+	if len(healthy) == 0 {
+		return s, s.pool, nil
+	}
+
+	s.replicas = &replicaSet{}
+
+	var pools []*pgxpool.Pool
+	for _, h := range healthy {
+		r := &replica{pool: unreachablePool(t)}
+		r.healthy.Store(h)
+
+		s.replicas.replicas = append(s.replicas.replicas, r)
+		pools = append(pools, r.pool)
+	}
+
+	return s, s.pool, pools
+}
+
+func unreachablePool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	pool, err := pgxpool.New(context.Background(), "postgres://user@127.0.0.1:1/db?connect_timeout=1")
+	if err != nil {
+		t.Fatalf("new pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
+// SetReplicaHealth overrides the last health check of the replica.
+func (s *Storage) SetReplicaHealth(i int, healthy bool) {
+	s.replicas.replicas[i].healthy.Store(healthy)
+}
+
+// CheckReplicas runs a health check of the replicas.
+func (s *Storage) CheckReplicas(ctx context.Context, period time.Duration) {
+	s.replicas.check(ctx, period)
+}
+
+// Reader returns the connection the reads made with the context go to.
+func (s *Storage) Reader(ctx context.Context) any {
+	return s.reader(ctx)
+}
+
+// WithTxOf returns the context of the storage calls made in the transaction.
+func WithTxOf(ctx context.Context, tx pgx.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// SetGoodIdSequence sets the last id drawn from the sequence of the goods.
+func (s *Storage) SetGoodIdSequence(ctx context.Context, id int) error {
+	_, err := s.pool.Exec(ctx, `SELECT setval(pg_get_serial_sequence('goods', 'id'), $1);`, id)
+	return err
+}
@@ -0,0 +1,68 @@
+package postgres_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+func TestGeneratedIdTaken(t *testing.T) {
+	db := open(t)
+	ctx := context.Background()
+
+	project, err := db.SaveProject(ctx, models.Project{Name: "ids"})
+	if err != nil {
+		t.Fatalf("save project: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		run  func(ctx context.Context, fn func(ctx context.Context) error) error
+	}{
+		{"without transaction", func(ctx context.Context, fn func(ctx context.Context) error) error {
+			return fn(ctx)
+		}},
+		{"in transaction", func(ctx context.Context, fn func(ctx context.Context) error) error {
+			return db.WithTx(ctx, storage.IsolationDefault, fn)
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			generated, err := db.SaveGood(ctx, models.Good{ProjectId: project.ID, Name: "generated"})
+			if err != nil {
+				t.Fatalf("save good: %v", err)
+			}
+
+			// the next id is taken as if it was saved before the sequence moved past it
+			chosen, err := db.SaveGood(ctx, models.Good{ID: generated.ID + 1, ProjectId: project.ID, Name: "chosen"})
+			if err != nil {
+				t.Fatalf("save good with id: %v", err)
+			}
+			if err := db.SetGoodIdSequence(ctx, generated.ID); err != nil {
+				t.Fatalf("set sequence: %v", err)
+			}
+
+			err = tc.run(ctx, func(ctx context.Context) error {
+				good, err := db.SaveGood(ctx, models.Good{ProjectId: project.ID, Name: "retried"})
+				if err != nil {
+					return err
+				}
+
+				if good.ID <= chosen.ID {
+					t.Errorf("got id %d, want one past the taken %d", good.ID, chosen.ID)
+				}
+
+				// the transaction is still usable after the retry
+				_, err = db.GetGood(ctx, strconv.Itoa(good.ID), strconv.Itoa(project.ID))
+				return err
+			})
+			if err != nil {
+				t.Fatalf("save good drawing a taken id: %v", err)
+			}
+		})
+	}
+}
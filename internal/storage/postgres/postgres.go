@@ -2,214 +2,267 @@ package postgres
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kldd0/goods-service/internal/config"
 	"github.com/kldd0/goods-service/internal/domain/models"
 	"github.com/kldd0/goods-service/internal/storage"
+)
 
-	"github.com/jmoiron/sqlx"
+// the codes of the constraint violations, see
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
 )
 
-const dbDriver = "pgx"
+// the description of a good is nullable in the table but not in the model
+const goodColumns = `id, project_id, name, COALESCE(description, '') AS description, priority, removed, created_at`
+
+const projectColumns = `id, name, created_at`
 
+// Storage keeps the data in PostgreSQL through a pool of connections.
+// The statements are prepared on the first use on every connection and
+// kept in its statement cache. The reads of the goods and the lists are
+// spread over the healthy read replicas, if any.
 type Storage struct {
-	db *sqlx.DB
+	pool     *pgxpool.Pool
+	replicas *replicaSet
+	// isolation and txRetries are the defaults of WithTx
+	isolation storage.Isolation
+	txRetries int
 }
 
-func New(dbUri string) (*Storage, error) {
+func New(ctx context.Context, dbUri string, cfg config.Postgres) (*Storage, error) {
 	const op = "storage.postgres.New"
 
-	db, err := sqlx.Open(dbDriver, dbUri)
+	isolation, err := isolationLevel(cfg.TxIsolation)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pool, err := newPool(ctx, dbUri, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("%s: open db connection: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err = db.Ping(); err != nil {
+	if err = pool.Ping(ctx); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("%s: db ping failed: %w", op, err)
 	}
 
+	replicas, err := newReplicaSet(ctx, cfg)
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
 	return &Storage{
-		db: db,
+		pool:      pool,
+		replicas:  replicas,
+		isolation: isolation,
+		txRetries: cfg.TxMaxRetries,
 	}, nil
 }
 
-func (s *Storage) GetGood(ctx context.Context, goodId string, projectId string) (models.Good, error) {
-	const op = "storage.postgres.GetGood"
-
-	q := `SELECT * FROM goods WHERE id=$1 AND project_id=$2;`
-
-	stmt, err := s.db.PrepareContext(ctx, q)
+// newPool configures the pool of the connections to the database.
+func newPool(ctx context.Context, dbUri string, cfg config.Postgres) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(dbUri)
 	if err != nil {
-		return models.Good{}, fmt.Errorf("%s: prepare statement: %w", op, err)
+		return nil, fmt.Errorf("parse db uri: %w", err)
 	}
 
-	var resultGood models.Good
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = cfg.MaxConns
+	}
+	poolConfig.MinConns = cfg.MinConns
+	poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	if cfg.HealthCheckPeriod > 0 {
+		poolConfig.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
 
-	err = stmt.QueryRowContext(ctx, goodId, projectId).Scan(
-		&resultGood.ID,
-		&resultGood.ProjectId,
-		&resultGood.Name,
-		&resultGood.Description,
-		&resultGood.Priority,
-		&resultGood.Removed,
-		&resultGood.CreatedAt,
-	)
+	poolConfig.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	if cfg.StatementCacheCapacity > 0 {
+		poolConfig.ConnConfig.StatementCacheCapacity = cfg.StatementCacheCapacity
+	}
 
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return models.Good{}, storage.ErrEntryDoesntExist
-		}
+	if cfg.StatementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
 
-		return models.Good{}, fmt.Errorf("%s: saving entry: %w", op, err)
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("open db connection: %w", err)
 	}
 
-	return resultGood, nil
+	return pool, nil
 }
 
-func (s *Storage) SaveGood(ctx context.Context, good models.Good) (models.Good, error) {
-	const op = "storage.postgres.SaveGood"
+func (s *Storage) GetGood(ctx context.Context, goodId string, projectId string) (models.Good, error) {
+	const op = "storage.postgres.GetGood"
 
-	// check if entry exists
-	q := `SELECT id FROM goods WHERE id=$1 FOR SHARE;`
+	q := `SELECT ` + goodColumns + ` FROM goods WHERE id=$1 AND project_id=$2;`
 
-	stmt, err := s.db.PrepareContext(ctx, q)
+	good, err := queryOne[models.Good](ctx, s.reader(ctx), q, goodId, projectId)
 	if err != nil {
-		return models.Good{}, fmt.Errorf("%s: prepare statement: %w", op, err)
-	}
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Good{}, storage.ErrEntryDoesntExist
+		}
 
-	res, err := stmt.ExecContext(ctx, good.ID)
-	if err != nil {
 		return models.Good{}, fmt.Errorf("%s: execute statement: %w", op, err)
 	}
 
-	c, err := res.RowsAffected()
-	if err != nil {
-		if c != 0 {
-			return models.Good{}, storage.ErrEntryAlreadyExists
-		}
+	return good, nil
+}
 
-		return models.Good{}, fmt.Errorf("%s: get info about affected rows: %w", op, err)
-	}
+// maxIdRetries is how many times an insert drawing an id taken by a good
+// saved with its own id meanwhile is retried
+const maxIdRetries = 3
 
-	q = `INSERT INTO goods (project_id, name, description, priority, removed, created_at)
-            VALUES ($1, $2, $3, $4, $5, $6) RETURNING
-            id, project_id, name, description, priority, removed, created_at;`
+// SaveGood inserts the good with the id given by the client, if any,
+// or with the next id of the sequence otherwise.
+func (s *Storage) SaveGood(ctx context.Context, good models.Good) (models.Good, error) {
+	const op = "storage.postgres.SaveGood"
 
-	stmt, err = s.db.PrepareContext(ctx, q)
-	if err != nil {
-		return models.Good{}, fmt.Errorf("%s: prepare statement: %w", op, err)
+	if good.ID != 0 {
+		return s.saveGoodWithId(ctx, good)
 	}
 
-	var resultGood models.Good
-
-	err = stmt.QueryRowContext(
-		ctx, good.ProjectId, good.Name, good.Description, good.Priority, good.Removed, time.Now(),
-	).Scan(
-		&resultGood.ID,
-		&resultGood.ProjectId,
-		&resultGood.Name,
-		&resultGood.Description,
-		&resultGood.Priority,
-		&resultGood.Removed,
-		&resultGood.CreatedAt,
-	)
-
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return models.Good{}, storage.ErrGettingInsertedRows
+	q := `INSERT INTO goods (project_id, name, description, priority, removed, created_at)
+            VALUES ($1, $2, $3, $4, $5, $6) RETURNING ` + goodColumns + `;`
+
+	for attempt := 0; ; attempt++ {
+		var resultGood models.Good
+
+		// the savepoint keeps the transaction of the context usable for the retry
+		err := s.savepoint(ctx, func(ctx context.Context) (err error) {
+			resultGood, err = queryOne[models.Good](
+				ctx, s.conn(ctx), q, good.ProjectId, good.Name, good.Description, good.Priority, good.Removed, time.Now(),
+			)
+			return err
+		})
+		if err == nil {
+			return resultGood, nil
 		}
 
-		return models.Good{}, fmt.Errorf("%s: saving entry: %w", op, err)
+		// the drawn id was saved with its own id before the sequence moved past it
+		if !goodIdTaken(err) || attempt >= maxIdRetries {
+			return models.Good{}, saveGoodErr(op, err)
+		}
 	}
-
-	return resultGood, nil
 }
 
-func (s *Storage) PatchGood(ctx context.Context, patchedGood models.Good) (models.Good, error) {
-	const op = "storage.postgres.Patch"
+// saveGoodWithId inserts the good with its own id and moves the sequence
+// past it, so that the generated ids don't run into it later. The saves
+// with their own ids move the sequence one at a time, so that it never
+// goes back, while the inserts drawing an id meanwhile retry on a taken one.
+func (s *Storage) saveGoodWithId(ctx context.Context, good models.Good) (resultGood models.Good, err error) {
+	const op = "storage.postgres.saveGoodWithId"
 
-	// Begin transaction
-	tx, err := s.db.BeginTxx(ctx, nil)
-	if err != nil {
-		return models.Good{}, fmt.Errorf("%s: begin transaction: %w", op, err)
-	}
+	err = s.WithTx(ctx, storage.IsolationDefault, func(ctx context.Context) error {
+		q := `INSERT INTO goods (id, project_id, name, description, priority, removed, created_at)
+                VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING ` + goodColumns + `;`
 
-	defer func() {
+		resultGood, err = queryOne[models.Good](
+			ctx, s.conn(ctx), q, good.ID, good.ProjectId, good.Name, good.Description, good.Priority, good.Removed, time.Now(),
+		)
 		if err != nil {
-			_ = tx.Rollback()
-			return
+			return saveGoodErr(op, err)
 		}
-	}()
 
-	// check if entry exists
-	q := `SELECT id FROM goods WHERE id=$1 AND project_id=$2 FOR SHARE;`
+		q = `SELECT pg_advisory_xact_lock(pg_get_serial_sequence('goods', 'id')::regclass::oid::bigint);`
+
+		if _, err := s.conn(ctx).Exec(ctx, q); err != nil {
+			return fmt.Errorf("%s: lock id sequence: %w", op, err)
+		}
+
+		// drawing an id tells whether the sequence is behind the saved one
+		q = `SELECT setval(seq, $1)
+                FROM (SELECT pg_get_serial_sequence('goods', 'id')::regclass AS seq) AS s
+                WHERE nextval(seq) <= $1;`
+
+		if _, err := s.conn(ctx).Exec(ctx, q, resultGood.ID); err != nil {
+			return fmt.Errorf("%s: move id sequence: %w", op, err)
+		}
 
-	stmt, err := tx.PrepareContext(ctx, q)
+		return nil
+	})
 	if err != nil {
-		return models.Good{}, fmt.Errorf("%s: prepare statement: %w", op, err)
+		return models.Good{}, err
 	}
 
-	res, err := stmt.ExecContext(ctx, patchedGood.ID, patchedGood.ProjectId)
-	if err != nil {
-		return models.Good{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	return resultGood, nil
+}
+
+// goodIdTaken reports whether the insertion of a good failed on its id.
+func goodIdTaken(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation {
+		return false
 	}
 
-	c, err := res.RowsAffected()
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return models.Good{}, storage.ErrEntryDoesntExist
-		}
+	return pgErr.ConstraintName == "goods_pkey" || pgErr.ConstraintName == "goods_id_name_idx"
+}
 
-		return models.Good{}, fmt.Errorf("%s: get info about affected rows: %w", op, err)
+// saveGoodErr maps the errors of the insertion of a good.
+func saveGoodErr(op string, err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storage.ErrGettingInsertedRows
 	}
 
-	if c == 0 {
-		return models.Good{}, storage.ErrEntryDoesntExist
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		// the id or the priority is taken
+		case uniqueViolation:
+			return storage.ErrEntryAlreadyExists
+		// the project of the good doesn't exist
+		case foreignKeyViolation:
+			return storage.ErrEntryDoesntExist
+		}
 	}
 
-	q = `UPDATE goods SET name=$1, description=$2, priority=$3, removed=$4 WHERE id=$5 AND project_id=$6 RETURNING
-            id, project_id, name, description, priority, removed, created_at;`
+	return fmt.Errorf("%s: saving entry: %w", op, err)
+}
 
-	stmt, err = tx.PrepareContext(ctx, q)
-	if err != nil {
-		return models.Good{}, fmt.Errorf("%s: prepare statement: %w", op, err)
-	}
+func (s *Storage) PatchGood(ctx context.Context, patchedGood models.Good) (models.Good, error) {
+	const op = "storage.postgres.Patch"
 
-	var resultGood models.Good
+	// the priority is kept when omitted
+	q := `UPDATE goods SET name=$1, description=$2, priority=COALESCE($3, priority), removed=$4
+            WHERE id=$5 AND project_id=$6 RETURNING ` + goodColumns + `;`
 
-	err = stmt.QueryRowContext(
+	resultGood, err := queryOne[models.Good](
 		ctx,
+		s.conn(ctx),
+		q,
 		patchedGood.Name,
 		patchedGood.Description,
 		patchedGood.Priority,
 		patchedGood.Removed,
 		patchedGood.ID,
 		patchedGood.ProjectId,
-	).Scan(
-		&resultGood.ID,
-		&resultGood.ProjectId,
-		&resultGood.Name,
-		&resultGood.Description,
-		&resultGood.Priority,
-		&resultGood.Removed,
-		&resultGood.CreatedAt,
 	)
 
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return models.Good{}, storage.ErrGettingInsertedRows
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Good{}, storage.ErrEntryDoesntExist
 		}
 
-		return models.Good{}, fmt.Errorf("%s: execute statement: %w", op, err)
-	}
+		// the priority is taken by another good of the project
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return models.Good{}, storage.ErrEntryAlreadyExists
+		}
 
-	// commit the transaction
-	if err := tx.Commit(); err != nil {
-		return models.Good{}, fmt.Errorf("%s: commit transaction: %w", op, err)
+		return models.Good{}, fmt.Errorf("%s: execute statement: %w", op, err)
 	}
 
 	return resultGood, nil
@@ -218,68 +271,173 @@ func (s *Storage) PatchGood(ctx context.Context, patchedGood models.Good) (model
 func (s *Storage) ListGoodsWithPagination(ctx context.Context, offset, limit string) ([]models.Good, error) {
 	const op = "storage.postgres.ListGoodsWithPagination"
 
-	q := `SELECT id, project_id, name, description, priority, removed, created_at FROM goods
-            ORDER BY id OFFSET $1 LIMIT $2;`
+	q := `SELECT ` + goodColumns + ` FROM goods ORDER BY id OFFSET $1 LIMIT $2;`
 
-	stmt, err := s.db.PrepareContext(ctx, q)
+	goods, err := queryAll[models.Good](ctx, s.reader(ctx), q, offset, limit)
 	if err != nil {
-		return []models.Good{}, fmt.Errorf("%s: prepare statement: %w", op, err)
+		return nil, fmt.Errorf("%s: execute statement: %w", op, err)
 	}
 
-	rows, err := stmt.QueryContext(ctx, offset, limit)
+	return goods, nil
+}
+
+func (s *Storage) DeleteGood(ctx context.Context, goodId string, projectId string) error {
+	const op = "storage.postgres.DeleteGood"
+
+	q := `DELETE FROM goods WHERE id=$1 AND project_id=$2`
+
+	tag, err := s.conn(ctx).Exec(ctx, q, goodId, projectId)
 	if err != nil {
-		return []models.Good{}, fmt.Errorf("%s: execute statement: %w", op, err)
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return storage.ErrEntryDoesntExist
 	}
 
-	var goods []models.Good
-
-	for rows.Next() {
-		var good models.Good
-
-		if err := rows.Scan(
-			&good.ID,
-			&good.ProjectId,
-			&good.Name,
-			&good.Description,
-			&good.Priority,
-			&good.Removed,
-			&good.CreatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("%s: scanning bytes of row: %w", op, err)
+	return nil
+}
+
+func (s *Storage) GetProject(ctx context.Context, projectId string) (models.Project, error) {
+	const op = "storage.postgres.GetProject"
+
+	q := `SELECT ` + projectColumns + ` FROM projects WHERE id=$1;`
+
+	project, err := queryOne[models.Project](ctx, s.conn(ctx), q, projectId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Project{}, storage.ErrEntryDoesntExist
 		}
 
-		goods = append(goods, good)
+		return models.Project{}, fmt.Errorf("%s: execute statement: %w", op, err)
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("%s: error iterating over rows: %w", op, err)
+	return project, nil
+}
+
+func (s *Storage) SaveProject(ctx context.Context, project models.Project) (models.Project, error) {
+	const op = "storage.postgres.SaveProject"
+
+	q := `INSERT INTO projects (name, created_at) VALUES ($1, $2) RETURNING ` + projectColumns + `;`
+
+	resultProject, err := queryOne[models.Project](ctx, s.conn(ctx), q, project.Name, time.Now())
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Project{}, storage.ErrGettingInsertedRows
+		}
+
+		return models.Project{}, fmt.Errorf("%s: saving entry: %w", op, err)
 	}
 
-	return goods, nil
+	return resultProject, nil
 }
 
-func (s *Storage) DeleteGood(ctx context.Context, goodId string, projectId string) error {
-	const op = "storage.postgres.DeleteGood"
+func (s *Storage) PatchProject(ctx context.Context, patchedProject models.Project) (models.Project, error) {
+	const op = "storage.postgres.PatchProject"
 
-	q := `DELETE FROM goods WHERE id=$1 AND project_id=$2`
+	q := `UPDATE projects SET name=$1 WHERE id=$2 RETURNING ` + projectColumns + `;`
 
-	stmt, err := s.db.PrepareContext(ctx, q)
+	resultProject, err := queryOne[models.Project](ctx, s.conn(ctx), q, patchedProject.Name, patchedProject.ID)
 	if err != nil {
-		return fmt.Errorf("%s: prepare statement: %w", op, err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Project{}, storage.ErrEntryDoesntExist
+		}
+
+		return models.Project{}, fmt.Errorf("%s: execute statement: %w", op, err)
 	}
 
-	_, err = stmt.ExecContext(ctx, goodId, projectId)
+	return resultProject, nil
+}
+
+func (s *Storage) DeleteProject(ctx context.Context, projectId string) error {
+	const op = "storage.postgres.DeleteProject"
+
+	q := `DELETE FROM projects WHERE id=$1`
+
+	tag, err := s.conn(ctx).Exec(ctx, q, projectId)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return storage.ErrEntryDoesntExist
+		// the goods of the project reference it
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+			return storage.ErrEntryInUse
 		}
 
 		return fmt.Errorf("%s: execute statement: %w", op, err)
 	}
 
+	if tag.RowsAffected() == 0 {
+		return storage.ErrEntryDoesntExist
+	}
+
 	return nil
 }
 
+func (s *Storage) ListProjectsWithPagination(ctx context.Context, offset, limit string) ([]models.Project, error) {
+	const op = "storage.postgres.ListProjectsWithPagination"
+
+	q := `SELECT ` + projectColumns + ` FROM projects ORDER BY id OFFSET $1 LIMIT $2;`
+
+	projects, err := queryAll[models.Project](ctx, s.reader(ctx), q, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return projects, nil
+}
+
+// PoolStats reports the state of the connection pools.
+func (s *Storage) PoolStats() storage.PoolStats {
+	stats := poolStats(s.pool)
+	stats.Replicas = s.replicas.stats()
+
+	return stats
+}
+
+func poolStats(pool *pgxpool.Pool) storage.PoolStats {
+	stat := pool.Stat()
+
+	return storage.PoolStats{
+		MaxConns:                stat.MaxConns(),
+		TotalConns:              stat.TotalConns(),
+		AcquiredConns:           stat.AcquiredConns(),
+		IdleConns:               stat.IdleConns(),
+		ConstructingConns:       stat.ConstructingConns(),
+		AcquireCount:            stat.AcquireCount(),
+		AcquireDurationMs:       stat.AcquireDuration().Milliseconds(),
+		EmptyAcquireCount:       stat.EmptyAcquireCount(),
+		CanceledAcquireCount:    stat.CanceledAcquireCount(),
+		NewConnsCount:           stat.NewConnsCount(),
+		MaxLifetimeDestroyCount: stat.MaxLifetimeDestroyCount(),
+		MaxIdleDestroyCount:     stat.MaxIdleDestroyCount(),
+	}
+}
+
 func (s *Storage) Close() error {
-	return s.db.Close()
+	s.replicas.close()
+	s.pool.Close()
+
+	return nil
+}
+
+// queryOne scans the single row of the query into a struct, matching the
+// columns to the fields by name. It returns pgx.ErrNoRows without a row.
+func queryOne[T any](ctx context.Context, db querier, q string, args ...any) (T, error) {
+	rows, err := db.Query(ctx, q, args...)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return pgx.CollectOneRow(rows, pgx.RowToStructByName[T])
+}
+
+// queryAll scans the rows of the query into structs, matching the
+// columns to the fields by name.
+func queryAll[T any](ctx context.Context, db querier, q string, args ...any) ([]T, error) {
+	rows, err := db.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[T])
 }
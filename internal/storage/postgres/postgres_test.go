@@ -0,0 +1,72 @@
+package postgres_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/kldd0/goods-service/internal/config"
+	"github.com/kldd0/goods-service/internal/migrate"
+	"github.com/kldd0/goods-service/internal/storage"
+	"github.com/kldd0/goods-service/internal/storage/postgres"
+	"github.com/kldd0/goods-service/internal/storage/storagetest"
+	"github.com/pressly/goose/v3"
+)
+
+// uriEnv names the uri of a disposable database the tests run against,
+// they are skipped without it. The migrations are applied to it.
+const uriEnv = "TEST_POSTGRES_URI"
+
+func TestConformance(t *testing.T) {
+	db := open(t)
+
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return db
+	})
+}
+
+// open connects to the migrated test database, the test is skipped without it.
+func open(t *testing.T) *postgres.Storage {
+	t.Helper()
+
+	uri := os.Getenv(uriEnv)
+	if uri == "" {
+		t.Skipf("%s isn't set", uriEnv)
+	}
+
+	migrateUp(t, uri)
+
+	var cfg config.Postgres
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		t.Fatalf("read config defaults: %v", err)
+	}
+
+	db, err := postgres.New(context.Background(), uri, cfg)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+func migrateUp(t *testing.T, uri string) {
+	t.Helper()
+
+	db, err := goose.OpenDBWithDriver(migrate.Postgres.Driver, uri)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	p, err := migrate.Postgres.Provider(db)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	if _, err := p.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+}
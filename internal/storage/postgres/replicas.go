@@ -0,0 +1,173 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kldd0/goods-service/internal/config"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+// defaultReplicaCheckPeriod is how often the replicas are pinged when
+// the config doesn't tell
+const defaultReplicaCheckPeriod = 5 * time.Second
+
+type replica struct {
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+// replicaSet takes the reads of the storage in turn, skipping the replicas
+// failing their health checks.
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+
+	stop    context.CancelFunc
+	stopped sync.WaitGroup
+}
+
+// newReplicaSet connects to the replicas of the config and starts their
+// health checks, it is nil without replicas. A replica unavailable on start
+// doesn't fail it, the reads go to the others until it answers.
+func newReplicaSet(ctx context.Context, cfg config.Postgres) (*replicaSet, error) {
+	if len(cfg.Replicas) == 0 {
+		return nil, nil
+	}
+
+	set := &replicaSet{}
+
+	for i, uri := range cfg.Replicas {
+		pool, err := newPool(ctx, uri, cfg)
+		if err != nil {
+			set.closePools()
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+
+		set.replicas = append(set.replicas, &replica{pool: pool})
+	}
+
+	period := cfg.ReplicaCheckPeriod
+	if period <= 0 {
+		period = defaultReplicaCheckPeriod
+	}
+
+	set.check(ctx, period)
+
+	checkCtx, stop := context.WithCancel(context.Background())
+	set.stop = stop
+	set.stopped.Add(1)
+
+	go func() {
+		defer set.stopped.Done()
+
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				set.check(checkCtx, period)
+			case <-checkCtx.Done():
+				return
+			}
+		}
+	}()
+
+	return set, nil
+}
+
+// check pings every replica, a replica not answering within the period
+// is unhealthy until the next check.
+func (set *replicaSet) check(ctx context.Context, period time.Duration) {
+	var wg sync.WaitGroup
+
+	for _, r := range set.replicas {
+		wg.Add(1)
+
+		go func(r *replica) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, period)
+			defer cancel()
+
+			r.healthy.Store(r.pool.Ping(ctx) == nil)
+		}(r)
+	}
+
+	wg.Wait()
+}
+
+// pick returns the next healthy replica, nil when there are none.
+func (set *replicaSet) pick() *pgxpool.Pool {
+	if set == nil {
+		return nil
+	}
+
+	start := set.next.Add(1)
+	for i := range set.replicas {
+		r := set.replicas[(start+uint64(i))%uint64(len(set.replicas))]
+		if r.healthy.Load() {
+			return r.pool
+		}
+	}
+
+	return nil
+}
+
+func (set *replicaSet) stats() []storage.ReplicaStats {
+	if set == nil {
+		return nil
+	}
+
+	stats := make([]storage.ReplicaStats, 0, len(set.replicas))
+	for _, r := range set.replicas {
+		stats = append(stats, storage.ReplicaStats{
+			Healthy:   r.healthy.Load(),
+			PoolStats: poolStats(r.pool),
+		})
+	}
+
+	return stats
+}
+
+func (set *replicaSet) close() {
+	if set == nil {
+		return
+	}
+
+	set.stop()
+	set.stopped.Wait()
+
+	set.closePools()
+}
+
+func (set *replicaSet) closePools() {
+	for _, r := range set.replicas {
+		r.pool.Close()
+	}
+}
+
+// reader returns the connection of a read: the transaction of the context,
+// if any, the primary when the context requires it or when no replica is
+// healthy, and the next healthy replica otherwise.
+func (s *Storage) reader(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+
+	if storage.PrimaryRequired(ctx) {
+		return s.pool
+	}
+
+	if pool := s.replicas.pick(); pool != nil {
+		return pool
+	}
+
+	return s.pool
+}
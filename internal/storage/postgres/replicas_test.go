@@ -0,0 +1,125 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/kldd0/goods-service/internal/storage"
+	"github.com/kldd0/goods-service/internal/storage/postgres"
+)
+
+// fakeTx is a transaction of the context, never used for a statement
+type fakeTx struct {
+	pgx.Tx
+}
+
+// readers returns the connections of n reads.
+func readers(s *postgres.Storage, ctx context.Context, n int) []any {
+	conns := make([]any, n)
+	for i := range conns {
+		conns[i] = s.Reader(ctx)
+	}
+
+	return conns
+}
+
+func TestReaderRoundRobin(t *testing.T) {
+	s, _, replicas := postgres.NewWithReplicas(t, true, true, true)
+
+	got := readers(s, context.Background(), 6)
+
+	// the replicas take the reads in turn
+	for i := range got {
+		if got[i] != got[(i+3)%len(got)] || got[i] == got[(i+1)%len(got)] {
+			t.Fatalf("got readers %v, want the replicas in turn", got)
+		}
+	}
+
+	seen := map[any]bool{}
+	for _, conn := range got {
+		seen[conn] = true
+	}
+	for i, replica := range replicas {
+		if !seen[replica] {
+			t.Errorf("replica %d got no read", i)
+		}
+	}
+}
+
+func TestReaderSkipsUnhealthy(t *testing.T) {
+	s, primary, replicas := postgres.NewWithReplicas(t, true, false, true)
+
+	for _, conn := range readers(s, context.Background(), 6) {
+		if conn == replicas[1] {
+			t.Fatal("the unhealthy replica got a read")
+		}
+		if conn == primary {
+			t.Fatal("the primary got a read with healthy replicas")
+		}
+	}
+
+	// the replica gets the reads again once healthy
+	s.SetReplicaHealth(1, true)
+
+	found := false
+	for _, conn := range readers(s, context.Background(), 3) {
+		found = found || conn == replicas[1]
+	}
+	if !found {
+		t.Error("the replica got no read once healthy")
+	}
+}
+
+func TestReaderFallsBackToPrimary(t *testing.T) {
+	cases := []struct {
+		name    string
+		healthy []bool
+	}{
+		{"no replicas", nil},
+		{"no healthy replica", []bool{false, false}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, primary, _ := postgres.NewWithReplicas(t, tc.healthy...)
+
+			for _, conn := range readers(s, context.Background(), 3) {
+				if conn != primary {
+					t.Fatalf("got reader %v, want the primary", conn)
+				}
+			}
+		})
+	}
+}
+
+func TestReaderOfContext(t *testing.T) {
+	s, primary, _ := postgres.NewWithReplicas(t, true, true)
+
+	// the reads marked to see the writes go to the primary
+	for _, conn := range readers(s, storage.WithPrimary(context.Background()), 3) {
+		if conn != primary {
+			t.Fatalf("got reader %v with the primary required, want the primary", conn)
+		}
+	}
+
+	// the reads of a transaction stay in it
+	tx := &fakeTx{}
+	for _, conn := range readers(s, postgres.WithTxOf(context.Background(), tx), 3) {
+		if conn != tx {
+			t.Fatalf("got reader %v in a transaction, want the transaction", conn)
+		}
+	}
+}
+
+func TestCheckReplicas(t *testing.T) {
+	s, primary, _ := postgres.NewWithReplicas(t, true, true)
+
+	// the replicas refusing the connections are unhealthy
+	s.CheckReplicas(context.Background(), time.Second)
+
+	if conn := s.Reader(context.Background()); conn != primary {
+		t.Errorf("got reader %v after the failed checks, want the primary", conn)
+	}
+}
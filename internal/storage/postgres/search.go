@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/kldd0/goods-service/internal/domain/models"
+)
+
+// words are the parts of the search text used in the query, anything else
+// is dropped so that the text can't inject the tsquery operators
+var words = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// prefixQuery makes the tsquery of the goods matching every word of the text
+// or a longer word starting with it, empty when the text has no words.
+func prefixQuery(text string) string {
+	terms := words.FindAllString(text, -1)
+	for i, term := range terms {
+		terms[i] = term + ":*"
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+// escapeHTML is the sql escaping the html special characters of the text
+// like html.EscapeString, the highlights are made of the escaped texts so
+// that only their <b> tags are html
+func escapeHTML(text string) string {
+	return `replace(replace(replace(replace(replace(` + text +
+		`, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;')`
+}
+
+// headlineConfig picks the text search configuration highlighting
+// the stemmed matches of the language of the text.
+func headlineConfig(text string) string {
+	for _, r := range text {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return "russian"
+		}
+	}
+
+	return "english"
+}
+
+func (s *Storage) SearchGoods(ctx context.Context, projectId string, query string, offset, limit string) ([]models.GoodMatch, error) {
+	const op = "storage.postgres.SearchGoods"
+
+	tsquery := prefixQuery(query)
+	if tsquery == "" {
+		return nil, nil
+	}
+
+	// the search vector holds the words as they are and their english and
+	// russian stems, the query is made in each configuration to match them
+	q := `WITH q AS (
+                SELECT to_tsquery('simple', $1) || to_tsquery('english', $1) || to_tsquery('russian', $1) AS query
+            )
+            SELECT ` + goodColumns + `,
+                ts_rank(search, q.query) AS rank,
+                ts_headline($2::regconfig, ` + escapeHTML("name") + `, q.query, 'HighlightAll=true') AS name_highlight,
+                ts_headline($2::regconfig, ` + escapeHTML("COALESCE(description, '')") + `, q.query,
+                    'MaxFragments=2, MinWords=5, MaxWords=20') AS description_highlight
+            FROM goods, q
+            WHERE search @@ q.query AND ($3::bigint IS NULL OR project_id = $3::bigint)
+            ORDER BY rank DESC, id OFFSET $4 LIMIT $5;`
+
+	var project any
+	if projectId != "" {
+		project = projectId
+	}
+
+	matches, err := queryAll[models.GoodMatch](ctx, s.reader(ctx), q, tsquery, headlineConfig(query), project, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,69 @@
+package postgres_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/kldd0/goods-service/internal/domain/models"
+)
+
+func TestSearchStemming(t *testing.T) {
+	ctx := context.Background()
+	db := open(t)
+
+	project, err := db.SaveProject(ctx, models.Project{Name: t.Name()})
+	if err != nil {
+		t.Fatalf("save project: %v", err)
+	}
+	projectId := strconv.Itoa(project.ID)
+
+	save := func(good models.Good) models.Good {
+		good.ProjectId = project.ID
+		saved, err := db.SaveGood(ctx, good)
+		if err != nil {
+			t.Fatalf("save good %+v: %v", good, err)
+		}
+		return saved
+	}
+
+	apples := save(models.Good{Name: "Красные яблоки", Description: "сладкие и сочные"})
+	pie := save(models.Good{Name: "Пирог", Description: "пирог с яблоком и корицей"})
+	running := save(models.Good{Name: "Running shoes"})
+
+	cases := []struct {
+		name      string
+		query     string
+		ids       []int
+		highlight string
+	}{
+		// the forms of a russian word share its stem
+		{"cyrillic stem", "яблоко", []int{apples.ID, pie.ID}, "Красные <b>яблоки</b>"},
+		{"cyrillic prefix", "ябл", []int{apples.ID, pie.ID}, "Красные <b>яблоки</b>"},
+		{"cyrillic every word", "яблоко корица", []int{pie.ID}, "Пирог"},
+		{"english stem", "runs", []int{running.ID}, "<b>Running</b> shoes"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			matches, err := db.SearchGoods(ctx, projectId, tc.query, "0", "10")
+			if err != nil {
+				t.Fatalf("search goods: %v", err)
+			}
+
+			if len(matches) != len(tc.ids) {
+				t.Fatalf("got %+v, want the goods %v", matches, tc.ids)
+			}
+			// the name matches rank above the description ones
+			for i, match := range matches {
+				if match.ID != tc.ids[i] {
+					t.Errorf("got good %d at %d, want %d", match.ID, i, tc.ids[i])
+				}
+			}
+
+			if matches[0].NameHighlight != tc.highlight {
+				t.Errorf("got name highlight %q, want %q", matches[0].NameHighlight, tc.highlight)
+			}
+		})
+	}
+}
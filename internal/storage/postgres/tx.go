@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+// the codes of the failures of a transaction that may succeed on retry
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// txBackoff is the delay before the first retry of a transaction,
+// doubled on every next one up to maxTxBackoff
+const (
+	txBackoff    = 10 * time.Millisecond
+	maxTxBackoff = time.Second
+)
+
+// txKey is the context key of the transaction of the storage calls.
+type txKey struct{}
+
+// querier runs the statements on the pool or in a transaction.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// conn returns the transaction of the context, if any, or the pool.
+func (s *Storage) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+
+	return s.pool
+}
+
+// WithTx runs fn in a transaction of the isolation level, the default one
+// of the config when empty. The storage calls made with the context passed
+// to fn run in the transaction, which is committed when fn returns nil and
+// rolled back otherwise. A call made with a context already carrying a
+// transaction joins it.
+//
+// The transactions failed by a serialization failure or a deadlock are
+// retried, so fn may run more than once and shouldn't have other effects.
+func (s *Storage) WithTx(ctx context.Context, isolation storage.Isolation, fn func(ctx context.Context) error) error {
+	const op = "storage.postgres.WithTx"
+
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+
+	if isolation == storage.IsolationDefault {
+		isolation = s.isolation
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := s.runTx(ctx, isolation, fn)
+		if err == nil || !retryable(err) || attempt >= s.txRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(txRetryDelay(attempt)):
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", op, errors.Join(err, ctx.Err()))
+		}
+	}
+}
+
+// savepoint runs fn in a savepoint of the transaction of the context, if
+// any, so that the transaction outlives the failure of fn.
+func (s *Storage) savepoint(ctx context.Context, fn func(ctx context.Context) error) error {
+	const op = "storage.postgres.savepoint"
+
+	tx, ok := ctx.Value(txKey{}).(pgx.Tx)
+	if !ok {
+		return fn(ctx)
+	}
+
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: create savepoint: %w", op, err)
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, sp)); err != nil {
+		_ = sp.Rollback(ctx)
+		return err
+	}
+
+	if err := sp.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: release savepoint: %w", op, err)
+	}
+
+	return nil
+}
+
+// txRetryDelay returns the delay before the retry following the attempt.
+// Full jitter spreads the retries of the transactions failed together.
+func txRetryDelay(attempt int) time.Duration {
+	backoff := maxTxBackoff
+	// the shift is clamped before it overflows
+	if attempt < 32 && txBackoff<<attempt < maxTxBackoff {
+		backoff = txBackoff << attempt
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+func (s *Storage) runTx(ctx context.Context, isolation storage.Isolation, fn func(ctx context.Context) error) (err error) {
+	const op = "storage.postgres.runTx"
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.TxIsoLevel(isolation)})
+	if err != nil {
+		return fmt.Errorf("%s: begin transaction: %w", op, err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback(ctx)
+			panic(p)
+		}
+
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	if err = fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: commit transaction: %w", op, err)
+	}
+
+	return nil
+}
+
+// retryable reports whether the transaction failed for its concurrency
+// with the others and may succeed when run again.
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected
+}
+
+// isolationLevel checks the isolation level of the config.
+func isolationLevel(level string) (storage.Isolation, error) {
+	switch isolation := storage.Isolation(level); isolation {
+	case storage.IsolationDefault, storage.ReadCommitted, storage.RepeatableRead, storage.Serializable:
+		return isolation, nil
+	default:
+		return "", fmt.Errorf("unknown isolation level %q", level)
+	}
+}
@@ -0,0 +1,164 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/storage"
+	"github.com/kldd0/goods-service/internal/storage/postgres"
+)
+
+func TestTxRetryDelay(t *testing.T) {
+	// the backoff doubles up to the cap, far past the attempt overflowing it
+	for attempt := 0; attempt < 100; attempt++ {
+		for i := 0; i < 10; i++ {
+			if delay := postgres.TxRetryDelay(attempt); delay <= 0 || delay > postgres.MaxTxBackoff {
+				t.Fatalf("got delay %s after attempt %d, want up to %s", delay, attempt, postgres.MaxTxBackoff)
+			}
+		}
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	db := open(t)
+
+	errRollback := errors.New("rollback")
+
+	// exists saves a project in the transaction made by run, fn fails with
+	// fnErr after it, and reports whether the project exists afterwards
+	exists := func(t *testing.T, run func(fn func(ctx context.Context) error) error, fnErr error) bool {
+		t.Helper()
+
+		var project models.Project
+		err := run(func(ctx context.Context) error {
+			var err error
+			if project, err = db.SaveProject(ctx, models.Project{Name: t.Name()}); err != nil {
+				return err
+			}
+
+			return fnErr
+		})
+		if !errors.Is(err, fnErr) {
+			t.Fatalf("got error %v, want %v", err, fnErr)
+		}
+
+		_, err = db.GetProject(ctx, strconv.Itoa(project.ID))
+		if err != nil && !errors.Is(err, storage.ErrEntryDoesntExist) {
+			t.Fatalf("get project: %v", err)
+		}
+
+		return err == nil
+	}
+
+	tx := func(fn func(ctx context.Context) error) error {
+		return db.WithTx(ctx, storage.IsolationDefault, fn)
+	}
+
+	t.Run("commit", func(t *testing.T) {
+		if !exists(t, tx, nil) {
+			t.Error("the project of the committed transaction doesn't exist")
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		if exists(t, tx, errRollback) {
+			t.Error("the project of the rolled back transaction exists")
+		}
+	})
+
+	t.Run("join", func(t *testing.T) {
+		// the inner transaction succeeds, but it is the outer one rolled back
+		nested := func(fn func(ctx context.Context) error) error {
+			err := tx(func(ctx context.Context) error {
+				if err := db.WithTx(ctx, storage.Serializable, fn); err != nil {
+					return err
+				}
+				return errRollback
+			})
+			if errors.Is(err, errRollback) {
+				return nil
+			}
+			return err
+		}
+
+		if exists(t, nested, nil) {
+			t.Error("the project of the inner transaction outlived the outer one")
+		}
+	})
+
+	t.Run("isolation", func(t *testing.T) {
+		cases := []struct {
+			isolation storage.Isolation
+			level     string
+		}{
+			// the config default
+			{storage.IsolationDefault, "read committed"},
+			{storage.RepeatableRead, "repeatable read"},
+			{storage.Serializable, "serializable"},
+		}
+
+		for _, tc := range cases {
+			err := db.WithTx(ctx, tc.isolation, func(ctx context.Context) error {
+				level, err := db.TxIsolation(ctx)
+				if err != nil {
+					return err
+				}
+
+				if level != tc.level {
+					t.Errorf("got isolation %q for %q, want %q", level, tc.isolation, tc.level)
+				}
+
+				// the joined transactions keep the outer level
+				return db.WithTx(ctx, storage.Serializable, func(ctx context.Context) error {
+					if inner, err := db.TxIsolation(ctx); err != nil || inner != level {
+						t.Errorf("got isolation %q of the joined transaction, want %q", inner, level)
+					}
+					return nil
+				})
+			})
+			if err != nil {
+				t.Fatalf("with tx %q: %v", tc.isolation, err)
+			}
+		}
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			err      error
+			failures int
+			attempts int
+		}{
+			{"serialization failure", &pgconn.PgError{Code: "40001"}, 2, 3},
+			{"deadlock", &pgconn.PgError{Code: "40P01"}, 1, 2},
+			// the config default is 3 retries
+			{"too many failures", &pgconn.PgError{Code: "40001"}, 10, 4},
+			{"other error", &pgconn.PgError{Code: "23505"}, 1, 1},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				attempts := 0
+				err := tx(func(ctx context.Context) error {
+					attempts++
+					if attempts <= tc.failures {
+						return tc.err
+					}
+					return nil
+				})
+
+				if attempts != tc.attempts {
+					t.Errorf("got %d attempts, want %d", attempts, tc.attempts)
+				}
+				if failed := tc.failures >= tc.attempts; failed != (err != nil) {
+					t.Errorf("got error %v", err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+const webhookColumns = `id, project_id, url, secret, event_types, enabled, failures, created_at`
+
+const deliveryColumns = `id, webhook_id, event_id, event_type, attempt, status_code, error, success, duration_ms, created_at`
+
+func (s *Storage) GetWebhook(ctx context.Context, projectId string, webhookId string) (models.Webhook, error) {
+	const op = "storage.postgres.GetWebhook"
+
+	q := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id=$1 AND project_id=$2;`
+
+	webhook, err := queryOne[models.Webhook](ctx, s.conn(ctx), q, webhookId, projectId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Webhook{}, storage.ErrEntryDoesntExist
+		}
+
+		return models.Webhook{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return webhook, nil
+}
+
+func (s *Storage) SaveWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	const op = "storage.postgres.SaveWebhook"
+
+	q := `INSERT INTO webhooks (project_id, url, secret, event_types, enabled, created_at)
+            VALUES ($1, $2, $3, $4, $5, $6) RETURNING ` + webhookColumns + `;`
+
+	resultWebhook, err := queryOne[models.Webhook](
+		ctx, s.conn(ctx), q, webhook.ProjectId, webhook.URL, webhook.Secret, eventTypes(webhook.EventTypes), webhook.Enabled, time.Now(),
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Webhook{}, storage.ErrGettingInsertedRows
+		}
+
+		// the project of the webhook doesn't exist
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+			return models.Webhook{}, storage.ErrEntryDoesntExist
+		}
+
+		return models.Webhook{}, fmt.Errorf("%s: saving entry: %w", op, err)
+	}
+
+	return resultWebhook, nil
+}
+
+// PatchWebhook updates the url, the event types and the state of the webhook,
+// the secret is only updated when set. Enabling the webhook forgets its failures.
+func (s *Storage) PatchWebhook(ctx context.Context, patchedWebhook models.Webhook) (models.Webhook, error) {
+	const op = "storage.postgres.PatchWebhook"
+
+	q := `UPDATE webhooks SET url=$1, secret=COALESCE(NULLIF($2, ''), secret), event_types=$3, enabled=$4,
+            failures=CASE WHEN $4 AND NOT enabled THEN 0 ELSE failures END
+            WHERE id=$5 AND project_id=$6 RETURNING ` + webhookColumns + `;`
+
+	resultWebhook, err := queryOne[models.Webhook](
+		ctx,
+		s.conn(ctx),
+		q,
+		patchedWebhook.URL,
+		patchedWebhook.Secret,
+		eventTypes(patchedWebhook.EventTypes),
+		patchedWebhook.Enabled,
+		patchedWebhook.ID,
+		patchedWebhook.ProjectId,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Webhook{}, storage.ErrEntryDoesntExist
+		}
+
+		return models.Webhook{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return resultWebhook, nil
+}
+
+func (s *Storage) DeleteWebhook(ctx context.Context, projectId string, webhookId string) error {
+	const op = "storage.postgres.DeleteWebhook"
+
+	q := `DELETE FROM webhooks WHERE id=$1 AND project_id=$2`
+
+	tag, err := s.conn(ctx).Exec(ctx, q, webhookId, projectId)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return storage.ErrEntryDoesntExist
+	}
+
+	return nil
+}
+
+func (s *Storage) ListWebhooks(ctx context.Context, projectId string) ([]models.Webhook, error) {
+	const op = "storage.postgres.ListWebhooks"
+
+	q := `SELECT ` + webhookColumns + ` FROM webhooks WHERE project_id=$1 ORDER BY id;`
+
+	webhooks, err := queryAll[models.Webhook](ctx, s.conn(ctx), q, projectId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return webhooks, nil
+}
+
+func (s *Storage) RecordWebhookResult(ctx context.Context, webhookId string, success bool, disableAfter int) (models.Webhook, error) {
+	const op = "storage.postgres.RecordWebhookResult"
+
+	q := `UPDATE webhooks SET
+            failures=CASE WHEN $1 THEN 0 ELSE failures + 1 END,
+            enabled=enabled AND ($1 OR failures + 1 < $2)
+            WHERE id=$3 RETURNING ` + webhookColumns + `;`
+
+	resultWebhook, err := queryOne[models.Webhook](ctx, s.conn(ctx), q, success, disableAfter, webhookId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Webhook{}, storage.ErrEntryDoesntExist
+		}
+
+		return models.Webhook{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return resultWebhook, nil
+}
+
+func (s *Storage) SaveWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) (models.WebhookDelivery, error) {
+	const op = "storage.postgres.SaveWebhookDelivery"
+
+	q := `INSERT INTO webhook_deliveries
+            (webhook_id, event_id, event_type, attempt, status_code, error, success, duration_ms, created_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING ` + deliveryColumns + `;`
+
+	resultDelivery, err := queryOne[models.WebhookDelivery](
+		ctx,
+		s.conn(ctx),
+		q,
+		delivery.WebhookId,
+		int64(delivery.EventId),
+		delivery.EventType,
+		delivery.Attempt,
+		delivery.StatusCode,
+		delivery.Error,
+		delivery.Success,
+		delivery.DurationMs,
+		time.Now(),
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.WebhookDelivery{}, storage.ErrGettingInsertedRows
+		}
+
+		return models.WebhookDelivery{}, fmt.Errorf("%s: saving entry: %w", op, err)
+	}
+
+	return resultDelivery, nil
+}
+
+// ListWebhookDeliveries returns the deliveries of the webhook, the latest first.
+func (s *Storage) ListWebhookDeliveries(ctx context.Context, webhookId string, offset, limit string) ([]models.WebhookDelivery, error) {
+	const op = "storage.postgres.ListWebhookDeliveries"
+
+	q := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+            WHERE webhook_id=$1 ORDER BY id DESC OFFSET $2 LIMIT $3;`
+
+	deliveries, err := queryAll[models.WebhookDelivery](ctx, s.conn(ctx), q, webhookId, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+// eventTypes stores no event types as an empty array rather than NULL.
+func eventTypes(types []string) []string {
+	if types == nil {
+		return []string{}
+	}
+
+	return types
+}
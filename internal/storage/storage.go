@@ -13,10 +13,103 @@ type Storage interface {
 	PatchGood(ctx context.Context, patchedGood models.Good) (models.Good, error)
 	DeleteGood(ctx context.Context, goodId string, projectId string) error
 	ListGoodsWithPagination(ctx context.Context, offset, limit string) ([]models.Good, error)
+	// SearchGoods finds the goods by the words of their name and description,
+	// the best matches first. The goods of every project are searched when
+	// projectId is empty
+	SearchGoods(ctx context.Context, projectId string, query string, offset, limit string) ([]models.GoodMatch, error)
+
+	GetProject(ctx context.Context, projectId string) (models.Project, error)
+	SaveProject(ctx context.Context, project models.Project) (models.Project, error)
+	PatchProject(ctx context.Context, patchedProject models.Project) (models.Project, error)
+	DeleteProject(ctx context.Context, projectId string) error
+	ListProjectsWithPagination(ctx context.Context, offset, limit string) ([]models.Project, error)
+}
+
+// WebhookStorage keeps the webhooks of the projects and the log of their deliveries.
+type WebhookStorage interface {
+	GetWebhook(ctx context.Context, projectId string, webhookId string) (models.Webhook, error)
+	SaveWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error)
+	PatchWebhook(ctx context.Context, patchedWebhook models.Webhook) (models.Webhook, error)
+	DeleteWebhook(ctx context.Context, projectId string, webhookId string) error
+	ListWebhooks(ctx context.Context, projectId string) ([]models.Webhook, error)
+
+	// RecordWebhookResult resets the failures of the webhook on success and
+	// counts a failure otherwise, disabling the webhook at disableAfter failures
+	RecordWebhookResult(ctx context.Context, webhookId string, success bool, disableAfter int) (models.Webhook, error)
+
+	SaveWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) (models.WebhookDelivery, error)
+	ListWebhookDeliveries(ctx context.Context, webhookId string, offset, limit string) ([]models.WebhookDelivery, error)
+}
+
+// Isolation is the isolation level of a transaction.
+type Isolation string
+
+const (
+	// IsolationDefault is the isolation level configured for the storage
+	IsolationDefault Isolation = ""
+	ReadCommitted    Isolation = "read committed"
+	RepeatableRead   Isolation = "repeatable read"
+	Serializable     Isolation = "serializable"
+)
+
+// Transactor runs several storage calls as a unit of work.
+type Transactor interface {
+	// WithTx runs fn in a transaction committed when fn returns nil. The
+	// storage calls made with the context passed to fn run in the transaction.
+	// fn may run more than once when the transaction conflicts with the others
+	WithTx(ctx context.Context, isolation Isolation, fn func(ctx context.Context) error) error
+}
+
+type primaryKey struct{}
+
+// WithPrimary marks the storage calls made with the context to read from
+// the primary database, so that they see the writes not replicated yet.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// PrimaryRequired reports whether the context was marked by WithPrimary.
+func PrimaryRequired(ctx context.Context) bool {
+	required, _ := ctx.Value(primaryKey{}).(bool)
+	return required
+}
+
+// PoolStats is the state of the connection pool of a storage.
+type PoolStats struct {
+	MaxConns          int32 `json:"max_conns"`
+	TotalConns        int32 `json:"total_conns"`
+	AcquiredConns     int32 `json:"acquired_conns"`
+	IdleConns         int32 `json:"idle_conns"`
+	ConstructingConns int32 `json:"constructing_conns"`
+	// AcquireCount and AcquireDurationMs are the number of the connections
+	// taken from the pool and the time spent waiting for them
+	AcquireCount      int64 `json:"acquire_count"`
+	AcquireDurationMs int64 `json:"acquire_duration_ms"`
+	// EmptyAcquireCount is the number of the acquires that waited for
+	// a connection because the pool had none idle
+	EmptyAcquireCount    int64 `json:"empty_acquire_count"`
+	CanceledAcquireCount int64 `json:"canceled_acquire_count"`
+	NewConnsCount        int64 `json:"new_conns_count"`
+	// MaxLifetimeDestroyCount and MaxIdleDestroyCount are the number of
+	// the connections closed for their age and for their idle time
+	MaxLifetimeDestroyCount int64 `json:"max_lifetime_destroy_count"`
+	MaxIdleDestroyCount     int64 `json:"max_idle_destroy_count"`
+	// Replicas are the pools of the read replicas, if any
+	Replicas []ReplicaStats `json:"replicas,omitempty"`
+}
+
+// ReplicaStats is the state of the connection pool of a read replica.
+type ReplicaStats struct {
+	// Healthy is false while the replica fails its health checks and
+	// the reads are sent to the other replicas or the primary
+	Healthy bool `json:"healthy"`
+	PoolStats
 }
 
 var (
 	ErrEntryAlreadyExists  = fmt.Errorf("entry already exists")
 	ErrEntryDoesntExist    = fmt.Errorf("entry doesn't exist")
 	ErrGettingInsertedRows = fmt.Errorf("failed getting inserted row")
+	// ErrEntryInUse is returned when deleting a project that still has goods
+	ErrEntryInUse = fmt.Errorf("entry is in use")
 )
@@ -0,0 +1,592 @@
+// Package storagetest checks that a storage behaves like the postgres one.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+// allRows is a limit larger than any list of the tests
+const allRows = "1000000"
+
+// Run runs the conformance tests against the storages made by open. Every
+// test makes its own projects, so the storage may hold other data and may
+// be shared by the tests, but they shouldn't run with other writers.
+func Run(t *testing.T, open func(t *testing.T) storage.Storage) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, db storage.Storage)
+	}{
+		{"GetMissingGood", testGetMissingGood},
+		{"SaveGood", testSaveGood},
+		{"SaveGoodToMissingProject", testSaveGoodToMissingProject},
+		{"SaveDuplicateGood", testSaveDuplicateGood},
+		{"SaveGoodWithId", testSaveGoodWithId},
+		{"ConcurrentSaveGoodWithId", testConcurrentSaveGoodWithId},
+		{"Priorities", testPriorities},
+		{"ConcurrentPriorities", testConcurrentPriorities},
+		{"PatchGood", testPatchGood},
+		{"PatchMissingGood", testPatchMissingGood},
+		{"PatchTakenPriority", testPatchTakenPriority},
+		{"DeleteGood", testDeleteGood},
+		{"ListGoods", testListGoods},
+		{"SearchGoods", testSearchGoods},
+		{"Projects", testProjects},
+		{"ListProjects", testListProjects},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, open(t))
+		})
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func id(n int) string {
+	return strconv.Itoa(n)
+}
+
+func newProject(t *testing.T, db storage.Storage) models.Project {
+	t.Helper()
+
+	project, err := db.SaveProject(context.Background(), models.Project{Name: t.Name()})
+	if err != nil {
+		t.Fatalf("save project: %v", err)
+	}
+
+	return project
+}
+
+func newGood(t *testing.T, db storage.Storage, good models.Good) models.Good {
+	t.Helper()
+
+	saved, err := db.SaveGood(context.Background(), good)
+	if err != nil {
+		t.Fatalf("save good %+v: %v", good, err)
+	}
+
+	return saved
+}
+
+// missingProjectId is the id of a deleted project.
+func missingProjectId(t *testing.T, db storage.Storage) int {
+	t.Helper()
+
+	project := newProject(t, db)
+	if err := db.DeleteProject(context.Background(), id(project.ID)); err != nil {
+		t.Fatalf("delete project: %v", err)
+	}
+
+	return project.ID
+}
+
+func wantErr(t *testing.T, what string, got, want error) {
+	t.Helper()
+
+	if !errors.Is(got, want) {
+		t.Errorf("%s: got error %v, want %v", what, got, want)
+	}
+}
+
+func testGetMissingGood(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	project := newProject(t, db)
+	good := newGood(t, db, models.Good{ProjectId: project.ID, Name: "good"})
+
+	_, err := db.GetGood(ctx, id(good.ID+1000000), id(project.ID))
+	wantErr(t, "missing good", err, storage.ErrEntryDoesntExist)
+
+	// a good is only found within its project
+	other := newProject(t, db)
+	_, err = db.GetGood(ctx, id(good.ID), id(other.ID))
+	wantErr(t, "good of another project", err, storage.ErrEntryDoesntExist)
+}
+
+func testSaveGood(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	project := newProject(t, db)
+
+	saved := newGood(t, db, models.Good{ProjectId: project.ID, Name: "name", Description: "description"})
+	if saved.ID == 0 || saved.CreatedAt.IsZero() || saved.Priority == nil {
+		t.Fatalf("saved good %+v has no id, creation time or priority", saved)
+	}
+
+	got, err := db.GetGood(ctx, id(saved.ID), id(project.ID))
+	if err != nil {
+		t.Fatalf("get good: %v", err)
+	}
+
+	if got.ProjectId != project.ID || got.Name != "name" || got.Description != "description" || got.Removed {
+		t.Errorf("got good %+v, want the saved one", got)
+	}
+	if *got.Priority != *saved.Priority || !got.CreatedAt.Equal(saved.CreatedAt) {
+		t.Errorf("got priority %d created at %v, want %d at %v", *got.Priority, got.CreatedAt, *saved.Priority, saved.CreatedAt)
+	}
+}
+
+func testSaveGoodToMissingProject(t *testing.T, db storage.Storage) {
+	_, err := db.SaveGood(context.Background(), models.Good{ProjectId: missingProjectId(t, db), Name: "orphan"})
+	wantErr(t, "missing project", err, storage.ErrEntryDoesntExist)
+}
+
+func testSaveDuplicateGood(t *testing.T, db storage.Storage) {
+	project := newProject(t, db)
+	good := newGood(t, db, models.Good{ProjectId: project.ID, Name: "original"})
+
+	_, err := db.SaveGood(context.Background(), models.Good{ID: good.ID, ProjectId: project.ID, Name: "duplicate"})
+	wantErr(t, "taken id", err, storage.ErrEntryAlreadyExists)
+}
+
+func testSaveGoodWithId(t *testing.T, db storage.Storage) {
+	project := newProject(t, db)
+	first := newGood(t, db, models.Good{ProjectId: project.ID, Name: "first"})
+
+	chosen := newGood(t, db, models.Good{ID: first.ID + 1000, ProjectId: project.ID, Name: "chosen"})
+	if chosen.ID != first.ID+1000 {
+		t.Fatalf("got id %d, want the chosen %d", chosen.ID, first.ID+1000)
+	}
+
+	// the generated ids don't run into the chosen one
+	next := newGood(t, db, models.Good{ProjectId: project.ID, Name: "next"})
+	if next.ID <= chosen.ID {
+		t.Errorf("generated id %d after the chosen %d", next.ID, chosen.ID)
+	}
+}
+
+func testConcurrentSaveGoodWithId(t *testing.T, db storage.Storage) {
+	const n = 10
+
+	project := newProject(t, db)
+	first := newGood(t, db, models.Good{ProjectId: project.ID, Name: "first"})
+
+	var wg sync.WaitGroup
+	ids := make([]int, 2*n)
+	errs := make([]error, 2*n)
+
+	// the chosen ids are the next ones of the sequence, drawn concurrently
+	// by the goods without an id
+	for i := 0; i < 2*n; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			good := models.Good{ProjectId: project.ID, Name: "concurrent"}
+			if i%2 == 0 {
+				good.ID = first.ID + 1 + i
+			}
+
+			saved, err := db.SaveGood(context.Background(), good)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			ids[i] = saved.ID
+		}(i)
+	}
+
+	wg.Wait()
+
+	seen := map[int]bool{}
+	for i, err := range errs {
+		switch {
+		// a chosen id may have been generated for another good before
+		case i%2 == 0 && errors.Is(err, storage.ErrEntryAlreadyExists):
+		case err != nil:
+			t.Errorf("save good %d: %v", i, err)
+		case seen[ids[i]]:
+			t.Errorf("got id %d twice", ids[i])
+		default:
+			seen[ids[i]] = true
+		}
+	}
+}
+
+func testPriorities(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	project := newProject(t, db)
+
+	for want := 1; want <= 3; want++ {
+		good := newGood(t, db, models.Good{ProjectId: project.ID, Name: "good"})
+		if *good.Priority != want {
+			t.Errorf("got priority %d, want %d", *good.Priority, want)
+		}
+	}
+
+	_, err := db.SaveGood(ctx, models.Good{ProjectId: project.ID, Name: "taken", Priority: intPtr(2)})
+	wantErr(t, "taken priority", err, storage.ErrEntryAlreadyExists)
+
+	newGood(t, db, models.Good{ProjectId: project.ID, Name: "explicit", Priority: intPtr(10)})
+
+	next := newGood(t, db, models.Good{ProjectId: project.ID, Name: "next"})
+	if *next.Priority != 11 {
+		t.Errorf("got priority %d after an explicit 10, want 11", *next.Priority)
+	}
+
+	// the priorities are counted in every project apart
+	other := newProject(t, db)
+	good := newGood(t, db, models.Good{ProjectId: other.ID, Name: "other", Priority: intPtr(2)})
+	if *good.Priority != 2 {
+		t.Errorf("got priority %d in another project, want 2", *good.Priority)
+	}
+}
+
+func testConcurrentPriorities(t *testing.T, db storage.Storage) {
+	const n = 20
+
+	project := newProject(t, db)
+
+	var wg sync.WaitGroup
+	priorities := make([]int, n)
+	errs := make([]error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			good, err := db.SaveGood(context.Background(), models.Good{ProjectId: project.ID, Name: "concurrent"})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			priorities[i] = *good.Priority
+		}(i)
+	}
+
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		t.Fatalf("concurrent saves: %v", err)
+	}
+
+	sort.Ints(priorities)
+	for i, priority := range priorities {
+		if priority != i+1 {
+			t.Fatalf("got priorities %v, want 1 to %d", priorities, n)
+		}
+	}
+}
+
+func testPatchGood(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	project := newProject(t, db)
+	good := newGood(t, db, models.Good{ProjectId: project.ID, Name: "name", Description: "description"})
+
+	patched, err := db.PatchGood(ctx, models.Good{ID: good.ID, ProjectId: project.ID, Name: "renamed", Removed: true})
+	if err != nil {
+		t.Fatalf("patch good: %v", err)
+	}
+
+	if patched.Name != "renamed" || patched.Description != "" || !patched.Removed {
+		t.Errorf("got patched good %+v, want renamed, removed and without description", patched)
+	}
+	if *patched.Priority != *good.Priority || !patched.CreatedAt.Equal(good.CreatedAt) {
+		t.Errorf("got patched good %+v, want the priority and the creation time kept", patched)
+	}
+
+	patched, err = db.PatchGood(ctx, models.Good{ID: good.ID, ProjectId: project.ID, Name: "renamed", Priority: intPtr(5)})
+	if err != nil {
+		t.Fatalf("patch priority: %v", err)
+	}
+	if *patched.Priority != 5 {
+		t.Errorf("got priority %d, want 5", *patched.Priority)
+	}
+
+	// the next priority is past the patched one
+	next := newGood(t, db, models.Good{ProjectId: project.ID, Name: "next"})
+	if *next.Priority != 6 {
+		t.Errorf("got priority %d after a patched 5, want 6", *next.Priority)
+	}
+
+	got, err := db.GetGood(ctx, id(good.ID), id(project.ID))
+	if err != nil {
+		t.Fatalf("get good: %v", err)
+	}
+	if got.Name != "renamed" || *got.Priority != 5 {
+		t.Errorf("got good %+v, want the patched one", got)
+	}
+}
+
+func testPatchMissingGood(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	project := newProject(t, db)
+	good := newGood(t, db, models.Good{ProjectId: project.ID, Name: "good"})
+
+	_, err := db.PatchGood(ctx, models.Good{ID: good.ID + 1000000, ProjectId: project.ID, Name: "missing"})
+	wantErr(t, "missing good", err, storage.ErrEntryDoesntExist)
+
+	other := newProject(t, db)
+	_, err = db.PatchGood(ctx, models.Good{ID: good.ID, ProjectId: other.ID, Name: "other"})
+	wantErr(t, "good of another project", err, storage.ErrEntryDoesntExist)
+}
+
+func testPatchTakenPriority(t *testing.T, db storage.Storage) {
+	project := newProject(t, db)
+	first := newGood(t, db, models.Good{ProjectId: project.ID, Name: "first"})
+	second := newGood(t, db, models.Good{ProjectId: project.ID, Name: "second"})
+
+	_, err := db.PatchGood(context.Background(), models.Good{
+		ID: second.ID, ProjectId: project.ID, Name: "second", Priority: first.Priority,
+	})
+	wantErr(t, "taken priority", err, storage.ErrEntryAlreadyExists)
+}
+
+func testDeleteGood(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	project := newProject(t, db)
+	good := newGood(t, db, models.Good{ProjectId: project.ID, Name: "good"})
+
+	other := newProject(t, db)
+	wantErr(t, "good of another project", db.DeleteGood(ctx, id(good.ID), id(other.ID)), storage.ErrEntryDoesntExist)
+
+	if err := db.DeleteGood(ctx, id(good.ID), id(project.ID)); err != nil {
+		t.Fatalf("delete good: %v", err)
+	}
+
+	_, err := db.GetGood(ctx, id(good.ID), id(project.ID))
+	wantErr(t, "deleted good", err, storage.ErrEntryDoesntExist)
+
+	wantErr(t, "deleting again", db.DeleteGood(ctx, id(good.ID), id(project.ID)), storage.ErrEntryDoesntExist)
+}
+
+func testListGoods(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	project := newProject(t, db)
+
+	var created []int
+	for i := 0; i < 3; i++ {
+		created = append(created, newGood(t, db, models.Good{ProjectId: project.ID, Name: "listed"}).ID)
+	}
+
+	all, err := db.ListGoodsWithPagination(ctx, "0", allRows)
+	if err != nil {
+		t.Fatalf("list goods: %v", err)
+	}
+
+	checkPages(t, all, created, func(good models.Good) int { return good.ID }, db.ListGoodsWithPagination)
+}
+
+func testListProjects(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	var created []int
+	for i := 0; i < 3; i++ {
+		created = append(created, newProject(t, db).ID)
+	}
+
+	all, err := db.ListProjectsWithPagination(ctx, "0", allRows)
+	if err != nil {
+		t.Fatalf("list projects: %v", err)
+	}
+
+	checkPages(t, all, created, func(project models.Project) int { return project.ID }, db.ListProjectsWithPagination)
+}
+
+// checkPages checks that the whole list is ordered by id and holds the created
+// entries, and that its pages are cut at their offset and limit.
+func checkPages[T any](
+	t *testing.T,
+	all []T,
+	created []int,
+	idOf func(T) int,
+	list func(ctx context.Context, offset, limit string) ([]T, error),
+) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	ids := make([]int, len(all))
+	for i, entry := range all {
+		ids[i] = idOf(entry)
+	}
+
+	if !sort.IntsAreSorted(ids) {
+		t.Errorf("got ids %v, want them ascending", ids)
+	}
+
+	for _, want := range created {
+		if i := sort.SearchInts(ids, want); i == len(ids) || ids[i] != want {
+			t.Errorf("created entry %d isn't listed", want)
+		}
+	}
+
+	pages := []struct {
+		offset, limit int
+	}{
+		{0, 1},
+		{1, 2},
+		{len(all) - 1, 10},
+		{len(all), 10},
+		{len(all) + 10, 10},
+		{0, 0},
+	}
+
+	for _, p := range pages {
+		page, err := list(ctx, id(p.offset), id(p.limit))
+		if err != nil {
+			t.Errorf("list offset %d limit %d: %v", p.offset, p.limit, err)
+			continue
+		}
+
+		from := min(p.offset, len(all))
+		to := min(p.offset+p.limit, len(all))
+
+		if len(page) != to-from {
+			t.Errorf("list offset %d limit %d: got %d entries, want %d", p.offset, p.limit, len(page), to-from)
+			continue
+		}
+
+		for i, entry := range page {
+			if idOf(entry) != ids[from+i] {
+				t.Errorf("list offset %d limit %d: got id %d at %d, want %d", p.offset, p.limit, idOf(entry), i, ids[from+i])
+			}
+		}
+	}
+}
+
+func testSearchGoods(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	project := newProject(t, db)
+
+	inName := newGood(t, db, models.Good{ProjectId: project.ID, Name: "Xylophone"})
+	inDescription := newGood(t, db, models.Good{ProjectId: project.ID, Name: "Drum", Description: "sounds like a xylophone"})
+	newGood(t, db, models.Good{ProjectId: project.ID, Name: "Trumpet"})
+
+	matches, err := db.SearchGoods(ctx, id(project.ID), "xyloph", "0", "10")
+	if err != nil {
+		t.Fatalf("search goods: %v", err)
+	}
+
+	if len(matches) != 2 {
+		t.Fatalf("got %d matches, want 2: %+v", len(matches), matches)
+	}
+	if matches[0].ID != inName.ID || matches[1].ID != inDescription.ID {
+		t.Errorf("got goods %d and %d, want the name match %d first", matches[0].ID, matches[1].ID, inName.ID)
+	}
+	if matches[0].Rank <= matches[1].Rank {
+		t.Errorf("got ranks %v and %v, want the name match ranked higher", matches[0].Rank, matches[1].Rank)
+	}
+
+	matches, err = db.SearchGoods(ctx, id(project.ID), "xyloph drum", "0", "10")
+	if err != nil {
+		t.Fatalf("search goods: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != inDescription.ID {
+		t.Errorf("got %+v, want the good matching every word", matches)
+	}
+
+	matches, err = db.SearchGoods(ctx, id(project.ID), "xyloph", "1", "10")
+	if err != nil {
+		t.Fatalf("search goods: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != inDescription.ID {
+		t.Errorf("got %+v at offset 1, want the second match", matches)
+	}
+
+	other := newProject(t, db)
+	matches, err = db.SearchGoods(ctx, id(other.ID), "xyloph", "0", "10")
+	if err != nil {
+		t.Fatalf("search goods: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("got %+v in another project, want none", matches)
+	}
+
+	// without a project every project is searched
+	inOther := newGood(t, db, models.Good{ProjectId: other.ID, Name: "Xylophone"})
+
+	matches, err = db.SearchGoods(ctx, "", "xyloph", "0", allRows)
+	if err != nil {
+		t.Fatalf("search every project: %v", err)
+	}
+	found := map[int]bool{}
+	for _, match := range matches {
+		found[match.ID] = true
+	}
+	if !found[inName.ID] || !found[inDescription.ID] || !found[inOther.ID] {
+		t.Errorf("got %+v in every project, want the goods of both projects", matches)
+	}
+
+	matches, err = db.SearchGoods(ctx, id(project.ID), "!&|", "0", "10")
+	if err != nil {
+		t.Fatalf("search without words: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("got %+v without words, want none", matches)
+	}
+
+	// the highlights are html, the names and descriptions are escaped in them
+	newGood(t, db, models.Good{ProjectId: other.ID, Name: "<script>marimba</script>", Description: `a "marimba" & co`})
+
+	matches, err = db.SearchGoods(ctx, id(other.ID), "marimba", "0", "10")
+	if err != nil {
+		t.Fatalf("search goods: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("got %+v, want the marimba", matches)
+	}
+	if h := matches[0].NameHighlight; strings.Contains(h, "<script") || !strings.Contains(h, "&lt;script&gt;") || !strings.Contains(h, "<b>marimba</b>") {
+		t.Errorf("got name highlight %q, want the name escaped and the match highlighted", h)
+	}
+	if h := matches[0].DescriptionHighlight; strings.Contains(h, `"`) || !strings.Contains(h, "&#34;<b>marimba</b>&#34;") {
+		t.Errorf("got description highlight %q, want the description escaped", h)
+	}
+}
+
+func testProjects(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	project := newProject(t, db)
+
+	if project.ID == 0 || project.CreatedAt.IsZero() {
+		t.Fatalf("saved project %+v has no id or creation time", project)
+	}
+
+	patched, err := db.PatchProject(ctx, models.Project{ID: project.ID, Name: "renamed"})
+	if err != nil {
+		t.Fatalf("patch project: %v", err)
+	}
+	if patched.Name != "renamed" || !patched.CreatedAt.Equal(project.CreatedAt) {
+		t.Errorf("got patched project %+v, want renamed", patched)
+	}
+
+	got, err := db.GetProject(ctx, id(project.ID))
+	if err != nil {
+		t.Fatalf("get project: %v", err)
+	}
+	if got.Name != "renamed" {
+		t.Errorf("got project %+v, want the patched one", got)
+	}
+
+	// a project with goods can't be deleted
+	good := newGood(t, db, models.Good{ProjectId: project.ID, Name: "good"})
+	wantErr(t, "deleting a project with goods", db.DeleteProject(ctx, id(project.ID)), storage.ErrEntryInUse)
+
+	if err := db.DeleteGood(ctx, id(good.ID), id(project.ID)); err != nil {
+		t.Fatalf("delete good: %v", err)
+	}
+	if err := db.DeleteProject(ctx, id(project.ID)); err != nil {
+		t.Fatalf("delete project: %v", err)
+	}
+
+	_, err = db.GetProject(ctx, id(project.ID))
+	wantErr(t, "deleted project", err, storage.ErrEntryDoesntExist)
+
+	_, err = db.PatchProject(ctx, models.Project{ID: project.ID, Name: "missing"})
+	wantErr(t, "patching a deleted project", err, storage.ErrEntryDoesntExist)
+
+	wantErr(t, "deleting again", db.DeleteProject(ctx, id(project.ID)), storage.ErrEntryDoesntExist)
+}
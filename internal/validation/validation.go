@@ -0,0 +1,84 @@
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/kldd0/goods-service/internal/domain/models"
+)
+
+// validate caches the parsed struct tags, it is safe for concurrent use
+var validate = newValidate()
+
+func newValidate() *validator.Validate {
+	v := validator.New()
+
+	// the webhooks are only posted over http
+	_ = v.RegisterValidation("http_url", func(fl validator.FieldLevel) bool {
+		u, err := url.Parse(fl.Field().String())
+		return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+	})
+
+	return v
+}
+
+// patchedGood holds the rules for updates, which replace every
+// user editable field of the good and therefore require more of them
+type patchedGood struct {
+	ID          int    `validate:"required"`
+	ProjectId   int    `validate:"required"`
+	Name        string `validate:"required"`
+	Description string `validate:"required"`
+	Priority    *int
+	Removed     bool
+	CreatedAt   time.Time
+}
+
+// Good validates a good to be created.
+// The returned error is validator.ValidationErrors.
+func Good(good models.Good) error {
+	return validate.Struct(good)
+}
+
+// PatchedGood validates a good to be updated.
+// The returned error is validator.ValidationErrors.
+func PatchedGood(good models.Good) error {
+	return validate.Struct(patchedGood(good))
+}
+
+// Project validates a project to be created or updated.
+// The returned error is validator.ValidationErrors.
+func Project(project models.Project) error {
+	return validate.Struct(project)
+}
+
+// Webhook validates a webhook to be created or updated.
+// The returned error is validator.ValidationErrors.
+func Webhook(webhook models.Webhook) error {
+	return validate.Struct(webhook)
+}
+
+// Message describes the validation errors in a human readable form.
+func Message(errs validator.ValidationErrors) string {
+	var errMsgs []string
+
+	for _, err := range errs {
+		switch err.ActualTag() {
+		case "required":
+			errMsgs = append(errMsgs, fmt.Sprintf("field %s is a required field", err.Field()))
+		case "url":
+			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not a valid URL", err.Field()))
+		case "http_url":
+			errMsgs = append(errMsgs, fmt.Sprintf("field %s must be an http or https URL", err.Field()))
+		case "oneof":
+			errMsgs = append(errMsgs, fmt.Sprintf("field %s must be one of: %s", err.Field(), err.Param()))
+		default:
+			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not valid", err.Field()))
+		}
+	}
+
+	return strings.Join(errMsgs, ", ")
+}
@@ -0,0 +1,312 @@
+// Package webhooks delivers the changes made to the goods of a project to the
+// webhooks registered by its owners. Every attempt is kept in the delivery
+// log, failed attempts are retried with an exponential backoff and a webhook
+// failing too many events in a row is disabled.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"log/slog"
+
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/config"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/events"
+	"github.com/kldd0/goods-service/internal/logger"
+	"github.com/kldd0/goods-service/internal/storage"
+)
+
+// EventTest is the type of the events sent on request to check a webhook.
+const EventTest changefeed.EventType = "test"
+
+// job is an attempt to deliver an event to a webhook.
+type job struct {
+	webhook models.Webhook
+	ev      changefeed.Event
+	attempt int
+}
+
+// Dispatcher is the event sink posting the events to the webhooks
+// of their project. The deliveries wait in a bounded queue and are
+// posted by a pool of workers, the pending retries are lost on restart.
+type Dispatcher struct {
+	log    *slog.Logger
+	db     storage.WebhookStorage
+	client *http.Client
+	cfg    config.Webhooks
+
+	jobs chan job
+	// ctx is the context of the workers, set by Start
+	ctx context.Context
+	wg  sync.WaitGroup
+}
+
+// New creates a dispatcher posting the deliveries with cfg.Workers, the
+// delay between the attempts doubles from cfg.Backoff up to cfg.MaxBackoff.
+// A webhook failing cfg.DisableAfter events in a row is disabled.
+func New(log *slog.Logger, db storage.WebhookStorage, cfg config.Webhooks) *Dispatcher {
+	return &Dispatcher{
+		log:    log,
+		db:     db,
+		client: newClient(cfg.Timeout, cfg.AllowPrivateAddresses),
+		cfg:    cfg,
+		jobs:   make(chan job, cfg.QueueSize),
+		ctx:    context.Background(),
+	}
+}
+
+// Start runs the workers until the context is done.
+func (d *Dispatcher) Start(ctx context.Context) {
+	d.ctx = ctx
+
+	for i := 0; i < max(d.cfg.Workers, 1); i++ {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-d.jobs:
+					d.deliver(j)
+				}
+			}
+		}()
+	}
+}
+
+// Send queues the delivery of the event to the enabled webhooks of its
+// project subscribed to its type. It blocks while the queue is full.
+func (d *Dispatcher) Send(ctx context.Context, ev changefeed.Event) error {
+	const op = "webhooks.Dispatcher.Send"
+
+	webhooks, err := d.db.ListWebhooks(ctx, strconv.Itoa(ev.ProjectId))
+	if err != nil {
+		return fmt.Errorf("%s: listing webhooks: %w", op, err)
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Enabled || !Subscribed(webhook, ev.Type) {
+			continue
+		}
+
+		if err := d.enqueue(ctx, job{webhook: webhook, ev: ev, attempt: 1}); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// Close waits for the workers stopped with the context of Start.
+func (d *Dispatcher) Close() error {
+	d.wg.Wait()
+	d.client.CloseIdleConnections()
+
+	return nil
+}
+
+// Test posts a test event to the webhook once, whatever its state.
+// The delivery is logged but doesn't count as a failure of the webhook.
+func (d *Dispatcher) Test(ctx context.Context, webhook models.Webhook) (models.WebhookDelivery, error) {
+	const op = "webhooks.Dispatcher.Test"
+
+	delivery, _ := d.post(ctx, webhook, changefeed.Event{
+		Type:      EventTest,
+		ProjectId: webhook.ProjectId,
+		Time:      time.Now(),
+	}, 1)
+
+	delivery, err := d.db.SaveWebhookDelivery(ctx, delivery)
+	if err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("%s: saving delivery: %w", op, err)
+	}
+
+	return delivery, nil
+}
+
+// Subscribed reports whether the webhook receives the events of the type.
+func Subscribed(webhook models.Webhook, eventType changefeed.EventType) bool {
+	return len(webhook.EventTypes) == 0 || slices.Contains(webhook.EventTypes, string(eventType))
+}
+
+// GenerateSecret returns a random secret for a webhook created without one.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, j job) error {
+	select {
+	case d.jobs <- j:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-d.ctx.Done():
+		return d.ctx.Err()
+	}
+}
+
+func (d *Dispatcher) deliver(j job) {
+	const op = "webhooks.Dispatcher.deliver"
+
+	log := d.log.With(
+		slog.String("op", op),
+		slog.Int("webhook_id", j.webhook.ID),
+		slog.Uint64("event_id", j.ev.ID),
+		slog.Int("attempt", j.attempt),
+	)
+
+	webhookId := strconv.Itoa(j.webhook.ID)
+
+	// the webhook may have been changed while the retry was waiting
+	if j.attempt > 1 {
+		webhook, err := d.db.GetWebhook(d.ctx, strconv.Itoa(j.webhook.ProjectId), webhookId)
+		switch {
+		case errors.Is(err, storage.ErrEntryDoesntExist):
+			return
+		case err != nil:
+			log.Error("failed to get webhook", logger.Err(err))
+		default:
+			j.webhook = webhook
+		}
+
+		if !j.webhook.Enabled {
+			return
+		}
+	}
+
+	delivery, retryable := d.post(d.ctx, j.webhook, j.ev, j.attempt)
+
+	if _, err := d.db.SaveWebhookDelivery(d.ctx, delivery); err != nil {
+		log.Error("failed to save delivery", logger.Err(err))
+	}
+
+	if delivery.Success {
+		if j.webhook.Failures > 0 {
+			d.record(log, webhookId, true)
+		}
+		return
+	}
+
+	if retryable && j.attempt < d.cfg.MaxAttempts {
+		d.retry(log, j)
+		return
+	}
+
+	log.Warn("event not delivered", slog.String("error", delivery.Error))
+
+	d.record(log, webhookId, false)
+}
+
+// retry queues the next attempt after the backoff of the failed one.
+func (d *Dispatcher) retry(log *slog.Logger, j job) {
+	delay := d.cfg.Backoff << (j.attempt - 1)
+	if delay <= 0 || delay > d.cfg.MaxBackoff {
+		delay = d.cfg.MaxBackoff
+	}
+
+	j.attempt++
+
+	// full jitter spreads the retries of the webhooks failed at once
+	time.AfterFunc(time.Duration(mathrand.Int63n(int64(delay))+1), func() {
+		if err := d.enqueue(d.ctx, j); err != nil {
+			log.Info("retry dropped", logger.Err(err))
+		}
+	})
+}
+
+func (d *Dispatcher) record(log *slog.Logger, webhookId string, success bool) {
+	webhook, err := d.db.RecordWebhookResult(d.ctx, webhookId, success, d.cfg.DisableAfter)
+	if err != nil {
+		if !errors.Is(err, storage.ErrEntryDoesntExist) {
+			log.Error("failed to record delivery result", logger.Err(err))
+		}
+		return
+	}
+
+	if !success && !webhook.Enabled {
+		log.Warn("webhook disabled", slog.Int("failures", webhook.Failures))
+	}
+}
+
+// post makes a delivery attempt and reports whether a failed one may succeed
+// on retry: the request failed, but not for the address of the webhook,
+// or the webhook responded with 429 or 5xx.
+func (d *Dispatcher) post(ctx context.Context, webhook models.Webhook, ev changefeed.Event, attempt int) (delivery models.WebhookDelivery, retryable bool) {
+	delivery = models.WebhookDelivery{
+		WebhookId: webhook.ID,
+		EventId:   ev.ID,
+		EventType: string(ev.Type),
+		Attempt:   attempt,
+	}
+
+	start := time.Now()
+	defer func() {
+		delivery.DurationMs = int(time.Since(start).Milliseconds())
+	}()
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		delivery.Error = fmt.Sprintf("marshalling event: %v", err)
+		return delivery, false
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = fmt.Sprintf("creating request: %v", err)
+		return delivery, false
+	}
+
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		delivery.Error = fmt.Sprintf("unsupported url scheme %q", req.URL.Scheme)
+		return delivery, false
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(events.TimestampHeader, timestamp)
+	req.Header.Set(events.SignatureHeader, events.Sign([]byte(webhook.Secret), timestamp, body))
+	req.Header.Set(events.EventIDHeader, strconv.FormatUint(ev.ID, 10))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery, !errors.Is(err, ErrForbiddenAddress)
+	}
+	defer resp.Body.Close()
+
+	// drained so that the connection is reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	delivery.StatusCode = &resp.StatusCode
+
+	if resp.StatusCode < 300 {
+		delivery.Success = true
+		return delivery, false
+	}
+
+	delivery.Error = fmt.Sprintf("webhook responded with %d", resp.StatusCode)
+
+	return delivery, resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
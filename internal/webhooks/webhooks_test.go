@@ -0,0 +1,342 @@
+package webhooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kldd0/goods-service/internal/changefeed"
+	"github.com/kldd0/goods-service/internal/config"
+	"github.com/kldd0/goods-service/internal/domain/models"
+	"github.com/kldd0/goods-service/internal/events"
+	"github.com/kldd0/goods-service/internal/storage"
+	"github.com/kldd0/goods-service/internal/webhooks"
+)
+
+const secret = "secret"
+
+// fakeStorage keeps the webhooks and the deliveries in memory.
+type fakeStorage struct {
+	storage.WebhookStorage
+
+	mu         sync.Mutex
+	webhooks   map[int]models.Webhook
+	deliveries []models.WebhookDelivery
+}
+
+func (s *fakeStorage) GetWebhook(_ context.Context, _ string, webhookId string) (models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, _ := strconv.Atoi(webhookId)
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return models.Webhook{}, storage.ErrEntryDoesntExist
+	}
+
+	return webhook, nil
+}
+
+func (s *fakeStorage) ListWebhooks(_ context.Context, _ string) ([]models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var webhooks []models.Webhook
+	for _, webhook := range s.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, nil
+}
+
+func (s *fakeStorage) RecordWebhookResult(_ context.Context, webhookId string, success bool, disableAfter int) (models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, _ := strconv.Atoi(webhookId)
+	webhook := s.webhooks[id]
+
+	if success {
+		webhook.Failures = 0
+	} else {
+		webhook.Failures++
+		webhook.Enabled = webhook.Enabled && webhook.Failures < disableAfter
+	}
+
+	s.webhooks[id] = webhook
+
+	return webhook, nil
+}
+
+func (s *fakeStorage) SaveWebhookDelivery(_ context.Context, delivery models.WebhookDelivery) (models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery.ID = len(s.deliveries) + 1
+	s.deliveries = append(s.deliveries, delivery)
+
+	return delivery, nil
+}
+
+func (s *fakeStorage) webhook(id int) models.Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.webhooks[id]
+}
+
+func (s *fakeStorage) getDeliveries() []models.WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.WebhookDelivery(nil), s.deliveries...)
+}
+
+// endpoint responds with the statuses in turn, repeating the last one.
+func endpoint(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+
+		body, _ := io.ReadAll(r.Body)
+
+		timestamp := r.Header.Get(events.TimestampHeader)
+		if r.Header.Get(events.SignatureHeader) != events.Sign([]byte(secret), timestamp, body) {
+			t.Error("bad signature")
+		}
+
+		var ev changefeed.Event
+		if err := json.Unmarshal(body, &ev); err != nil {
+			t.Errorf("bad body %s", body)
+		}
+
+		w.WriteHeader(statuses[min(n, len(statuses))-1])
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+func start(t *testing.T, db *fakeStorage) *webhooks.Dispatcher {
+	t.Helper()
+
+	d := webhooks.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, config.Webhooks{
+		Workers:      2,
+		QueueSize:    16,
+		Timeout:      time.Second,
+		MaxAttempts:  3,
+		Backoff:      time.Millisecond,
+		MaxBackoff:   5 * time.Millisecond,
+		DisableAfter: 2,
+		// the endpoints listen on the loopback
+		AllowPrivateAddresses: true,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.Start(ctx)
+
+	t.Cleanup(func() {
+		cancel()
+		_ = d.Close()
+	})
+
+	return d
+}
+
+// waitFor polls the condition until it holds or the time is out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func event(id uint64, eventType changefeed.EventType) changefeed.Event {
+	return changefeed.Event{ID: id, Type: eventType, ProjectId: 1, GoodId: 1, Time: time.Now()}
+}
+
+func TestDeliveredToSubscribedWebhooks(t *testing.T) {
+	srv, requests := endpoint(t, http.StatusOK)
+
+	db := &fakeStorage{webhooks: map[int]models.Webhook{
+		1: {ID: 1, ProjectId: 1, URL: srv.URL, Secret: secret, Enabled: true},
+		2: {ID: 2, ProjectId: 1, URL: srv.URL, Secret: secret, Enabled: true, EventTypes: []string{"delete"}},
+		3: {ID: 3, ProjectId: 1, URL: srv.URL, Secret: secret, Enabled: false},
+	}}
+
+	d := start(t, db)
+
+	if err := d.Send(context.Background(), event(1, changefeed.EventCreate)); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the delivery", func() bool { return len(db.getDeliveries()) == 1 })
+
+	delivery := db.getDeliveries()[0]
+	if delivery.WebhookId != 1 || !delivery.Success || delivery.StatusCode == nil || *delivery.StatusCode != http.StatusOK {
+		t.Errorf("got delivery %+v", delivery)
+	}
+
+	if requests.Load() != 1 {
+		t.Errorf("got %d requests, want 1", requests.Load())
+	}
+}
+
+func TestRetriedUntilDelivered(t *testing.T) {
+	srv, _ := endpoint(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNoContent)
+
+	db := &fakeStorage{webhooks: map[int]models.Webhook{
+		1: {ID: 1, ProjectId: 1, URL: srv.URL, Secret: secret, Enabled: true, Failures: 1},
+	}}
+
+	d := start(t, db)
+
+	if err := d.Send(context.Background(), event(1, changefeed.EventUpdate)); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the failures reset", func() bool { return db.webhook(1).Failures == 0 })
+
+	deliveries := db.getDeliveries()
+	if len(deliveries) != 3 {
+		t.Fatalf("got %d deliveries, want 3", len(deliveries))
+	}
+
+	for i, delivery := range deliveries {
+		if delivery.Attempt != i+1 || delivery.Success != (i == 2) {
+			t.Errorf("got delivery %+v", delivery)
+		}
+	}
+}
+
+func TestDisabledAfterFailures(t *testing.T) {
+	srv, requests := endpoint(t, http.StatusInternalServerError)
+
+	db := &fakeStorage{webhooks: map[int]models.Webhook{
+		1: {ID: 1, ProjectId: 1, URL: srv.URL, Secret: secret, Enabled: true},
+	}}
+
+	d := start(t, db)
+
+	for id := uint64(1); id <= 2; id++ {
+		if err := d.Send(context.Background(), event(id, changefeed.EventDelete)); err != nil {
+			t.Fatal(err)
+		}
+
+		waitFor(t, "the failure", func() bool { return db.webhook(1).Failures == int(id) })
+	}
+
+	if db.webhook(1).Enabled {
+		t.Fatal("webhook isn't disabled")
+	}
+
+	// every event was attempted MaxAttempts times
+	if requests.Load() != 6 {
+		t.Errorf("got %d requests, want 6", requests.Load())
+	}
+
+	if err := d.Send(context.Background(), event(3, changefeed.EventDelete)); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if requests.Load() != 6 {
+		t.Errorf("disabled webhook got an event")
+	}
+}
+
+func TestRejectedNotRetried(t *testing.T) {
+	srv, requests := endpoint(t, http.StatusGone)
+
+	db := &fakeStorage{webhooks: map[int]models.Webhook{
+		1: {ID: 1, ProjectId: 1, URL: srv.URL, Secret: secret, Enabled: true},
+	}}
+
+	d := start(t, db)
+
+	if err := d.Send(context.Background(), event(1, changefeed.EventCreate)); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the failure", func() bool { return db.webhook(1).Failures == 1 })
+
+	if requests.Load() != 1 {
+		t.Errorf("got %d requests, want 1", requests.Load())
+	}
+}
+
+func TestTest(t *testing.T) {
+	srv, _ := endpoint(t, http.StatusInternalServerError)
+
+	webhook := models.Webhook{ID: 1, ProjectId: 1, URL: srv.URL, Secret: secret, Enabled: false}
+	db := &fakeStorage{webhooks: map[int]models.Webhook{1: webhook}}
+
+	d := webhooks.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, config.Webhooks{Timeout: time.Second, AllowPrivateAddresses: true})
+
+	delivery, err := d.Test(context.Background(), webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if delivery.ID == 0 || delivery.Success || delivery.EventType != string(webhooks.EventTest) || delivery.Error == "" {
+		t.Errorf("got delivery %+v", delivery)
+	}
+
+	if db.webhook(1).Failures != 0 {
+		t.Error("test delivery counted as a failure")
+	}
+}
+
+func TestPrivateAddressRefused(t *testing.T) {
+	srv, requests := endpoint(t, http.StatusOK)
+	port := srv.URL[strings.LastIndex(srv.URL, ":"):]
+
+	d := webhooks.New(slog.New(slog.NewTextHandler(io.Discard, nil)), &fakeStorage{}, config.Webhooks{Timeout: time.Second})
+
+	// the names are checked once resolved
+	for _, url := range []string{srv.URL, "http://localhost" + port, "http://[::1]" + port, "http://169.254.169.254/latest/meta-data"} {
+		delivery, err := d.Test(context.Background(), models.Webhook{ID: 1, ProjectId: 1, URL: url, Secret: secret})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if delivery.Success || !strings.Contains(delivery.Error, webhooks.ErrForbiddenAddress.Error()) {
+			t.Errorf("got delivery %+v to %s, want it refused", delivery, url)
+		}
+	}
+
+	if requests.Load() != 0 {
+		t.Errorf("got %d requests to the loopback", requests.Load())
+	}
+}
+
+func TestOtherSchemeRefused(t *testing.T) {
+	d := webhooks.New(slog.New(slog.NewTextHandler(io.Discard, nil)), &fakeStorage{}, config.Webhooks{Timeout: time.Second})
+
+	delivery, err := d.Test(context.Background(), models.Webhook{ID: 1, ProjectId: 1, URL: "file:///etc/passwd", Secret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if delivery.Success || !strings.Contains(delivery.Error, "scheme") {
+		t.Errorf("got delivery %+v, want it refused", delivery)
+	}
+}
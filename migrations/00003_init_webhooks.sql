@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id          bigint GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    project_id  bigint    NOT NULL,
+    url         text      NOT NULL,
+    secret      text      NOT NULL,
+    event_types text[]    NOT NULL DEFAULT '{}',
+    enabled     boolean   NOT NULL DEFAULT TRUE,
+    -- events in a row the webhook failed to receive, it is disabled after too many
+    failures    int       NOT NULL DEFAULT 0,
+    created_at  timestamp NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhooks_project_id_idx on webhooks (project_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id          bigint GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    webhook_id  bigint    NOT NULL,
+    event_id    bigint    NOT NULL,
+    event_type  text      NOT NULL,
+    attempt     int       NOT NULL,
+    status_code int,
+    error       text      NOT NULL DEFAULT '',
+    success     boolean   NOT NULL,
+    duration_ms int       NOT NULL,
+    created_at  timestamp NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (webhook_id) REFERENCES webhooks (id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_webhook_id_idx on webhook_deliveries (webhook_id, id DESC);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS webhook_deliveries;
+
+DROP TABLE IF EXISTS webhooks;
+
+-- +goose StatementEnd
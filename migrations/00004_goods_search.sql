@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- the names and the descriptions are indexed as they are, for the prefix
+-- matching of any language, and stemmed in english and russian
+ALTER TABLE goods ADD COLUMN search tsvector;
+
+CREATE OR REPLACE FUNCTION goods_search_vector(name text, description text)
+RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('simple', COALESCE(name, '')), 'A') ||
+           setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+           setweight(to_tsvector('russian', COALESCE(name, '')), 'A') ||
+           setweight(to_tsvector('simple', COALESCE(description, '')), 'B') ||
+           setweight(to_tsvector('english', COALESCE(description, '')), 'B') ||
+           setweight(to_tsvector('russian', COALESCE(description, '')), 'B');
+$$ LANGUAGE sql IMMUTABLE;
+
+-- a trigger to keep the search vector current
+CREATE OR REPLACE FUNCTION goods_search()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search := goods_search_vector(NEW.name, NEW.description);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER set_goods_search
+    BEFORE INSERT OR UPDATE OF name, description ON goods
+    FOR EACH ROW
+    EXECUTE FUNCTION goods_search();
+
+UPDATE goods SET search = goods_search_vector(name, description);
+
+CREATE INDEX goods_search_idx ON goods USING GIN (search);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS goods_search_idx;
+
+DROP TRIGGER IF EXISTS set_goods_search ON goods;
+
+DROP FUNCTION IF EXISTS goods_search;
+
+DROP FUNCTION IF EXISTS goods_search_vector;
+
+ALTER TABLE goods DROP COLUMN IF EXISTS search;
+
+-- +goose StatementEnd
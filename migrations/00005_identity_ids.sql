@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- the ids are generated unless given explicitly, the sequence starts
+-- after the ids already taken
+ALTER TABLE goods ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+
+SELECT setval(pg_get_serial_sequence('goods', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM goods;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE goods ALTER COLUMN id DROP IDENTITY IF EXISTS;
+
+-- +goose StatementEnd
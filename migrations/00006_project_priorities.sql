@@ -0,0 +1,84 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- the last priority given in every project
+CREATE TABLE IF NOT EXISTS project_priorities (
+    project_id    bigint PRIMARY KEY NOT NULL,
+    last_priority int                NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+
+-- the priorities are renumbered from 1 in every project, keeping their order
+UPDATE goods SET priority = renumbered.priority
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY project_id ORDER BY priority NULLS LAST, created_at, id) AS priority
+    FROM goods
+) AS renumbered
+WHERE goods.id = renumbered.id;
+
+INSERT INTO project_priorities (project_id, last_priority)
+SELECT project_id, MAX(priority) FROM goods GROUP BY project_id;
+
+ALTER TABLE goods ALTER COLUMN priority SET NOT NULL;
+
+ALTER TABLE goods ADD CONSTRAINT goods_project_id_priority_key UNIQUE (project_id, priority);
+
+-- a trigger to set the priority to the next one of the project when omitted,
+-- the counter row of the project stays locked until the transaction ends,
+-- so that the concurrent inserts into a project take turns
+CREATE OR REPLACE FUNCTION priority()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO project_priorities (project_id) VALUES (NEW.project_id)
+        ON CONFLICT (project_id) DO NOTHING;
+
+    IF NEW.priority IS NULL THEN
+        UPDATE project_priorities SET last_priority = last_priority + 1
+            WHERE project_id = NEW.project_id
+            RETURNING last_priority INTO NEW.priority;
+    ELSE
+        UPDATE project_priorities SET last_priority = GREATEST(last_priority, NEW.priority)
+            WHERE project_id = NEW.project_id;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS set_default_priority ON goods;
+
+CREATE TRIGGER set_default_priority
+    BEFORE INSERT OR UPDATE OF priority ON goods
+    FOR EACH ROW
+    EXECUTE FUNCTION priority();
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TRIGGER IF EXISTS set_default_priority ON goods;
+
+CREATE OR REPLACE FUNCTION priority()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.priority IS NULL THEN
+        NEW.priority := COALESCE((SELECT MAX(priority) + 1 FROM goods), 1);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER set_default_priority
+    BEFORE INSERT ON goods
+    FOR EACH ROW
+    EXECUTE FUNCTION priority();
+
+ALTER TABLE goods DROP CONSTRAINT IF EXISTS goods_project_id_priority_key;
+
+ALTER TABLE goods ALTER COLUMN priority DROP NOT NULL;
+
+DROP TABLE IF EXISTS project_priorities;
+
+-- +goose StatementEnd
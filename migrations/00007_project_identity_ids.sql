@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- the project ids are generated unless given explicitly, the sequence
+-- starts after the ids already taken. The databases migrated by an
+-- earlier 00005 have the identity already
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_attribute
+        WHERE attrelid = 'projects'::regclass AND attname = 'id' AND attidentity <> ''
+    ) THEN
+        ALTER TABLE projects ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+
+        PERFORM setval(pg_get_serial_sequence('projects', 'id'), COALESCE((SELECT MAX(id) FROM projects), 0) + 1, false);
+    END IF;
+END $$;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE projects ALTER COLUMN id DROP IDENTITY IF EXISTS;
+
+-- +goose StatementEnd